@@ -11,6 +11,7 @@ import (
 	"database/sql"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -19,13 +20,37 @@ import (
 	docs "github.com/icpinto/dating-app/docs"
 	"github.com/icpinto/dating-app/internals/db"
 	"github.com/icpinto/dating-app/middlewares"
+	"github.com/icpinto/dating-app/models"
 	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
 	_ "github.com/lib/pq"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
 func main() {
+	if err := utils.LoadSigningKeysFromEnv(); err != nil {
+		log.Fatal("Invalid JWT signing key configuration:", err)
+	}
+	if err := utils.LoadSecretKeyFromEnv(); err != nil {
+		log.Fatal("Invalid secret encryption key configuration:", err)
+	}
+	if err := utils.LoadPasswordHashParamsFromEnv(); err != nil {
+		log.Fatal("Invalid password hash configuration:", err)
+	}
+	if err := services.LoadPasswordPolicyFromEnv(); err != nil {
+		log.Fatal("Invalid password policy configuration:", err)
+	}
+	if err := utils.LoadImageLimitsFromEnv(); err != nil {
+		log.Fatal("Invalid image upload configuration:", err)
+	}
+	if err := utils.LoadMediaURLConfigFromEnv(); err != nil {
+		log.Fatal("Invalid media URL configuration:", err)
+	}
+	if err := services.LoadProfilePhotoLimitFromEnv(); err != nil {
+		log.Fatal("Invalid profile photo configuration:", err)
+	}
+
 	sqlDB, err := db.InitDB()
 	if err != nil {
 		log.Fatal("Cannot connect to the database:", err)
@@ -35,7 +60,11 @@ func main() {
 	matchServiceURL := os.Getenv("MATCH_SERVICE_URL")
 
 	matchService := services.NewMatchService(matchServiceURL)
-	router := setupRouter(sqlDB, matchService)
+	mediaStorage, err := services.NewMediaStorageFromEnv()
+	if err != nil {
+		log.Fatal("Invalid media storage configuration:", err)
+	}
+	router := setupRouter(sqlDB, matchService, mediaStorage)
 
 	messagingURL := os.Getenv("MESSAGING_SERVICE_URL")
 	if messagingURL == "" {
@@ -55,43 +84,65 @@ func main() {
 
 	worker := services.NewOutboxWorker(sqlDB, messagingURL, matchService, lifecyclePublisher)
 	go worker.Start()
+	go services.NewProfileService(sqlDB).ScoreUnscoredProfiles()
 
 	if err := router.Run(":8080"); err != nil {
 		log.Fatal("Server failed to start:", err)
 	}
 }
 
-func setupRouter(sqlDB *sql.DB, matchService *services.MatchService) *gin.Engine {
+func setupRouter(sqlDB *sql.DB, matchService *services.MatchService, mediaStorage services.MediaStorage) *gin.Engine {
 	docs.SwaggerInfo.BasePath = "/"
 
 	router := gin.Default()
-	router.Static("/uploads", "./uploads")
+	// Client IPs feed login throttling, so X-Forwarded-For is only honoured from configured proxies.
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	// Swagger documentation endpoint.
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	userService := services.NewUserService(sqlDB)
+	userService := services.NewUserService(sqlDB, services.NewMailerFromEnv())
 	friendRequestService := services.NewFriendRequestService(sqlDB)
 	profileService := services.NewProfileService(sqlDB)
+	twoFactorService := services.NewTwoFactorService(sqlDB)
+	oidcService := services.NewOIDCService(sqlDB, services.LoadOIDCProvidersFromEnv())
+	roleService := services.NewRoleService(sqlDB)
 
 	router.Use(middlewares.ServiceMiddleware(middlewares.Services{
 		UserService:          userService,
 		FriendRequestService: friendRequestService,
 		ProfileService:       profileService,
 		MatchService:         matchService,
+		TwoFactorService:     twoFactorService,
+		OIDCService:          oidcService,
+		RoleService:          roleService,
+		MediaStorage:         mediaStorage,
 	}))
 
+	router.GET("/uploads/*key", controllers.ServeMedia)
+
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
 	router.POST("/register", controllers.Register)
 	router.POST("/login", controllers.Login)
+	router.POST("/login/2fa", controllers.CompleteTwoFactorLogin)
+	router.GET("/login/oidc/:provider", controllers.StartOIDCLogin)
+	router.POST("/login/oidc/:provider/callback", controllers.CompleteOIDCLogin)
+	router.POST("/refresh", controllers.RefreshToken)
+	router.POST("/verify-email", controllers.VerifyEmail)
+	router.POST("/password/forgot", controllers.ForgotPassword)
+	router.POST("/password/reset", controllers.ResetPassword)
 	router.POST("/signout", middlewares.Authenticate, controllers.SignOut)
 
 	protected := router.Group("/user")
@@ -99,8 +150,23 @@ func setupRouter(sqlDB *sql.DB, matchService *services.MatchService) *gin.Engine
 
 	protected.POST("/profile", controllers.CreateProfile)
 	protected.GET("/profile", controllers.GetProfile)
+	protected.PATCH("/profile", controllers.PatchProfile)
 	protected.GET("/profiles", controllers.GetProfiles)
 	protected.GET("/profile/:user_id", controllers.GetUserProfile)
+	protected.GET("/profile/:user_id/photos", controllers.GetUserProfilePhotos)
+	protected.GET("/profile/photos", controllers.ListProfilePhotos)
+	protected.POST("/profile/photos", controllers.UploadProfilePhoto)
+	protected.PUT("/profile/photos/order", controllers.ReorderProfilePhotos)
+	protected.PUT("/profile/photos/:photo_id/primary", controllers.SetPrimaryProfilePhoto)
+	protected.DELETE("/profile/photos/:photo_id", controllers.DeleteProfilePhoto)
+	protected.GET("/profile/moderation", controllers.ListMyModerationItems)
+	protected.GET("/profile/privacy", controllers.GetProfilePrivacy)
+	protected.GET("/profile/completeness", controllers.GetProfileCompleteness)
+	protected.GET("/profile/history", controllers.GetProfileHistory)
+	protected.GET("/profile/views", controllers.GetProfileViews)
+	protected.GET("/profile/views/settings", controllers.GetProfileViewSettings)
+	protected.PUT("/profile/views/settings", controllers.UpdateProfileViewSettings)
+	protected.PUT("/profile/privacy", controllers.UpdateProfilePrivacy)
 	protected.GET("/matches/:user_id", controllers.GetUserMatches)
 	protected.POST("/core-preferences", controllers.SaveCorePreferences)
 	protected.GET("/core-preferences", controllers.GetCorePreferences)
@@ -108,6 +174,21 @@ func setupRouter(sqlDB *sql.DB, matchService *services.MatchService) *gin.Engine
 	protected.POST("/deactivate", controllers.DeactivateCurrentUser)
 	protected.POST("/reactivate", controllers.ReactivateCurrentUser)
 	protected.GET("/status", controllers.GetUserStatus)
+	protected.POST("/verify-email/resend", controllers.ResendVerificationEmail)
+	protected.GET("/2fa", controllers.GetTwoFactorStatus)
+	protected.POST("/2fa/enroll", controllers.EnrollTwoFactor)
+	protected.POST("/2fa/confirm", controllers.ConfirmTwoFactor)
+	protected.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+	protected.DELETE("/2fa", controllers.DisableTwoFactor)
+	protected.PUT("/password", controllers.ChangePassword)
+	protected.PUT("/email", controllers.ChangeEmail)
+	protected.GET("/identities", controllers.ListIdentities)
+	protected.POST("/identities/:provider", controllers.LinkIdentity)
+	protected.POST("/identities/:provider/callback", controllers.CompleteIdentityLink)
+	protected.DELETE("/identities/:id", controllers.UnlinkIdentity)
+	protected.GET("/sessions", controllers.ListSessions)
+	protected.DELETE("/sessions", controllers.RevokeAllSessions)
+	protected.DELETE("/sessions/:id", controllers.RevokeSession)
 	protected.DELETE("", controllers.DeleteCurrentUser)
 
 	// Allow authenticated users to retrieve profile enumerations via /user/profile/enums
@@ -122,5 +203,30 @@ func setupRouter(sqlDB *sql.DB, matchService *services.MatchService) *gin.Engine
 	protected.GET("/sentRequests", controllers.GetSentRequests)
 	protected.GET("/checkReqStatus/:reciver_id", controllers.CheckReqStatus)
 
+	// Staff endpoints. Every route needs at least the moderator role; routes that only admins may
+	// use add their own RequireRole.
+	admin := router.Group("/admin")
+	admin.Use(middlewares.Authenticate, middlewares.RequireRole(models.RoleAdmin, models.RoleModerator))
+
+	adminOnly := middlewares.RequireRole(models.RoleAdmin)
+	admin.GET("/users/:user_id/roles", adminOnly, controllers.ListUserRoles)
+	admin.PUT("/users/:user_id/roles/:role", adminOnly, controllers.GrantUserRole)
+	admin.DELETE("/users/:user_id/roles/:role", adminOnly, controllers.RevokeUserRole)
+	admin.GET("/users/:user_id/profile/history", adminOnly, controllers.GetUserProfileHistory)
+
+	admin.GET("/moderation", controllers.ListModerationQueue)
+	admin.POST("/moderation/:item_id/approve", controllers.ApproveModerationItem)
+	admin.POST("/moderation/:item_id/reject", controllers.RejectModerationItem)
+
 	return router
 }
+
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
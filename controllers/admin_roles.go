@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// ListUserRoles godoc
+// @Summary      List the roles of a user
+// @Description  Admin only. Returns the roles held by the user.
+// @Tags         Admin
+// @Produce      json
+// @Param        user_id  path      int  true  "User ID"
+// @Success      200      {object}  models.UserRoles
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      403      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /admin/users/{user_id}/roles [get]
+// @Security     BearerAuth
+func ListUserRoles(ctx *gin.Context) {
+	roleService := ctx.MustGet("roleService").(*services.RoleService)
+
+	userID, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "ListUserRoles invalid user id", "Invalid user id")
+		return
+	}
+
+	roles, err := roleService.ListRoles(userID)
+	if err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ListUserRoles service error", "Could not retrieve roles")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, models.UserRoles{UserID: userID, Roles: roles})
+}
+
+// GrantUserRole godoc
+// @Summary      Grant a role
+// @Description  Admin only. Gives the user the role; granting a role the user already holds succeeds. The user's access tokens carry the role once they are refreshed.
+// @Tags         Admin
+// @Produce      json
+// @Param        user_id  path      int     true  "User ID"
+// @Param        role     path      string  true  "Role"  Enums(admin, moderator)
+// @Success      200      {object}  utils.MessageResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      403      {object}  utils.ErrorResponse
+// @Failure      404      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /admin/users/{user_id}/roles/{role} [put]
+// @Security     BearerAuth
+func GrantUserRole(ctx *gin.Context) {
+	roleService := ctx.MustGet("roleService").(*services.RoleService)
+
+	userID, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "GrantUserRole invalid user id", "Invalid user id")
+		return
+	}
+
+	if err := roleService.GrantRole(ctx.Request.Context(), ctx.GetInt("userID"), userID, ctx.Param("role")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownRole):
+			utils.RespondError(ctx, http.StatusBadRequest, err, "GrantUserRole unknown role", "Unknown role")
+		case errors.Is(err, repositories.ErrUserNotFound):
+			utils.RespondError(ctx, http.StatusNotFound, err, "GrantUserRole user not found", "User not found")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, "GrantUserRole service error", "Could not grant role")
+		}
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Role granted"})
+}
+
+// RevokeUserRole godoc
+// @Summary      Revoke a role
+// @Description  Admin only. Takes the role away from the user; role protected routes refuse the user's existing access tokens on the next request. Admins cannot revoke their own admin role.
+// @Tags         Admin
+// @Produce      json
+// @Param        user_id  path      int     true  "User ID"
+// @Param        role     path      string  true  "Role"  Enums(admin, moderator)
+// @Success      200      {object}  utils.MessageResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      403      {object}  utils.ErrorResponse
+// @Failure      404      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /admin/users/{user_id}/roles/{role} [delete]
+// @Security     BearerAuth
+func RevokeUserRole(ctx *gin.Context) {
+	roleService := ctx.MustGet("roleService").(*services.RoleService)
+
+	userID, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "RevokeUserRole invalid user id", "Invalid user id")
+		return
+	}
+
+	if err := roleService.RevokeRole(ctx.Request.Context(), ctx.GetInt("userID"), userID, ctx.Param("role")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownRole):
+			utils.RespondError(ctx, http.StatusBadRequest, err, "RevokeUserRole unknown role", "Unknown role")
+		case errors.Is(err, services.ErrCannotRevokeOwnAdmin):
+			utils.RespondError(ctx, http.StatusConflict, err, "RevokeUserRole own admin role", "You cannot revoke your own admin role")
+		case errors.Is(err, repositories.ErrRoleNotGranted):
+			utils.RespondError(ctx, http.StatusNotFound, err, "RevokeUserRole not granted", "User does not hold this role")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, "RevokeUserRole service error", "Could not revoke role")
+		}
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Role revoked"})
+}
@@ -0,0 +1,216 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/utils"
+)
+
+func expectRoleCheck(mock sqlmock.Sqlmock, userID int, granted bool) {
+	mock.ExpectQuery("SELECT EXISTS \\(\\s*SELECT 1 FROM user_roles WHERE user_id = \\$1 AND role = ANY\\(\\$2\\)").
+		WithArgs(userID, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(granted))
+}
+
+func adminRequest(t *testing.T, method, target string, roles ...string) *http.Request {
+	t.Helper()
+	token, err := utils.GenerateSessionToken(1, testSessionID, roles...)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", token)
+	return req
+}
+
+func TestAdminRoutesRejectUsersWithoutRoles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(t, http.MethodGet, "/admin/users/2/roles"))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestAdminOnlyRoutesRejectModerators(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectRoleCheck(mock, 1, true)
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(t, http.MethodPut, "/admin/users/2/roles/moderator", models.RoleModerator))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestUserProfileHistoryRejectsNonAdmins(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []string
+	}{
+		{name: "user without roles"},
+		{name: "moderator", roles: []string{models.RoleModerator}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			expectAuthenticatedSession(mock, testSessionID, 1)
+			// Roles missing from the token are refused without a lookup; a moderator's role is
+			// confirmed by the admin group before the admin-only check refuses them.
+			if len(tt.roles) > 0 {
+				expectRoleCheck(mock, 1, true)
+			}
+
+			router := setupRouter(db)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, adminRequest(t, http.MethodGet, "/admin/users/2/profile/history", tt.roles...))
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected status 403 got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesRejectRevokedRoleStillInToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectRoleCheck(mock, 1, false)
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(t, http.MethodGet, "/admin/users/2/roles", models.RoleAdmin))
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestListUserRolesAsAdmin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectRoleCheck(mock, 1, true)
+	expectRoleCheck(mock, 1, true)
+	expectRoles(mock, 2, models.RoleModerator)
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(t, http.MethodGet, "/admin/users/2/roles", models.RoleAdmin))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp models.UserRoles
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if resp.UserID != 2 || len(resp.Roles) != 1 || resp.Roles[0] != models.RoleModerator {
+		t.Fatalf("unexpected roles: %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestGrantUserRoleRecordsAuditEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectRoleCheck(mock, 1, true)
+	expectRoleCheck(mock, 1, true)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO user_roles").
+		WithArgs(2, models.RoleModerator, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 2, models.UserAuditEventTypeRoleGranted, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(t, http.MethodPut, "/admin/users/2/roles/moderator", models.RoleAdmin))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestRevokeOwnAdminRoleIsRefused(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectRoleCheck(mock, 1, true)
+	expectRoleCheck(mock, 1, true)
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, adminRequest(t, http.MethodDelete, "/admin/users/1/roles/admin", models.RoleAdmin))
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
@@ -2,11 +2,17 @@ package controllers_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
@@ -16,18 +22,107 @@ import (
 	"github.com/icpinto/dating-app/repositories"
 	"github.com/icpinto/dating-app/services"
 	"github.com/icpinto/dating-app/utils"
+	"golang.org/x/crypto/bcrypt"
 )
 
+const testSessionID = "0b5a8f0e-2f44-4c1a-9d8e-5f6a7b8c9d0e"
+
 func setupRouter(db *sql.DB) *gin.Engine {
+	return setupRouterWithMailer(db, services.NewMemoryMailer())
+}
+
+func setupRouterWithMailer(db *sql.DB, mailer services.Mailer) *gin.Engine {
+	return setupRouterWithServices(db, mailer, nil)
+}
+
+func setupRouterWithServices(db *sql.DB, mailer services.Mailer, oidcProviders []services.OIDCProviderConfig) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	userService := services.NewUserService(db)
-	r.Use(middlewares.ServiceMiddleware(middlewares.Services{UserService: userService}))
+	userService := services.NewUserService(db, mailer)
+	twoFactorService := services.NewTwoFactorService(db)
+	oidcService := services.NewOIDCService(db, oidcProviders)
+	roleService := services.NewRoleService(db)
+	r.Use(middlewares.ServiceMiddleware(middlewares.Services{UserService: userService, ProfileService: services.NewProfileService(db), TwoFactorService: twoFactorService, OIDCService: oidcService, RoleService: roleService}))
 	r.POST("/register", controllers.Register)
 	r.POST("/login", controllers.Login)
+	r.POST("/login/2fa", controllers.CompleteTwoFactorLogin)
+	r.GET("/login/oidc/:provider", controllers.StartOIDCLogin)
+	r.POST("/login/oidc/:provider/callback", controllers.CompleteOIDCLogin)
+	r.POST("/refresh", controllers.RefreshToken)
+	r.POST("/verify-email", controllers.VerifyEmail)
+	r.POST("/password/forgot", controllers.ForgotPassword)
+	r.POST("/password/reset", controllers.ResetPassword)
+	r.POST("/signout", middlewares.Authenticate, controllers.SignOut)
+	r.PUT("/user/password", middlewares.Authenticate, controllers.ChangePassword)
+	r.PUT("/user/email", middlewares.Authenticate, controllers.ChangeEmail)
+	r.POST("/user/2fa/confirm", middlewares.Authenticate, controllers.ConfirmTwoFactor)
+	r.POST("/user/2fa/recovery-codes", middlewares.Authenticate, controllers.RegenerateRecoveryCodes)
+	r.DELETE("/user/2fa", middlewares.Authenticate, controllers.DisableTwoFactor)
+	r.GET("/user/identities", middlewares.Authenticate, controllers.ListIdentities)
+	r.POST("/user/identities/:provider", middlewares.Authenticate, controllers.LinkIdentity)
+	r.POST("/user/identities/:provider/callback", middlewares.Authenticate, controllers.CompleteIdentityLink)
+	r.DELETE("/user/identities/:id", middlewares.Authenticate, controllers.UnlinkIdentity)
+	r.GET("/user/sessions", middlewares.Authenticate, controllers.ListSessions)
+	r.DELETE("/user/sessions", middlewares.Authenticate, controllers.RevokeAllSessions)
+	r.DELETE("/user/sessions/:id", middlewares.Authenticate, controllers.RevokeSession)
+	admin := r.Group("/admin", middlewares.Authenticate, middlewares.RequireRole(models.RoleAdmin, models.RoleModerator))
+	adminOnly := middlewares.RequireRole(models.RoleAdmin)
+	admin.GET("/users/:user_id/roles", adminOnly, controllers.ListUserRoles)
+	admin.PUT("/users/:user_id/roles/:role", adminOnly, controllers.GrantUserRole)
+	admin.DELETE("/users/:user_id/roles/:role", adminOnly, controllers.RevokeUserRole)
+	admin.GET("/users/:user_id/profile/history", adminOnly, controllers.GetUserProfileHistory)
 	return r
 }
 
+// testStrongPassword satisfies the default password policy.
+const testStrongPassword = "Correct-horse-battery-7"
+
+// testClientIP is the client IP gin reports for requests built with httptest.NewRequest.
+const testClientIP = "192.0.2.1"
+
+func expectLoginNotThrottled(mock sqlmock.Sqlmock, key string) {
+	mock.ExpectQuery("SELECT MAX\\(locked_until\\)\\s+FROM login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, key, repositories.LoginAttemptScopeIP, testClientIP).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+}
+
+func expectLoginFailure(mock sqlmock.Sqlmock, key string, keyFailures, ipFailures int) {
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, key, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(keyFailures))
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs(repositories.LoginAttemptScopeIP, testClientIP, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(ipFailures))
+}
+
+func expectTwoFactorEnabled(mock sqlmock.Sqlmock, userID int, enabled bool) {
+	mock.ExpectQuery("SELECT EXISTS \\(\\s*SELECT 1 FROM user_totp").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(enabled))
+}
+
+func expectUsernameAndEmail(mock sqlmock.Sqlmock, userID int) {
+	mock.ExpectQuery("SELECT username, email FROM users WHERE id=\\$1").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"username", "email"}).AddRow("john", "john@example.com"))
+}
+
+func expectRoles(mock sqlmock.Sqlmock, userID int, roles ...string) {
+	rows := sqlmock.NewRows([]string{"role"})
+	for _, role := range roles {
+		rows.AddRow(role)
+	}
+	mock.ExpectQuery("SELECT role FROM user_roles WHERE user_id = \\$1").
+		WithArgs(userID).
+		WillReturnRows(rows)
+}
+
+func expectEmailVerified(mock sqlmock.Sqlmock, userID int) {
+	mock.ExpectQuery("SELECT email, email_verified FROM users WHERE id=\\$1").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "email_verified"}).AddRow("john@example.com", true))
+}
+
 func TestRegisterSuccess(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -35,13 +130,19 @@ func TestRegisterSuccess(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectExec("INSERT INTO users").
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").
 		WithArgs("john", "john@example.com", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO email_verification_tokens").
+		WithArgs(1, "john@example.com", sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	router := setupRouter(db)
+	mailer := services.NewMemoryMailer()
+	router := setupRouterWithMailer(db, mailer)
 
-	body, _ := json.Marshal(models.User{Username: "john", Email: "john@example.com", Password: "pass"})
+	body, _ := json.Marshal(models.User{Username: "john", Email: "john@example.com", Password: testStrongPassword})
 	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
@@ -53,6 +154,33 @@ func TestRegisterSuccess(t *testing.T) {
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("unmet db expectations: %v", err)
 	}
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "john@example.com" || !strings.Contains(messages[0].Body, "/verify-email?token=") {
+		t.Fatalf("expected a verification email, got: %+v", messages)
+	}
+}
+
+func TestRegisterRejectsInvalidEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	router := setupRouter(db)
+
+	body, _ := json.Marshal(models.User{Username: "john", Email: "john@example.com\r\nBcc: x@example.com", Password: "pass"})
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
 }
 
 func TestRegisterDuplicateUser(t *testing.T) {
@@ -62,13 +190,15 @@ func TestRegisterDuplicateUser(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectExec("INSERT INTO users").
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").
 		WithArgs("john", "john@example.com", sqlmock.AnyArg()).
 		WillReturnError(repositories.ErrDuplicateUser)
+	mock.ExpectRollback()
 
 	router := setupRouter(db)
 
-	body, _ := json.Marshal(models.User{Username: "john", Email: "john@example.com", Password: "pass"})
+	body, _ := json.Marshal(models.User{Username: "john", Email: "john@example.com", Password: testStrongPassword})
 	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
@@ -82,6 +212,73 @@ func TestRegisterDuplicateUser(t *testing.T) {
 	}
 }
 
+func TestRegisterRejectsWeakPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	router := setupRouter(db)
+
+	body, _ := json.Marshal(models.User{Username: "john", Email: "john@example.com", Password: "john1"})
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp utils.ValidationErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	codes := map[string]bool{}
+	for _, field := range resp.Fields {
+		if field.Field != "password" {
+			t.Fatalf("unexpected field %q", field.Field)
+		}
+		codes[field.Code] = true
+	}
+	if !codes["too_short"] || !codes["similar_to_username"] || len(codes) != 2 {
+		t.Fatalf("expected too_short and similar_to_username, got %+v", resp.Fields)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestRegisterRejectsEmailLikeUsername(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	router := setupRouter(db)
+
+	body, _ := json.Marshal(models.User{Username: "jane@example.com", Email: "john@example.com", Password: testStrongPassword})
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp utils.ValidationErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if len(resp.Fields) != 1 || resp.Fields[0].Field != "username" || resp.Fields[0].Code != "looks_like_email" {
+		t.Fatalf("expected a looks_like_email username error, got %+v", resp.Fields)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
 func TestLoginSuccess(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -97,6 +294,15 @@ func TestLoginSuccess(t *testing.T) {
 	mock.ExpectQuery("SELECT id, password FROM users WHERE username=\\$1").
 		WithArgs("john").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(1, hashed))
+	expectLoginNotThrottled(mock, "user:1")
+	mock.ExpectExec("DELETE FROM login_attempts WHERE scope = \\$1 AND key = \\$2").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectTwoFactorEnabled(mock, 1, false)
+	mock.ExpectExec("INSERT INTO user_sessions").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRoles(mock, 1)
 
 	router := setupRouter(db)
 
@@ -112,6 +318,180 @@ func TestLoginSuccess(t *testing.T) {
 	if !bytes.Contains(w.Body.Bytes(), []byte("token")) {
 		t.Fatalf("expected token in response: %s", w.Body.String())
 	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("refresh_token")) {
+		t.Fatalf("expected refresh token in response: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestLoginWithEmailIgnoresCase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	hashed, err := utils.HashPassword("pass")
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT id, password FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("John@Example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(1, hashed))
+	expectLoginNotThrottled(mock, "user:1")
+	mock.ExpectExec("DELETE FROM login_attempts WHERE scope = \\$1 AND key = \\$2").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectTwoFactorEnabled(mock, 1, false)
+	mock.ExpectExec("INSERT INTO user_sessions").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRoles(mock, 1)
+
+	router := setupRouter(db)
+
+	body := []byte(`{"identifier":"John@Example.com","password":"pass"}`)
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+// expectLoginWithRehash expects a successful login for john whose stored hash gets replaced, and
+// captures the replacement.
+func expectLoginWithRehash(mock sqlmock.Sqlmock, storedHash string) *capturedArg {
+	upgraded := &capturedArg{}
+	mock.ExpectQuery("SELECT id, password FROM users WHERE username=\\$1").
+		WithArgs("john").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(1, storedHash))
+	expectLoginNotThrottled(mock, "user:1")
+	mock.ExpectExec("DELETE FROM login_attempts WHERE scope = \\$1 AND key = \\$2").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET password = \\$3 WHERE id = \\$1 AND password = \\$2").
+		WithArgs(1, storedHash, upgraded).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectTwoFactorEnabled(mock, 1, false)
+	mock.ExpectExec("INSERT INTO user_sessions").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRoles(mock, 1)
+	return upgraded
+}
+
+func loginAsJohn(router *gin.Engine) *httptest.ResponseRecorder {
+	body := []byte(`{"username":"john","password":"pass"}`)
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginUpgradesBcryptHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
+	upgraded := expectLoginWithRehash(mock, string(legacy))
+
+	w := loginAsJohn(setupRouter(db))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(upgraded.value, "$argon2id$") || !utils.CheckPassword(upgraded.value, "pass") {
+		t.Fatalf("expected an argon2id hash of the password, got %q", upgraded.value)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestLoginUpgradesOutdatedArgon2Hash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	weak := utils.DefaultPasswordHashParams()
+	weak.Memory = 1024
+	weak.Iterations = 1
+	if err := utils.ConfigurePasswordHashParams(weak); err != nil {
+		t.Fatalf("configure error: %v", err)
+	}
+	outdated, err := utils.HashPassword("pass")
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
+	if err := utils.ConfigurePasswordHashParams(utils.DefaultPasswordHashParams()); err != nil {
+		t.Fatalf("configure error: %v", err)
+	}
+	upgraded := expectLoginWithRehash(mock, outdated)
+
+	w := loginAsJohn(setupRouter(db))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(upgraded.value, "$m=19456,t=2,p=1$") || !utils.CheckPassword(upgraded.value, "pass") {
+		t.Fatalf("expected a hash with the current parameters, got %q", upgraded.value)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestLoginFallsBackToUsernameContainingAt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	hashed, err := utils.HashPassword("pass")
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
+
+	// Accounts registered before usernames were barred from containing @ still sign in by name.
+	mock.ExpectQuery("SELECT id, password FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("jo@home").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT id, password FROM users WHERE username=\\$1").
+		WithArgs("jo@home").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(3, hashed))
+	expectLoginNotThrottled(mock, "user:3")
+	expectLoginFailure(mock, "user:3", 1, 1)
+
+	router := setupRouter(db)
+
+	body := []byte(`{"identifier":"jo@home","password":"wrong"}`)
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("unmet db expectations: %v", err)
 	}
@@ -127,6 +507,8 @@ func TestLoginUserNotFound(t *testing.T) {
 	mock.ExpectQuery("SELECT id, password FROM users WHERE username=\\$1").
 		WithArgs("missing").
 		WillReturnError(sql.ErrNoRows)
+	expectLoginNotThrottled(mock, "missing")
+	expectLoginFailure(mock, "missing", 1, 1)
 
 	router := setupRouter(db)
 
@@ -136,8 +518,12 @@ func TestLoginUserNotFound(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusNotFound {
-		t.Fatalf("expected status 404 got %d: %s", w.Code, w.Body.String())
+	// Unknown usernames must be indistinguishable from wrong passwords.
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "Invalid credentials") {
+		t.Fatalf("expected generic credentials error, got: %s", w.Body.String())
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("unmet db expectations: %v", err)
@@ -159,6 +545,8 @@ func TestLoginInvalidPassword(t *testing.T) {
 	mock.ExpectQuery("SELECT id, password FROM users WHERE username=\\$1").
 		WithArgs("john").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(1, hashed))
+	expectLoginNotThrottled(mock, "user:1")
+	expectLoginFailure(mock, "user:1", 1, 1)
 
 	router := setupRouter(db)
 
@@ -176,55 +564,550 @@ func TestLoginInvalidPassword(t *testing.T) {
 	}
 }
 
-func TestReactivateAllowsInactiveUser(t *testing.T) {
+func TestLoginLocksUsernameAfterRepeatedFailures(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("error creating sqlmock: %v", err)
 	}
 	defer db.Close()
 
-	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
-		WithArgs(1).
-		WillReturnError(sql.ErrNoRows)
-
-	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1").
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("john"))
+	hashed, err := utils.HashPassword("pass")
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
 
-	mock.ExpectBegin()
-	mock.ExpectExec("\\s*UPDATE users\\s+SET is_active = true, deactivated_at = NULL\\s+WHERE id = \\$1 AND is_active = false").
-		WithArgs(1).
+	mock.ExpectQuery("SELECT id, password FROM users WHERE username=\\$1").
+		WithArgs("John").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(1, hashed))
+	expectLoginNotThrottled(mock, "user:1")
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(10))
+	mock.ExpectExec("UPDATE login_attempts\\s+SET locked_until = \\$3").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1", sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs(repositories.LoginAttemptScopeIP, testClientIP, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
 
-	mock.ExpectExec("\\s*INSERT INTO user_lifecycle_outbox").
-		WithArgs(sqlmock.AnyArg(), 1, "reactivated", sqlmock.AnyArg(), sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
-	mock.ExpectCommit()
-
-	gin.SetMode(gin.TestMode)
-	router := gin.New()
-	userService := services.NewUserService(db)
-	router.Use(middlewares.ServiceMiddleware(middlewares.Services{UserService: userService}))
-	router.POST("/user/reactivate", middlewares.Authenticate, controllers.ReactivateCurrentUser)
-
-	token, err := utils.GenerateToken(1)
-	if err != nil {
-		t.Fatalf("error generating token: %v", err)
-	}
+	router := setupRouter(db)
 
-	body := []byte(`{"reason":"let me back"}`)
-	req := httptest.NewRequest(http.MethodPost, "/user/reactivate", bytes.NewReader(body))
+	body := []byte(`{"username":"John","password":"wrong"}`)
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", token)
-
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusAccepted {
-		t.Fatalf("expected status 202 got %d: %s", w.Code, w.Body.String())
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("unmet db expectations: %v", err)
 	}
 }
+
+func TestLoginRejectsLockedUsernameWithoutCheckingPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, password FROM users WHERE username=\\$1").
+		WithArgs("john").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(1, "hash"))
+	mock.ExpectQuery("SELECT MAX\\(locked_until\\)\\s+FROM login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1", repositories.LoginAttemptScopeIP, testClientIP).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(time.Now().Add(90 * time.Second)))
+
+	router := setupRouter(db)
+
+	body := []byte(`{"username":"john","password":"pass"}`)
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 got %d: %s", w.Code, w.Body.String())
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "90" && retryAfter != "89" {
+		t.Fatalf("expected Retry-After of about 90 seconds, got %q", retryAfter)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestReactivateAllowsInactiveUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT EXISTS \\(\\s*SELECT 1 FROM user_sessions").
+		WithArgs(testSessionID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+
+	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("john"))
+	expectEmailVerified(mock, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("\\s*UPDATE users\\s+SET is_active = true, deactivated_at = NULL\\s+WHERE id = \\$1 AND is_active = false").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec("\\s*INSERT INTO user_lifecycle_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, "reactivated", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	userService := services.NewUserService(db, services.NewMemoryMailer())
+	router.Use(middlewares.ServiceMiddleware(middlewares.Services{UserService: userService}))
+	router.POST("/user/reactivate", middlewares.Authenticate, controllers.ReactivateCurrentUser)
+
+	token, err := utils.GenerateSessionToken(1, testSessionID)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+
+	body := []byte(`{"reason":"let me back"}`)
+	req := httptest.NewRequest(http.MethodPost, "/user/reactivate", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestRefreshTokenRotatesSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("UPDATE user_sessions\\s+SET previous_refresh_token_hash = refresh_token_hash").
+		WithArgs(utils.HashToken("old-refresh"), sqlmock.AnyArg(), sqlmock.AnyArg(), testClientIP).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(testSessionID, 1))
+	expectRoles(mock, 1, models.RoleModerator)
+
+	router := setupRouter(db)
+
+	body := []byte(`{"refresh_token":"old-refresh"}`)
+	req := httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp utils.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" || resp.RefreshToken == "old-refresh" {
+		t.Fatalf("expected a new token pair, got: %s", w.Body.String())
+	}
+	claims, err := utils.ParseToken(resp.Token)
+	if err != nil {
+		t.Fatalf("invalid access token: %v", err)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != models.RoleModerator {
+		t.Fatalf("expected the access token to carry the moderator role, got %v", claims.Roles)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("UPDATE user_sessions\\s+SET previous_refresh_token_hash = refresh_token_hash").
+		WithArgs(utils.HashToken("stolen-refresh"), sqlmock.AnyArg(), sqlmock.AnyArg(), testClientIP).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE previous_refresh_token_hash = \\$1").
+		WithArgs(utils.HashToken("stolen-refresh")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	router := setupRouter(db)
+
+	body := []byte(`{"refresh_token":"stolen-refresh"}`)
+	req := httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestSignOutRevokesSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT EXISTS \\(\\s*SELECT 1 FROM user_sessions").
+		WithArgs(testSessionID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("john"))
+	expectEmailVerified(mock, 1)
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE id = \\$1 AND user_id = \\$2").
+		WithArgs(testSessionID, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	router := setupRouter(db)
+
+	token, err := utils.GenerateSessionToken(1, testSessionID)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/signout", nil)
+	req.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestVerifyEmailMarksAddressVerified(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE email_verification_tokens\\s+SET used_at = NOW\\(\\)\\s+WHERE token_hash = \\$1").
+		WithArgs(utils.HashToken("verify-me")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).AddRow(1, "john@example.com"))
+	mock.ExpectExec("UPDATE users\\s+SET email_verified = true").
+		WithArgs(1, "john@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	router := setupRouter(db)
+
+	body := []byte(`{"token":"verify-me"}`)
+	req := httptest.NewRequest(http.MethodPost, "/verify-email", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestVerifyEmailRejectsUsedOrExpiredToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE email_verification_tokens").
+		WithArgs(utils.HashToken("used-token")).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	router := setupRouter(db)
+
+	body := []byte(`{"token":"used-token"}`)
+	req := httptest.NewRequest(http.MethodPost, "/verify-email", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestForgotPasswordEmailsResetLink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, email FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("john@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, "John@Example.com"))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE password_reset_tokens\\s+SET used_at = NOW\\(\\)\\s+WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO password_reset_tokens").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	mailer := services.NewMemoryMailer()
+	router := setupRouterWithMailer(db, mailer)
+
+	body := []byte(`{"email":"john@example.com"}`)
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202 got %d: %s", w.Code, w.Body.String())
+	}
+	// The email is sent after answering, to the address stored for the account.
+	messages := waitForMessages(t, mailer, 1)
+	if messages[0].To != "John@Example.com" || !strings.Contains(messages[0].Body, "/password/reset?token=") {
+		t.Fatalf("expected a reset email to the stored address, got: %+v", messages)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+// waitForMessages waits for the mailer to have recorded count messages, which services may send
+// after the response was written.
+func waitForMessages(t *testing.T, mailer *services.MemoryMailer, count int) []services.MailMessage {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		messages := mailer.Messages()
+		if len(messages) >= count {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d emails, got: %+v", count, messages)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// failingMailer rejects every message, like an unreachable mail server.
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, services.MailMessage) error {
+	return errors.New("mail server unavailable")
+}
+
+func TestForgotPasswordAcceptsWhenMailerFails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, email FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("john@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, "John@Example.com"))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE password_reset_tokens\\s+SET used_at = NOW\\(\\)\\s+WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO password_reset_tokens").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	router := setupRouterWithMailer(db, failingMailer{})
+
+	body := []byte(`{"email":"john@example.com"}`)
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// The answer must match the one for unknown addresses.
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestForgotPasswordDoesNotRevealUnknownEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, email FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+
+	mailer := services.NewMemoryMailer()
+	router := setupRouterWithMailer(db, mailer)
+
+	body := []byte(`{"email":"nobody@example.com"}`)
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202 got %d: %s", w.Code, w.Body.String())
+	}
+	if len(mailer.Messages()) != 0 {
+		t.Fatalf("expected no email for an unknown address")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestResetPasswordRevokesSessionsAndAudits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE password_reset_tokens\\s+SET used_at = NOW\\(\\)\\s+WHERE token_hash = \\$1").
+		WithArgs(utils.HashToken("reset-me")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	expectUsernameAndEmail(mock, 1)
+	mock.ExpectExec("UPDATE users SET password = \\$2 WHERE id = \\$1").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE password_reset_tokens\\s+SET used_at = NOW\\(\\)\\s+WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, models.UserAuditEventTypePasswordReset, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	router := setupRouter(db)
+
+	body := []byte(`{"token":"reset-me","password":"` + testStrongPassword + `"}`)
+	req := httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestResetPasswordRejectsUsedToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE password_reset_tokens").
+		WithArgs(utils.HashToken("used-token")).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	router := setupRouter(db)
+
+	body := []byte(`{"token":"used-token","password":"new-password"}`)
+	req := httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestGetJWKSPublishesOnlyAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating rsa key: %v", err)
+	}
+	keys := []utils.SigningKey{
+		{ID: "rsa-1", Algorithm: "RS256", PrivateKey: rsaKey},
+		{ID: "legacy-hmac", Algorithm: "HS256", Secret: []byte("shared-secret")},
+	}
+	if err := utils.ConfigureSigningKeys(keys, "rsa-1"); err != nil {
+		t.Fatalf("error configuring signing keys: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := utils.LoadSigningKeysFromEnv(); err != nil {
+			t.Fatalf("error restoring signing keys: %v", err)
+		}
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var jwks utils.JSONWebKeySet
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("invalid jwks body: %v", err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("expected exactly one published key, got: %s", w.Body.String())
+	}
+	if key := jwks.Keys[0]; key.Kid != "rsa-1" || key.Kty != "RSA" || key.Alg != "RS256" || key.N == "" || key.E == "" {
+		t.Fatalf("unexpected published key: %+v", key)
+	}
+}
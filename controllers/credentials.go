@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type changeEmailRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	Email           string `json:"email" binding:"required"`
+}
+
+// ChangePassword godoc
+// @Summary      Change the password
+// @Description  Replace the password after checking the current one. Every other session is signed out. Wrong current passwords count as failed logins, so repeated failures are answered with 429 and a Retry-After header.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      changePasswordRequest  true  "Current and new password"
+// @Success      200      {object}  utils.MessageResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      422      {object}  utils.ValidationErrorResponse
+// @Failure      429      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /user/password [put]
+// @Security     BearerAuth
+func ChangePassword(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	var req changePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "ChangePassword bind error", "Invalid input")
+		return
+	}
+
+	err := userService.ChangePassword(ctx.Request.Context(), ctx.GetInt("userID"), ctx.GetString("sessionID"),
+		req.CurrentPassword, req.NewPassword, ctx.ClientIP(), ctx.Request.UserAgent())
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		if errors.As(err, &throttled) {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			utils.RespondError(ctx, http.StatusTooManyRequests, err, "ChangePassword throttled", "Too many failed attempts, try again later")
+			return
+		}
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			utils.RespondError(ctx, http.StatusUnauthorized, err, "ChangePassword invalid password", "Invalid credentials")
+			return
+		}
+		var invalid *utils.ValidationError
+		if errors.As(err, &invalid) {
+			utils.RespondValidationError(ctx, invalid, "ChangePassword validation error")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ChangePassword service error", "Password change failed")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// ChangeEmail godoc
+// @Summary      Change the email address
+// @Description  Check the current password and send a confirmation link to the new address. The current address stays in use until the link is followed, after which the old address is notified. Every other session is signed out.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      changeEmailRequest  true  "Current password and new address"
+// @Success      202      {object}  utils.MessageResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      429      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /user/email [put]
+// @Security     BearerAuth
+func ChangeEmail(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	var req changeEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "ChangeEmail bind error", "Invalid input")
+		return
+	}
+
+	err := userService.RequestEmailChange(ctx.Request.Context(), ctx.GetInt("userID"), ctx.GetString("sessionID"),
+		req.CurrentPassword, req.Email, ctx.ClientIP(), ctx.Request.UserAgent())
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			utils.RespondError(ctx, http.StatusTooManyRequests, err, "ChangeEmail throttled", "Too many failed attempts, try again later")
+		case errors.Is(err, services.ErrInvalidEmail):
+			utils.RespondError(ctx, http.StatusBadRequest, err, "ChangeEmail invalid email", "Invalid email address")
+		case errors.Is(err, services.ErrEmailUnchanged):
+			utils.RespondError(ctx, http.StatusBadRequest, err, "ChangeEmail unchanged", "New email address matches the current one")
+		case errors.Is(err, services.ErrInvalidCredentials):
+			utils.RespondError(ctx, http.StatusUnauthorized, err, "ChangeEmail invalid password", "Invalid credentials")
+		case errors.Is(err, repositories.ErrEmailInUse):
+			utils.RespondError(ctx, http.StatusConflict, err, "ChangeEmail address taken", "Email address is already in use")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, "ChangeEmail service error", "Email change failed")
+		}
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusAccepted, gin.H{"message": "Check the new address for a confirmation link"})
+}
@@ -0,0 +1,308 @@
+package controllers_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// expectCurrentPasswordCheck expects the current password of userID, stored as password, to be
+// checked against the login throttle and the outcome recorded there.
+func expectCurrentPasswordCheck(t *testing.T, mock sqlmock.Sqlmock, userID int, password string, matches bool) {
+	t.Helper()
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+	key := fmt.Sprintf("user:%d", userID)
+	expectLoginNotThrottled(mock, key)
+	mock.ExpectQuery("SELECT password FROM users WHERE id=\\$1").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(hash))
+	if !matches {
+		expectLoginFailure(mock, key, 1, 1)
+		return
+	}
+	mock.ExpectExec("DELETE FROM login_attempts WHERE scope = \\$1 AND key = \\$2").
+		WithArgs(repositories.LoginAttemptScopeUsername, key).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func credentialsRequest(t *testing.T, target, body string) *http.Request {
+	t.Helper()
+	token, err := utils.GenerateSessionToken(1, testSessionID)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectCurrentPasswordCheck(t, mock, 1, "old-password", true)
+	mock.ExpectBegin()
+	expectUsernameAndEmail(mock, 1)
+	mock.ExpectExec("UPDATE users SET password = \\$2 WHERE id = \\$1").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE password_reset_tokens\\s+SET used_at = NOW\\(\\)\\s+WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE user_id = \\$1 AND revoked_at IS NULL AND id::text <> \\$2").
+		WithArgs(1, testSessionID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, models.UserAuditEventTypePasswordChanged, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, credentialsRequest(t, "/user/password", `{"current_password":"old-password","new_password":"`+testStrongPassword+`"}`))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestChangePasswordRejectsWrongCurrentPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectCurrentPasswordCheck(t, mock, 1, "old-password", false)
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, credentialsRequest(t, "/user/password", `{"current_password":"guess","new_password":"new-password"}`))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestChangePasswordThrottledAfterRepeatedWrongPasswords(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	mock.ExpectQuery("SELECT MAX\\(locked_until\\)\\s+FROM login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1", repositories.LoginAttemptScopeIP, testClientIP).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(time.Now().Add(30 * time.Second)))
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, credentialsRequest(t, "/user/password", `{"current_password":"guess","new_password":"new-password"}`))
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a Retry-After header")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestChangePasswordRejectsBreachedPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	digest := sha1.Sum([]byte(testStrongPassword))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	contents := "# sample\n" + strings.ToUpper(hex.EncodeToString(digest[:])) + ":42\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("error writing breached hashes: %v", err)
+	}
+	breached, err := services.LoadBreachedPasswordHashes(path)
+	if err != nil {
+		t.Fatalf("error loading breached hashes: %v", err)
+	}
+	policy := services.DefaultPasswordPolicy()
+	policy.Breached = breached
+	if err := services.ConfigurePasswordPolicy(policy); err != nil {
+		t.Fatalf("error configuring password policy: %v", err)
+	}
+	t.Cleanup(func() { services.ConfigurePasswordPolicy(services.DefaultPasswordPolicy()) })
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectCurrentPasswordCheck(t, mock, 1, "old-password", true)
+	mock.ExpectBegin()
+	expectUsernameAndEmail(mock, 1)
+	mock.ExpectRollback()
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, credentialsRequest(t, "/user/password", `{"current_password":"old-password","new_password":"`+testStrongPassword+`"}`))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp utils.ValidationErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if len(resp.Fields) != 1 || resp.Fields[0].Field != "new_password" || resp.Fields[0].Code != "breached" {
+		t.Fatalf("expected a breached new_password error, got %+v", resp.Fields)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestChangeEmailKeepsAddressPendingUntilConfirmed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectEmailVerified(mock, 1)
+	expectCurrentPasswordCheck(t, mock, 1, "secret", true)
+	mock.ExpectQuery("SELECT id FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("jane@example.com").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET pending_email = \\$2 WHERE id = \\$1").
+		WithArgs(1, "jane@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE email_verification_tokens\\s+SET used_at = NOW\\(\\)\\s+WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO email_verification_tokens").
+		WithArgs(1, "jane@example.com", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE user_id = \\$1 AND revoked_at IS NULL AND id::text <> \\$2").
+		WithArgs(1, testSessionID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, models.UserAuditEventTypeEmailChangeRequested, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	mailer := services.NewMemoryMailer()
+	router := setupRouterWithMailer(db, mailer)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, credentialsRequest(t, "/user/email", `{"current_password":"secret","email":"jane@example.com"}`))
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202 got %d: %s", w.Code, w.Body.String())
+	}
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "jane@example.com" || !strings.Contains(messages[0].Body, "/verify-email?token=") {
+		t.Fatalf("expected a confirmation link sent to the new address, got %+v", messages)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestChangeEmailRejectsAddressInUse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectEmailVerified(mock, 1)
+	expectCurrentPasswordCheck(t, mock, 1, "secret", true)
+	mock.ExpectQuery("SELECT id FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("jane@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, credentialsRequest(t, "/user/email", `{"current_password":"secret","email":"jane@example.com"}`))
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestVerifyEmailConfirmsPendingChangeAndNotifiesOldAddress(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE email_verification_tokens\\s+SET used_at = NOW\\(\\)\\s+WHERE token_hash = \\$1").
+		WithArgs(utils.HashToken("confirm-change")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).AddRow(1, "jane@example.com"))
+	mock.ExpectExec("UPDATE users\\s+SET email_verified = true").
+		WithArgs(1, "jane@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("UPDATE users u\\s+SET email = u.pending_email").
+		WithArgs(1, "jane@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("john@example.com"))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, models.UserAuditEventTypeEmailChanged, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	mailer := services.NewMemoryMailer()
+	router := setupRouterWithMailer(db, mailer)
+
+	req := httptest.NewRequest(http.MethodPost, "/verify-email", bytes.NewReader([]byte(`{"token":"confirm-change"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	messages := mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "john@example.com" || !strings.Contains(messages[0].Body, "jane@example.com") {
+		t.Fatalf("expected the old address to be notified, got %+v", messages)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail godoc
+// @Summary      Verify an email address
+// @Description  Consume the token from a verification email and mark the address as verified. Tokens are single use and expire. For a pending email change the new address replaces the old one, which is notified.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      verifyEmailRequest  true  "Verification token"
+// @Success      200      {object}  utils.MessageResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /verify-email [post]
+func VerifyEmail(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "VerifyEmail bind error", "Invalid input")
+		return
+	}
+
+	if err := userService.VerifyEmail(ctx.Request.Context(), req.Token); err != nil {
+		if errors.Is(err, repositories.ErrVerificationTokenInvalid) {
+			utils.RespondError(ctx, http.StatusBadRequest, err, "VerifyEmail invalid token", "Invalid or expired verification token")
+			return
+		}
+		if errors.Is(err, repositories.ErrEmailInUse) {
+			utils.RespondError(ctx, http.StatusConflict, err, "VerifyEmail address taken", "Email address is already in use")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "VerifyEmail service error", "Email verification failed")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail godoc
+// @Summary      Resend the verification email
+// @Description  Send a new verification link to the authenticated user's address. Earlier links stop working.
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {object}  utils.MessageResponse
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      409  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /user/verify-email/resend [post]
+// @Security     BearerAuth
+func ResendVerificationEmail(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	userID := ctx.GetInt("userID")
+	if userID == 0 {
+		utils.RespondError(ctx, http.StatusUnauthorized, nil, "ResendVerificationEmail missing user id", "Unauthorized")
+		return
+	}
+
+	if err := userService.ResendVerificationEmail(ctx.Request.Context(), userID); err != nil {
+		if errors.Is(err, services.ErrEmailAlreadyVerified) {
+			utils.RespondError(ctx, http.StatusConflict, err, "ResendVerificationEmail already verified", "Email already verified")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ResendVerificationEmail service error", "Could not send verification email")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Verification email sent"})
+}
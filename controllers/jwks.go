@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// GetJWKS godoc
+// @Summary      Publish the access token verification keys
+// @Description  Returns the public RS256 and EdDSA keys used to sign access tokens so sibling services can verify them without the signing secret.
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {object}  utils.JSONWebKeySet
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /.well-known/jwks.json [get]
+func GetJWKS(ctx *gin.Context) {
+	jwks, err := utils.PublicJWKS()
+	if err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "GetJWKS key configuration error", "Failed to load signing keys")
+		return
+	}
+
+	// Keys change rarely; a short cache keeps verifiers from hammering the endpoint while still
+	// picking up a rotated key well within the access token lifetime.
+	ctx.Header("Cache-Control", "public, max-age=300")
+	utils.RespondSuccess(ctx, http.StatusOK, jwks)
+}
@@ -2,14 +2,16 @@ package controllers
 
 import (
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/icpinto/dating-app/models"
 	"github.com/icpinto/dating-app/repositories"
 	"github.com/icpinto/dating-app/services"
 	"github.com/icpinto/dating-app/utils"
-	"golang.org/x/crypto/bcrypt"
 )
 
 /*
@@ -25,7 +27,7 @@ func init() {
 
 // Register godoc
 // @Summary      Register a new user
-// @Description  Create a new user account with a username, email, and password.
+// @Description  Create a new user account with a username, email, and password. Usernames may not contain @ so they never clash with email addresses at login. The account starts unverified and a verification link is emailed to the address.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
@@ -33,6 +35,7 @@ func init() {
 // @Success      200   {object}  utils.MessageResponse
 // @Failure      400   {object}  utils.ErrorResponse
 // @Failure      409   {object}  utils.ErrorResponse
+// @Failure      422   {object}  utils.ValidationErrorResponse
 // @Failure      500   {object}  utils.ErrorResponse
 // @Router       /register [post]
 func Register(ctx *gin.Context) {
@@ -44,7 +47,16 @@ func Register(ctx *gin.Context) {
 		return
 	}
 
-	if err := userService.RegisterUser(user); err != nil {
+	if err := userService.RegisterUser(ctx.Request.Context(), user); err != nil {
+		var invalid *utils.ValidationError
+		if errors.As(err, &invalid) {
+			utils.RespondValidationError(ctx, invalid, "Register validation error")
+			return
+		}
+		if errors.Is(err, services.ErrInvalidEmail) {
+			utils.RespondError(ctx, http.StatusBadRequest, err, "Register invalid email", "Invalid email address")
+			return
+		}
 		if errors.Is(err, repositories.ErrDuplicateUser) {
 			logMsg := "Register duplicate user"
 			utils.RespondError(ctx, http.StatusConflict, err, logMsg, "user already exists")
@@ -58,72 +70,155 @@ func Register(ctx *gin.Context) {
 	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "User registered successfully"})
 }
 
+type loginRequest struct {
+	// Identifier is a username or an email address.
+	Identifier string `json:"identifier"`
+	// Username is accepted in place of Identifier for older clients.
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 // Login godoc
 // @Summary      Authenticate a user
-// @Description  Validate credentials and return a JWT access token.
+// @Description  Validate credentials, start a session and return a short-lived access token with a refresh token. The identifier may be the username or the email address, which is matched ignoring case; older clients may still send it as username. Repeated failures for an identifier or client IP are answered with 429 and a Retry-After header. When two-factor authentication is on, a utils.TwoFactorChallengeResponse with a challenge token to complete at /login/2fa is returned instead.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
-// @Param        credentials  body      models.User        true  "User login credentials"
+// @Param        credentials  body      loginRequest       true  "User login credentials"
 // @Success      200          {object}  utils.TokenResponse
 // @Failure      400          {object}  utils.ErrorResponse
 // @Failure      401          {object}  utils.ErrorResponse
-// @Failure      404          {object}  utils.ErrorResponse
+// @Failure      429          {object}  utils.ErrorResponse
 // @Failure      500          {object}  utils.ErrorResponse
 // @Router       /login [post]
 func Login(ctx *gin.Context) {
 	userService := ctx.MustGet("userService").(*services.UserService)
 
-	var user models.User
-	var hashedPassword string
-	var userId int
-
-	if err := ctx.BindJSON(&user); err != nil {
+	var req loginRequest
+	if err := ctx.BindJSON(&req); err != nil {
 		utils.RespondError(ctx, http.StatusBadRequest, err, "Login bind error", "Invalid input")
 		return
 	}
+	identifier := strings.TrimSpace(req.Identifier)
+	if identifier == "" {
+		identifier = req.Username
+	}
 
-	hashedPassword, userId, err := userService.GetUsepwd(user.Username)
-
+	userId, err := userService.CheckCredentials(identifier, req.Password, ctx.ClientIP())
 	if err != nil {
-		if errors.Is(err, repositories.ErrUserNotFound) {
-			utils.RespondError(ctx, http.StatusNotFound, err, "Login user not found", "user not found")
+		var throttled *services.LoginThrottledError
+		if errors.As(err, &throttled) {
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			utils.RespondError(ctx, http.StatusTooManyRequests, err, "Login throttled", "Too many failed login attempts, try again later")
 			return
 		}
-		utils.RespondError(ctx, http.StatusUnauthorized, err, "Login service error", "Invalid credentials")
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			utils.RespondError(ctx, http.StatusUnauthorized, err, "Login invalid credentials", "Invalid credentials")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "Login service error", "Login failed")
 		return
 	}
 
-	// Compare hashed password with user input
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(user.Password))
+	startSession(ctx, "Login", userId)
+}
+
+// startSession answers a successful first login step. Accounts with two-factor authentication get a
+// challenge token to complete at /login/2fa; all others get a new session right away.
+func startSession(ctx *gin.Context, handler string, userID int) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+	twoFactorService := ctx.MustGet("twoFactorService").(*services.TwoFactorService)
+
+	twoFactorEnabled, err := twoFactorService.IsEnabled(userID)
 	if err != nil {
-		utils.RespondError(ctx, http.StatusUnauthorized, err, "Login password mismatch", "Invalid credentials")
+		utils.RespondError(ctx, http.StatusInternalServerError, err, handler+" two-factor lookup error", "Login failed")
+		return
+	}
+	if twoFactorEnabled {
+		challengeToken, err := utils.GenerateChallengeToken(userID)
+		if err != nil {
+			utils.RespondError(ctx, http.StatusInternalServerError, err, handler+" challenge token error", "Token generation failed")
+			return
+		}
+		utils.RespondSuccess(ctx, http.StatusOK, utils.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+			ExpiresIn:         int64(utils.ChallengeTokenTTL.Seconds()),
+		})
 		return
 	}
 
-	// Generate JWT token using user ID
-	token, err := utils.GenerateToken(userId)
+	tokens, err := userService.CreateSession(userID, ctx.Request.UserAgent(), ctx.ClientIP())
 	if err != nil {
-		utils.RespondError(ctx, http.StatusInternalServerError, err, "Login token generation error", "Token generation failed")
+		utils.RespondError(ctx, http.StatusInternalServerError, err, handler+" session creation error", "Token generation failed")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.NewTokenResponse(tokens))
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshToken godoc
+// @Summary      Refresh an access token
+// @Description  Exchange a refresh token for a new access token. The refresh token is rotated and the previous one stops working.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      refreshTokenRequest  true  "Refresh token"
+// @Success      200      {object}  utils.TokenResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /refresh [post]
+func RefreshToken(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	var req refreshTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "RefreshToken bind error", "Invalid input")
 		return
 	}
 
-	// Return the token in the response
-	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"token": token, "user_id": userId})
+	tokens, err := userService.RefreshSession(req.RefreshToken, ctx.ClientIP())
+	if err != nil {
+		if errors.Is(err, repositories.ErrSessionNotFound) {
+			utils.RespondError(ctx, http.StatusUnauthorized, err, "RefreshToken invalid session", "Invalid refresh token")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "RefreshToken service error", "Token refresh failed")
+		return
+	}
 
+	utils.RespondSuccess(ctx, http.StatusOK, utils.NewTokenResponse(tokens))
 }
 
 // SignOut godoc
 // @Summary      Sign out a user
-// @Description  Invalidate client-side session by acknowledging the logout request.
+// @Description  Revoke the session behind the presented access token. Its refresh token stops working immediately and the access token is rejected on the next request.
 // @Tags         Auth
 // @Produce      json
 // @Success      200  {object}  utils.MessageResponse
 // @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
 // @Router       /signout [post]
 // @Security     BearerAuth
 func SignOut(ctx *gin.Context) {
-	// Authentication middleware already validates the JWT. Since tokens are stateless,
-	// the client only needs acknowledgement to remove the token locally.
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	userID := ctx.GetInt("userID")
+	sessionID := ctx.GetString("sessionID")
+	if userID == 0 || sessionID == "" {
+		utils.RespondError(ctx, http.StatusUnauthorized, nil, "SignOut missing session", "Unauthorized")
+		return
+	}
+
+	if err := userService.RevokeSession(userID, sessionID); err != nil && !errors.Is(err, repositories.ErrSessionNotFound) {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "SignOut service error", "Sign out failed")
+		return
+	}
+
 	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Signed out successfully"})
 }
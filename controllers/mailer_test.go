@@ -0,0 +1,116 @@
+package controllers_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icpinto/dating-app/services"
+)
+
+// smtpStandIn accepts SMTP connections on a local port. Each connection is handed to serve.
+func smtpStandIn(t *testing.T, serve func(net.Conn)) (host, port string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	host, port, _ = net.SplitHostPort(listener.Addr().String())
+	return host, port
+}
+
+func TestSMTPMailerDeliversMessage(t *testing.T) {
+	received := make(chan string, 1)
+	host, port := smtpStandIn(t, func(conn net.Conn) {
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 relay ready\r\n")
+		var data strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"):
+				fmt.Fprint(conn, "250 relay\r\n")
+			case strings.HasPrefix(command, "DATA"):
+				fmt.Fprint(conn, "354 go ahead\r\n")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				fmt.Fprint(conn, "250 queued\r\n")
+			case command == "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	})
+
+	mailer := services.NewSMTPMailer(host, port, "", "", "noreply@example.com")
+	err := mailer.Send(context.Background(), services.MailMessage{To: "john@example.com", Subject: "Hello", Body: "Hi John"})
+	if err != nil {
+		t.Fatalf("expected the message to be delivered, got %v", err)
+	}
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "Subject: Hello") || !strings.Contains(data, "Hi John") {
+			t.Fatalf("unexpected message: %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the relay did not receive the message")
+	}
+}
+
+func TestSMTPMailerGivesUpOnStalledRelay(t *testing.T) {
+	closed := make(chan struct{})
+	// The relay never greets the client.
+	host, port := smtpStandIn(t, func(conn net.Conn) {
+		defer conn.Close()
+		_, _ = io.Copy(io.Discard, conn)
+		close(closed)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	mailer := services.NewSMTPMailer(host, port, "", "", "noreply@example.com")
+	started := time.Now()
+	err := mailer.Send(ctx, services.MailMessage{To: "john@example.com", Subject: "Hello", Body: "Hi John"})
+	if err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("expected the send to stop at the deadline, took %s", elapsed)
+	}
+	// The connection is closed rather than left behind with the relay.
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the connection to the relay to be closed")
+	}
+}
@@ -13,7 +13,7 @@ import (
 
 // GetUserMatches godoc
 // @Summary      Retrieve the best matches for a user
-// @Description  Combines compatibility scores from the matching service with profile details.
+// @Description  Combines compatibility scores from the matching service with profile details. Image URLs are signed and expire after MEDIA_URL_TTL, and private fields are blanked unless their owner shares them with the caller.
 // @Tags         Matches
 // @Produce      json
 // @Param        user_id  path      int     true  "User ID"
@@ -48,7 +48,7 @@ func GetUserMatches(ctx *gin.Context) {
 		ids = append(ids, m.UserID)
 	}
 
-	profilesByID, err := profileService.GetProfilesByUserIDs(ids)
+	profilesByID, err := profileService.GetProfilesByUserIDs(ctx.GetInt("userID"), ids)
 	if err != nil {
 		logMsg := fmt.Sprintf("GetUserMatches profile lookup error for user %d", userID)
 		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to retrieve matches")
@@ -61,6 +61,7 @@ func GetUserMatches(ctx *gin.Context) {
 		if !ok {
 			continue
 		}
+		signProfileMedia(ctx, &profile.Profile)
 		matchedProfiles = append(matchedProfiles, models.MatchedProfile{
 			UserProfile: profile,
 			Score:       m.Score,
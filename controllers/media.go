@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/middlewares"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// storedImage holds the storage keys of the sizes stored for an upload. Keys rather than URLs are
+// saved with photos and profiles; responses turn them into signed URLs with signedMediaURL.
+type storedImage struct {
+	Key       string
+	MediumKey string
+	ThumbKey  string
+}
+
+// storeUploadedImage runs an upload through the image pipeline and stores every generated size.
+// Rejected uploads are reported by imageUploadError.
+func storeUploadedImage(ctx *gin.Context, mediaStorage services.MediaStorage, file *multipart.FileHeader) (storedImage, error) {
+	src, err := file.Open()
+	if err != nil {
+		return storedImage{}, err
+	}
+	defer src.Close()
+
+	processed, err := utils.ProcessImage(src)
+	if err != nil {
+		return storedImage{}, err
+	}
+	for _, variant := range processed.Variants {
+		if err := mediaStorage.Put(ctx.Request.Context(), variant.FileName, variant.Data, utils.ImageContentType); err != nil {
+			return storedImage{}, err
+		}
+	}
+	return storedImage{
+		Key:       processed.Variant(utils.ImageVariantFull).FileName,
+		MediumKey: processed.Variant(utils.ImageVariantMedium).FileName,
+		ThumbKey:  processed.Variant(utils.ImageVariantThumb).FileName,
+	}, nil
+}
+
+// signedMediaURL turns a storage key into a URL that expires after MEDIA_URL_TTL. Without
+// MEDIA_BASE_URL the URL points at the host the request was sent to.
+func signedMediaURL(ctx *gin.Context, key string) string {
+	scheme := "http"
+	if ctx.Request.TLS != nil {
+		scheme = "https"
+	}
+	return utils.SignedMediaURL(scheme+"://"+ctx.Request.Host, key, time.Now())
+}
+
+// signProfileMedia replaces the stored image keys of a profile with signed URLs.
+func signProfileMedia(ctx *gin.Context, profile *models.Profile) {
+	profile.ProfileImageURL = signedMediaURL(ctx, profile.ProfileImageURL)
+	profile.ProfileImageThumbURL = signedMediaURL(ctx, profile.ProfileImageThumbURL)
+}
+
+// signPhotoMedia replaces the stored image keys of a photo with signed URLs.
+func signPhotoMedia(ctx *gin.Context, photo *models.ProfilePhoto) {
+	photo.URL = signedMediaURL(ctx, photo.URL)
+	photo.MediumURL = signedMediaURL(ctx, photo.MediumURL)
+	photo.ThumbURL = signedMediaURL(ctx, photo.ThumbURL)
+}
+
+// signPhotoList signs the image keys of every photo in place.
+func signPhotoList(ctx *gin.Context, photos []models.ProfilePhoto) {
+	for i := range photos {
+		signPhotoMedia(ctx, &photos[i])
+	}
+}
+
+// imageUploadError describes why the image pipeline rejected the upload in field, or returns nil
+// for errors that are not the client's fault.
+func imageUploadError(field string, err error) *utils.ValidationError {
+	var invalid utils.ValidationError
+	switch {
+	case errors.Is(err, utils.ErrImageTooLarge):
+		invalid.Add(field, "too_large", "Image is too large")
+	case errors.Is(err, utils.ErrUnsupportedImageType):
+		invalid.Add(field, "unsupported_type", "Image must be a JPEG, PNG or WebP file")
+	case errors.Is(err, utils.ErrImageDimensions):
+		invalid.Add(field, "invalid_dimensions", "Image width and height are out of range")
+	case errors.Is(err, utils.ErrInvalidImage):
+		invalid.Add(field, "invalid_image", "Image could not be read")
+	default:
+		return nil
+	}
+	return &invalid
+}
+
+// discardStoredImage deletes the stored sizes of an image unless a photo or profile still uses
+// them. Failures are only logged since the database no longer refers to the objects.
+func discardStoredImage(ctx *gin.Context, mediaStorage services.MediaStorage, profileService *services.ProfileService, image storedImage) {
+	referenced, err := profileService.IsProfileImageReferenced(image.Key)
+	if err != nil || referenced {
+		return
+	}
+	removed := map[string]bool{}
+	for _, key := range []string{image.Key, image.MediumKey, image.ThumbKey} {
+		if key == "" || removed[key] {
+			continue
+		}
+		removed[key] = true
+		if err := mediaStorage.Delete(ctx.Request.Context(), key); err != nil {
+			log.Printf("discardStoredImage error for %s: %v", key, err)
+		}
+	}
+}
+
+// ServeMedia godoc
+// @Summary      Download uploaded media
+// @Description  Streams an uploaded image from the configured media storage. Access needs either the expires and signature parameters of a signed URL handed out by the profile, photo and match endpoints, or an access token of the owner, of a user connected to the owner through an accepted friend request, or of an admin or moderator. Media of deactivated accounts is only served to its owner, and media only used in rejected photos only to its owner, admins and moderators.
+// @Tags         Media
+// @Produce      image/jpeg
+// @Param        key        path   string  true   "Media key"
+// @Param        expires    query  int     false  "Expiry of a signed URL, in Unix seconds"
+// @Param        signature  query  string  false  "Signature of a signed URL"
+// @Success      200
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      403  {object}  utils.ErrorResponse
+// @Failure      404  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /uploads/{key} [get]
+func ServeMedia(ctx *gin.Context) {
+	mediaStorage := ctx.MustGet("mediaStorage").(services.MediaStorage)
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+
+	key := strings.TrimPrefix(ctx.Param("key"), "/")
+	now := time.Now()
+
+	viewerID, signed := 0, false
+	cacheControl := "private, no-cache"
+	if signature := ctx.Query("signature"); signature != "" {
+		expires := ctx.Query("expires")
+		if !utils.VerifyMediaSignature(key, expires, signature, now) {
+			utils.RespondError(ctx, http.StatusForbidden, nil, "ServeMedia invalid signature", "Link expired or invalid")
+			return
+		}
+		signed = true
+		// The URL stops working at expires, so caches may keep the response until then.
+		expiresAt, _ := strconv.ParseInt(expires, 10, 64)
+		cacheControl = fmt.Sprintf("private, max-age=%d", max(expiresAt-now.Unix(), 0))
+	} else {
+		tokenString := ctx.GetHeader("Authorization")
+		if tokenString == "" {
+			utils.RespondError(ctx, http.StatusUnauthorized, nil, "ServeMedia unauthenticated", "Missing Authorization header or signature")
+			return
+		}
+		claims, err := middlewares.ValidateAccessToken(ctx, tokenString)
+		if errors.Is(err, utils.ErrInvalidToken) {
+			utils.RespondError(ctx, http.StatusUnauthorized, err, "ServeMedia invalid token", "Invalid token")
+			return
+		}
+		if errors.Is(err, repositories.ErrSessionNotFound) {
+			utils.RespondError(ctx, http.StatusUnauthorized, err, "ServeMedia session ended", "Session expired or revoked")
+			return
+		}
+		if err != nil {
+			utils.RespondError(ctx, http.StatusInternalServerError, err, "ServeMedia session error", "Could not verify session")
+			return
+		}
+		viewerID = claims.UserID
+	}
+
+	if err := profileService.AuthorizeMediaAccess(viewerID, key, signed); err != nil {
+		logMsg := fmt.Sprintf("ServeMedia access error for %s", key)
+		switch {
+		case errors.Is(err, services.ErrMediaNotFound):
+			utils.RespondError(ctx, http.StatusNotFound, err, logMsg, "Not found")
+		case errors.Is(err, services.ErrMediaForbidden):
+			utils.RespondError(ctx, http.StatusForbidden, err, logMsg, "Forbidden")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to load media")
+		}
+		return
+	}
+
+	body, object, err := mediaStorage.Get(ctx.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, services.ErrMediaNotFound) || errors.Is(err, services.ErrInvalidMediaKey) {
+			utils.RespondError(ctx, http.StatusNotFound, err, "ServeMedia not found", "Not found")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ServeMedia storage error", "Failed to load media")
+		return
+	}
+	defer body.Close()
+
+	ctx.DataFromReader(http.StatusOK, object.Size, object.ContentType, body, map[string]string{
+		"Cache-Control":          cacheControl,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+type rejectModerationItemRequest struct {
+	Reason string `json:"reason"`
+}
+
+// signModerationItems replaces the stored photo keys of moderation items with signed URLs.
+func signModerationItems(ctx *gin.Context, items []models.ModerationItem) {
+	for i := range items {
+		items[i].PhotoURL = signedMediaURL(ctx, items[i].PhotoURL)
+	}
+}
+
+// ListMyModerationItems godoc
+// @Summary      List the moderation status of the authenticated user's content
+// @Description  Returns the user's recent photo and bio reviews, newest first. Pending items wait for a moderator; rejected items carry the moderator's reason and are hidden from other users.
+// @Tags         Profiles
+// @Produce      json
+// @Success      200  {object}  utils.ModerationItemsResponse
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/moderation [get]
+func ListMyModerationItems(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	items, err := profileService.ListModerationItemsForUser(userID)
+	if err != nil {
+		logMsg := fmt.Sprintf("ListMyModerationItems service error for user %d", userID)
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to retrieve moderation status")
+		return
+	}
+
+	signModerationItems(ctx, items)
+	utils.RespondSuccess(ctx, http.StatusOK, utils.ModerationItemsResponse{Items: items})
+}
+
+// ListModerationQueue godoc
+// @Summary      List the moderation queue
+// @Description  Returns photos and bios waiting for review, oldest first. Decided items can be listed with the status filter.
+// @Tags         Admin
+// @Produce      json
+// @Param        status  query     string  false  "Item status, pending by default"  Enums(pending, approved, rejected)
+// @Param        kind    query     string  false  "Item kind"  Enums(photo, bio)
+// @Param        limit   query     int     false  "Page size, 50 by default and at most 200"
+// @Param        offset  query     int     false  "Number of items to skip"
+// @Success      200     {object}  utils.ModerationItemsResponse
+// @Failure      401     {object}  utils.ErrorResponse
+// @Failure      403     {object}  utils.ErrorResponse
+// @Failure      422     {object}  utils.ValidationErrorResponse
+// @Failure      500     {object}  utils.ErrorResponse
+// @Router       /admin/moderation [get]
+// @Security     BearerAuth
+func ListModerationQueue(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+
+	var invalid utils.ValidationError
+	filters := models.ModerationFilters{
+		Status: ctx.Query("status"),
+		Kind:   ctx.Query("kind"),
+		Limit:  queryInt(ctx, &invalid, "limit"),
+		Offset: queryInt(ctx, &invalid, "offset"),
+	}
+	if len(invalid.Fields) > 0 {
+		utils.RespondValidationError(ctx, &invalid, "ListModerationQueue invalid query")
+		return
+	}
+
+	items, err := profileService.ListModerationQueue(filters)
+	if err != nil {
+		var validationErr *utils.ValidationError
+		if errors.As(err, &validationErr) {
+			utils.RespondValidationError(ctx, validationErr, "ListModerationQueue invalid query")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ListModerationQueue service error", "Failed to retrieve moderation queue")
+		return
+	}
+
+	signModerationItems(ctx, items)
+	utils.RespondSuccess(ctx, http.StatusOK, utils.ModerationItemsResponse{Items: items})
+}
+
+// ApproveModerationItem godoc
+// @Summary      Approve a photo or bio
+// @Description  Accepts pending content.
+// @Tags         Admin
+// @Produce      json
+// @Param        item_id  path      int  true  "Moderation item ID"
+// @Success      200      {object}  models.ModerationItem
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      403      {object}  utils.ErrorResponse
+// @Failure      404      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /admin/moderation/{item_id}/approve [post]
+// @Security     BearerAuth
+func ApproveModerationItem(ctx *gin.Context) {
+	decideModerationItem(ctx, "ApproveModerationItem", func(profileService *services.ProfileService, itemID int) (models.ModerationItem, error) {
+		return profileService.ApproveModerationItem(ctx.Request.Context(), ctx.GetInt("userID"), itemID)
+	})
+}
+
+// RejectModerationItem godoc
+// @Summary      Reject a photo or bio
+// @Description  Refuses pending content with a reason the user can read. Rejected photos and bios are hidden from other users, and a rejected primary photo is replaced by the next photo that was not rejected.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        item_id  path      int                          true  "Moderation item ID"
+// @Param        request  body      rejectModerationItemRequest  true  "Reason of at most 500 characters"
+// @Success      200      {object}  models.ModerationItem
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      403      {object}  utils.ErrorResponse
+// @Failure      404      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      422      {object}  utils.ValidationErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /admin/moderation/{item_id}/reject [post]
+// @Security     BearerAuth
+func RejectModerationItem(ctx *gin.Context) {
+	var req rejectModerationItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "RejectModerationItem bind error", "Invalid input")
+		return
+	}
+	decideModerationItem(ctx, "RejectModerationItem", func(profileService *services.ProfileService, itemID int) (models.ModerationItem, error) {
+		return profileService.RejectModerationItem(ctx.Request.Context(), ctx.GetInt("userID"), itemID, req.Reason)
+	})
+}
+
+func decideModerationItem(ctx *gin.Context, handler string, decide func(*services.ProfileService, int) (models.ModerationItem, error)) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+
+	itemID, err := strconv.Atoi(ctx.Param("item_id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusNotFound, err, handler+" invalid id", "Moderation item not found")
+		return
+	}
+
+	item, err := decide(profileService, itemID)
+	if err != nil {
+		logMsg := fmt.Sprintf("%s service error for item %d", handler, itemID)
+		var validationErr *utils.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			utils.RespondValidationError(ctx, validationErr, logMsg)
+		case errors.Is(err, repositories.ErrModerationItemNotFound):
+			utils.RespondError(ctx, http.StatusNotFound, err, logMsg, "Moderation item not found")
+		case errors.Is(err, services.ErrModerationItemDecided):
+			utils.RespondError(ctx, http.StatusConflict, err, logMsg, "Moderation item was already decided")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to record the decision")
+		}
+		return
+	}
+
+	item.PhotoURL = signedMediaURL(ctx, item.PhotoURL)
+	utils.RespondSuccess(ctx, http.StatusOK, item)
+}
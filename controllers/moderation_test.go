@@ -0,0 +1,349 @@
+package controllers_test
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/controllers"
+	"github.com/icpinto/dating-app/middlewares"
+	"github.com/icpinto/dating-app/services"
+)
+
+var moderationItemColumns = []string{"id", "user_id", "username", "kind", "photo_id", "url", "content", "status", "reason",
+	"reviewed_by", "reviewed_at", "created_at"}
+
+// setupModerationRouter serves the moderation endpoints as moderator 9. Role checks are covered by
+// the admin role tests.
+func setupModerationRouter(db *sql.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.ServiceMiddleware(middlewares.Services{
+		ProfileService: services.NewProfileService(db),
+		MatchService:   services.NewMatchService(""),
+	}))
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", 9)
+		c.Next()
+	})
+	r.GET("/admin/moderation", controllers.ListModerationQueue)
+	r.POST("/admin/moderation/:item_id/approve", controllers.ApproveModerationItem)
+	r.POST("/admin/moderation/:item_id/reject", controllers.RejectModerationItem)
+	r.GET("/profile/moderation", controllers.ListMyModerationItems)
+	return r
+}
+
+func expectModerationItemLock(mock sqlmock.Sqlmock, itemID int, values ...driver.Value) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT m.id, m.user_id, u.username, m.kind(.|\\n)*FOR UPDATE OF m").
+		WithArgs(itemID).
+		WillReturnRows(sqlmock.NewRows(moderationItemColumns).AddRow(values...))
+}
+
+func expectModerationDecision(mock sqlmock.Sqlmock, itemID int, status, reason string) {
+	mock.ExpectQuery("UPDATE moderation_items\\s+SET status = \\$2, reason = \\$3, reviewed_by = \\$4").
+		WithArgs(itemID, status, reason, 9).
+		WillReturnRows(sqlmock.NewRows([]string{"reviewed_at"}).AddRow(time.Now()))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, "content_"+status, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func moderationRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestRejectPrimaryPhotoPromotesNextVisiblePhoto(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	expectModerationItemLock(mock, 5, 5, 1, "john", "photo", 3, "a.jpg", "", "pending", "", nil, nil, now)
+	mock.ExpectQuery("SELECT id FROM users WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT id, user_id, url, medium_url, thumb_url, caption, position, is_primary, created_at, moderation_status FROM profile_photos").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(profilePhotoColumns).
+			AddRow(3, 1, "a.jpg", "a_medium.jpg", "a_thumb.jpg", "", 0, true, now, "pending").
+			AddRow(4, 1, "b.jpg", "b_medium.jpg", "b_thumb.jpg", "", 1, false, now, "rejected").
+			AddRow(6, 1, "c.jpg", "c_medium.jpg", "c_thumb.jpg", "", 2, false, now, "approved"))
+	mock.ExpectExec("UPDATE profile_photos SET moderation_status").
+		WithArgs(1, 3, "rejected").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE profile_photos SET is_primary = FALSE WHERE user_id = \\$1 AND is_primary$").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE profile_photos SET is_primary = FALSE").
+		WithArgs(1, 6).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE profile_photos SET is_primary = TRUE").
+		WithArgs(1, 6).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE profiles").
+		WithArgs(1, "c.jpg", "c_thumb.jpg").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectModerationDecision(mock, 5, "rejected", "Not a photo of a person")
+	expectCompletenessRefresh(mock, 1, mockProfileRowsWith(map[string]driver.Value{"completeness": 13}),
+		sqlmock.NewRows(profilePhotoColumns).
+			AddRow(3, 1, "a.jpg", "a_medium.jpg", "a_thumb.jpg", "", 0, false, now, "rejected").
+			AddRow(4, 1, "b.jpg", "b_medium.jpg", "b_thumb.jpg", "", 1, false, now, "rejected").
+			AddRow(6, 1, "c.jpg", "c_medium.jpg", "c_thumb.jpg", "", 2, true, now, "approved"), 7)
+	mock.ExpectExec("INSERT INTO profile_sync_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	router := setupModerationRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, moderationRequest(http.MethodPost, "/admin/moderation/5/reject", `{"reason":"  Not a photo of a person "}`))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var item map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &item); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if item["status"] != "rejected" || item["reason"] != "Not a photo of a person" || item["reviewed_by"] != float64(9) {
+		t.Fatalf("expected the rejection to be recorded, got %v", item)
+	}
+	if photoURL, _ := item["photo_url"].(string); !strings.Contains(photoURL, "/uploads/a.jpg?expires=") {
+		t.Fatalf("expected a signed photo URL, got %q", photoURL)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestApproveBioMarksProfileClean(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectModerationItemLock(mock, 8, 8, 1, "john", "bio", nil, "", "Hello there", "pending", "", nil, nil, time.Now())
+	mock.ExpectExec("UPDATE profiles SET moderation_status = \\$3").
+		WithArgs(1, "Hello there", "clean").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectModerationDecision(mock, 8, "approved", "")
+	mock.ExpectExec("INSERT INTO profile_sync_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	router := setupModerationRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, moderationRequest(http.MethodPost, "/admin/moderation/8/approve", ""))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestDecideModerationItemErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		locked bool
+		status string
+		want   int
+	}{
+		{name: "reject without reason", target: "/admin/moderation/5/reject", body: `{"reason":" "}`, want: http.StatusUnprocessableEntity},
+		{name: "already decided", target: "/admin/moderation/5/approve", locked: true, status: "approved", want: http.StatusConflict},
+		{name: "unknown item", target: "/admin/moderation/5/approve", locked: true, want: http.StatusNotFound},
+		{name: "invalid id", target: "/admin/moderation/abc/approve", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+			if tt.locked {
+				rows := sqlmock.NewRows(moderationItemColumns)
+				if tt.status != "" {
+					rows.AddRow(5, 1, "john", "bio", nil, "", "Hello", tt.status, "", 9, time.Now(), time.Now())
+				}
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT m.id, m.user_id").WithArgs(5).WillReturnRows(rows)
+				mock.ExpectRollback()
+			}
+
+			router := setupModerationRouter(db)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, moderationRequest(http.MethodPost, tt.target, tt.body))
+
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.want == http.StatusUnprocessableEntity {
+				assertValidationCodes(t, w.Body.Bytes(), map[string]string{"reason": "required"})
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestListModerationQueue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT m.id, m.user_id(.|\\n)*WHERE m.status = \\$1").
+		WithArgs("pending", "photo", 50, 0).
+		WillReturnRows(sqlmock.NewRows(moderationItemColumns).
+			AddRow(5, 1, "john", "photo", 3, "a.jpg", "", "pending", "", nil, nil, time.Now()))
+
+	router := setupModerationRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/moderation?kind=photo", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(resp.Items) != 1 || resp.Items[0]["photo_id"] != float64(3) || resp.Items[0]["username"] != "john" {
+		t.Fatalf("expected the pending photo, got %v", resp.Items)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/moderation?status=flagged&limit=1000&offset=x", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	assertValidationCodes(t, w.Body.Bytes(), map[string]string{"offset": "invalid_type"})
+}
+
+func TestGetProfilesHidesRejectedBio(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT p.id, p.user_id").
+		WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"bio": "call me on ...", "moderation_status": "rejected"}))
+	expectProfilePrivacy(mock, 0, 1, nil, false)
+
+	router := setupProfileRouter(db, services.NewMatchService(""), false)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profiles", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var profiles []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &profiles); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(profiles) != 1 || profiles[0]["bio"] != "" {
+		t.Fatalf("expected the rejected bio to be hidden, got %v", profiles)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestGetUserProfilePhotosHidesRejectedPhotos(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT id, user_id, url").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(profilePhotoColumns).
+			AddRow(3, 2, "a.jpg", "a_medium.jpg", "a_thumb.jpg", "", 0, true, now, "pending").
+			AddRow(4, 2, "b.jpg", "b_medium.jpg", "b_thumb.jpg", "", 1, false, now, "rejected"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middlewares.ServiceMiddleware(middlewares.Services{ProfileService: services.NewProfileService(db)}))
+	router.GET("/profile/:user_id/photos", controllers.GetUserProfilePhotos)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/2/photos", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Photos []map[string]any `json:"photos"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(resp.Photos) != 1 || resp.Photos[0]["id"] != float64(3) {
+		t.Fatalf("expected only the photo that was not rejected, got %v", resp.Photos)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestListMyModerationItemsShowsRejectionReason(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT m.id, m.user_id(.|\\n)*WHERE m.user_id = \\$1").
+		WithArgs(9, 50).
+		WillReturnRows(sqlmock.NewRows(moderationItemColumns).
+			AddRow(8, 9, "mod", "bio", nil, "", "Hello", "pending", "", nil, nil, now).
+			AddRow(5, 9, "mod", "photo", 3, "a.jpg", "", "rejected", "Blurry", 2, now, now.Add(-time.Hour)))
+
+	router := setupModerationRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/moderation", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(resp.Items) != 2 || resp.Items[0]["status"] != "pending" || resp.Items[1]["reason"] != "Blurry" {
+		t.Fatalf("expected the pending bio and the rejected photo, got %v", resp.Items)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
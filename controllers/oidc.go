@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// StartOIDCLogin godoc
+// @Summary      Start signing in with an OpenID Connect provider
+// @Description  Returns the provider URL to send the browser to. The provider redirects back to the configured redirect URL with a code and state to post to the callback endpoint.
+// @Tags         Auth
+// @Produce      json
+// @Param        provider  path      string  true  "Provider name, for example google"
+// @Success      200       {object}  utils.OIDCAuthorizationResponse
+// @Failure      404       {object}  utils.ErrorResponse
+// @Failure      500       {object}  utils.ErrorResponse
+// @Router       /login/oidc/{provider} [get]
+func StartOIDCLogin(ctx *gin.Context) {
+	oidcService := ctx.MustGet("oidcService").(*services.OIDCService)
+
+	authURL, err := oidcService.AuthorizationURL(ctx.Request.Context(), ctx.Param("provider"), 0)
+	if err != nil {
+		respondOIDCError(ctx, err, "StartOIDCLogin", "Could not start sign-in")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.OIDCAuthorizationResponse{AuthorizationURL: authURL})
+}
+
+// CompleteOIDCLogin godoc
+// @Summary      Complete an OpenID Connect sign-in
+// @Description  Exchange the code and state from the provider redirect. A linked identity signs in as its user and an unknown one creates a passwordless account with a generated username. As with /login, accounts with two-factor authentication get a utils.TwoFactorChallengeResponse. Requests started to link an identity are rejected here; finish them at /user/identities/{provider}/callback.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string               true  "Provider name"
+// @Param        payload   body      oidcCallbackRequest  true  "Code and state from the redirect"
+// @Success      200       {object}  utils.TokenResponse
+// @Failure      400       {object}  utils.ErrorResponse
+// @Failure      401       {object}  utils.ErrorResponse
+// @Failure      403       {object}  utils.ErrorResponse
+// @Failure      404       {object}  utils.ErrorResponse
+// @Failure      409       {object}  utils.ErrorResponse
+// @Failure      500       {object}  utils.ErrorResponse
+// @Router       /login/oidc/{provider}/callback [post]
+func CompleteOIDCLogin(ctx *gin.Context) {
+	oidcService := ctx.MustGet("oidcService").(*services.OIDCService)
+
+	var req oidcCallbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "CompleteOIDCLogin bind error", "Invalid input")
+		return
+	}
+
+	result, err := oidcService.Complete(ctx.Request.Context(), ctx.Param("provider"), req.Code, req.State, 0)
+	if err != nil {
+		respondOIDCError(ctx, err, "CompleteOIDCLogin", "Login failed")
+		return
+	}
+
+	startSession(ctx, "CompleteOIDCLogin", result.UserID)
+}
+
+// LinkIdentity godoc
+// @Summary      Start linking an OpenID Connect account
+// @Description  Returns the provider URL to send the browser to. Posting the redirect to /user/identities/{provider}/callback as the same user links the account, after which it can be used to sign in.
+// @Tags         User
+// @Produce      json
+// @Param        provider  path      string  true  "Provider name"
+// @Success      200       {object}  utils.OIDCAuthorizationResponse
+// @Failure      401       {object}  utils.ErrorResponse
+// @Failure      404       {object}  utils.ErrorResponse
+// @Failure      500       {object}  utils.ErrorResponse
+// @Router       /user/identities/{provider} [post]
+// @Security     BearerAuth
+func LinkIdentity(ctx *gin.Context) {
+	oidcService := ctx.MustGet("oidcService").(*services.OIDCService)
+
+	authURL, err := oidcService.AuthorizationURL(ctx.Request.Context(), ctx.Param("provider"), ctx.GetInt("userID"))
+	if err != nil {
+		respondOIDCError(ctx, err, "LinkIdentity", "Could not start linking")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.OIDCAuthorizationResponse{AuthorizationURL: authURL})
+}
+
+// CompleteIdentityLink godoc
+// @Summary      Complete linking an OpenID Connect account
+// @Description  Exchange the code and state from the provider redirect and link the account to the current user. Only the user who started linking can finish it; no session is created.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string               true  "Provider name"
+// @Param        payload   body      oidcCallbackRequest  true  "Code and state from the redirect"
+// @Success      200       {object}  utils.MessageResponse
+// @Failure      400       {object}  utils.ErrorResponse
+// @Failure      401       {object}  utils.ErrorResponse
+// @Failure      403       {object}  utils.ErrorResponse
+// @Failure      404       {object}  utils.ErrorResponse
+// @Failure      409       {object}  utils.ErrorResponse
+// @Failure      500       {object}  utils.ErrorResponse
+// @Router       /user/identities/{provider}/callback [post]
+// @Security     BearerAuth
+func CompleteIdentityLink(ctx *gin.Context) {
+	oidcService := ctx.MustGet("oidcService").(*services.OIDCService)
+
+	var req oidcCallbackRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "CompleteIdentityLink bind error", "Invalid input")
+		return
+	}
+
+	if _, err := oidcService.Complete(ctx.Request.Context(), ctx.Param("provider"), req.Code, req.State, ctx.GetInt("userID")); err != nil {
+		respondOIDCError(ctx, err, "CompleteIdentityLink", "Could not link account")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Account linked successfully"})
+}
+
+// ListIdentities godoc
+// @Summary      List linked accounts
+// @Description  Returns the OpenID Connect accounts that can sign in as the current user.
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  utils.IdentitiesResponse
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /user/identities [get]
+// @Security     BearerAuth
+func ListIdentities(ctx *gin.Context) {
+	oidcService := ctx.MustGet("oidcService").(*services.OIDCService)
+
+	identities, err := oidcService.ListIdentities(ctx.GetInt("userID"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ListIdentities service error", "Could not retrieve linked accounts")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.IdentitiesResponse{Identities: identities})
+}
+
+// UnlinkIdentity godoc
+// @Summary      Unlink an account
+// @Description  Remove a linked OpenID Connect account. Accounts without a password must keep at least one linked account; set a password through the reset flow first.
+// @Tags         User
+// @Produce      json
+// @Param        id   path      int  true  "Identity ID"
+// @Success      200  {object}  utils.MessageResponse
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      404  {object}  utils.ErrorResponse
+// @Failure      409  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /user/identities/{id} [delete]
+// @Security     BearerAuth
+func UnlinkIdentity(ctx *gin.Context) {
+	oidcService := ctx.MustGet("oidcService").(*services.OIDCService)
+
+	identityID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusNotFound, err, "UnlinkIdentity invalid id", "Linked account not found")
+		return
+	}
+
+	if err := oidcService.Unlink(ctx.Request.Context(), ctx.GetInt("userID"), identityID); err != nil {
+		respondOIDCError(ctx, err, "UnlinkIdentity", "Could not unlink account")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Account unlinked"})
+}
+
+func respondOIDCError(ctx *gin.Context, err error, handler, clientMsg string) {
+	switch {
+	case errors.Is(err, services.ErrOIDCProviderUnknown):
+		utils.RespondError(ctx, http.StatusNotFound, err, handler+" unknown provider", "Unknown sign-in provider")
+	case errors.Is(err, repositories.ErrOIDCStateInvalid):
+		utils.RespondError(ctx, http.StatusBadRequest, err, handler+" invalid state", "Invalid or expired sign-in request")
+	case errors.Is(err, services.ErrOIDCTokenInvalid):
+		utils.RespondError(ctx, http.StatusUnauthorized, err, handler+" invalid token", "Sign-in with the provider failed")
+	case errors.Is(err, services.ErrOIDCLinkUserMismatch):
+		utils.RespondError(ctx, http.StatusForbidden, err, handler+" user mismatch", "This sign-in request was started by another account")
+	case errors.Is(err, services.ErrOIDCEmailRequired):
+		utils.RespondError(ctx, http.StatusBadRequest, err, handler+" email required", "The provider did not share a verified email address")
+	case errors.Is(err, services.ErrOIDCAccountExists):
+		utils.RespondError(ctx, http.StatusConflict, err, handler+" account exists", "An account with this email already exists; sign in and link the provider from your account")
+	case errors.Is(err, repositories.ErrIdentityAlreadyLinked):
+		utils.RespondError(ctx, http.StatusConflict, err, handler+" already linked", "This account is already linked")
+	case errors.Is(err, repositories.ErrIdentityNotFound):
+		utils.RespondError(ctx, http.StatusNotFound, err, handler+" not found", "Linked account not found")
+	case errors.Is(err, services.ErrLastSignInMethod):
+		utils.RespondError(ctx, http.StatusConflict, err, handler+" last sign-in method", "Cannot remove the only way to sign in")
+	case errors.Is(err, repositories.ErrDuplicateUser):
+		utils.RespondError(ctx, http.StatusConflict, err, handler+" duplicate user", "user already exists")
+	default:
+		utils.RespondError(ctx, http.StatusInternalServerError, err, handler+" service error", clientMsg)
+	}
+}
@@ -0,0 +1,490 @@
+package controllers_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+const (
+	mockOIDCClientID     = "dating-app"
+	mockOIDCClientSecret = "client-secret"
+)
+
+// mockOIDCProvider is a minimal OpenID Connect provider serving discovery, JWKS and the token
+// endpoint. Tests register the claims an authorization code should produce.
+type mockOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]mockOIDCGrant
+}
+
+type mockOIDCGrant struct {
+	claims        jwt.MapClaims
+	codeChallenge string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	p := &mockOIDCProvider{t: t, key: key, grants: map[string]mockOIDCGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.issuer(),
+			"authorization_endpoint": p.issuer() + "/authorize",
+			"token_endpoint":         p.issuer() + "/token",
+			"jwks_uri":               p.issuer() + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(utils.JSONWebKeySet{Keys: []utils.JSONWebKey{{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: "mock-key",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.handleToken)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *mockOIDCProvider) issuer() string {
+	return p.server.URL
+}
+
+func (p *mockOIDCProvider) config() services.OIDCProviderConfig {
+	return services.OIDCProviderConfig{
+		Name:         "mock",
+		Issuer:       p.issuer(),
+		ClientID:     mockOIDCClientID,
+		ClientSecret: mockOIDCClientSecret,
+		RedirectURL:  "http://localhost:3000/login/oidc/mock/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+// grant registers an authorization code for the request behind authURL. The ID token carries the
+// standard claims plus extra, which can override them.
+func (p *mockOIDCProvider) grant(code, authURL string, extra jwt.MapClaims) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatalf("error parsing authorization url: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != mockOIDCClientID {
+		p.t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	claims := jwt.MapClaims{
+		"iss":   p.issuer(),
+		"aud":   mockOIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grants[code] = mockOIDCGrant{claims: claims, codeChallenge: query.Get("code_challenge")}
+}
+
+func (p *mockOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != mockOIDCClientID || secret != mockOIDCClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.codeChallenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = "mock-key"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+}
+
+// capturedArg matches any argument and remembers it, so values generated by the service can be
+// replayed in later expectations.
+type capturedArg struct {
+	value string
+}
+
+func (a *capturedArg) Match(v driver.Value) bool {
+	a.value, _ = v.(string)
+	return true
+}
+
+type oidcStateCapture struct {
+	nonce, verifier capturedArg
+}
+
+// expectOIDCStateCreated expects the authorization request to be stored and captures its nonce and
+// PKCE verifier.
+func expectOIDCStateCreated(mock sqlmock.Sqlmock, linkUserID interface{}) *oidcStateCapture {
+	capture := &oidcStateCapture{}
+	mock.ExpectExec("INSERT INTO oidc_login_states").
+		WithArgs(sqlmock.AnyArg(), "mock", &capture.nonce, &capture.verifier, linkUserID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	return capture
+}
+
+func expectOIDCStateConsumed(mock sqlmock.Sqlmock, capture *oidcStateCapture, linkUserID interface{}) {
+	mock.ExpectQuery("UPDATE oidc_login_states\\s+SET used_at = NOW\\(\\)").
+		WithArgs(sqlmock.AnyArg(), "mock").
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "nonce", "code_verifier", "link_user_id"}).
+			AddRow("mock", capture.nonce.value, capture.verifier.value, linkUserID))
+}
+
+func startOIDC(t *testing.T, router *gin.Engine, req *http.Request) (string, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp utils.OIDCAuthorizationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	parsed, err := url.Parse(resp.AuthorizationURL)
+	if err != nil {
+		t.Fatalf("error parsing authorization url: %v", err)
+	}
+	return resp.AuthorizationURL, parsed.Query().Get("state")
+}
+
+func postOIDCCallback(router *gin.Engine, code, state string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"code": code, "state": state})
+	req := httptest.NewRequest(http.MethodPost, "/login/oidc/mock/callback", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// postOIDCLinkCallback finishes a link request as the signed-in user of testSessionID.
+func postOIDCLinkCallback(t *testing.T, router *gin.Engine, code, state string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := sessionRequest(t, http.MethodPost, "/user/identities/mock/callback", testSessionID)
+	body, _ := json.Marshal(map[string]string{"code": code, "state": state})
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCLoginCreatesAccountForNewIdentity(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	provider := newMockOIDCProvider(t)
+	router := setupRouterWithServices(db, services.NewMemoryMailer(), []services.OIDCProviderConfig{provider.config()})
+
+	capture := expectOIDCStateCreated(mock, nil)
+	authURL, state := startOIDC(t, router, httptest.NewRequest(http.MethodGet, "/login/oidc/mock", nil))
+	provider.grant("code-1", authURL, jwt.MapClaims{"sub": "sub-1", "email": "jane.doe@example.com", "email_verified": true, "name": "Jane Doe"})
+
+	expectOIDCStateConsumed(mock, capture, nil)
+	mock.ExpectQuery("UPDATE user_identities\\s+SET last_login_at = NOW\\(\\)").
+		WithArgs(provider.issuer(), "sub-1").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT id FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("jane.doe@example.com").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT id FROM users WHERE username=\\$1").
+		WithArgs("jane.doe").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users \\(username, email, password\\)").
+		WithArgs("jane.doe", "jane.doe@example.com", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec("UPDATE users\\s+SET email_verified = true").
+		WithArgs(7, "jane.doe@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO user_identities").
+		WithArgs(7, "mock", provider.issuer(), "sub-1", "jane.doe@example.com", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 7, models.UserAuditEventTypeIdentityLinked, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectTwoFactorEnabled(mock, 7, false)
+	mock.ExpectExec("INSERT INTO user_sessions").
+		WithArgs(sqlmock.AnyArg(), 7, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRoles(mock, 7)
+
+	w := postOIDCCallback(router, "code-1", state)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp utils.TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if resp.UserID != 7 || resp.Token == "" {
+		t.Fatalf("expected a session for user 7, got %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestOIDCLoginSignsInLinkedIdentity(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	provider := newMockOIDCProvider(t)
+	router := setupRouterWithServices(db, services.NewMemoryMailer(), []services.OIDCProviderConfig{provider.config()})
+
+	capture := expectOIDCStateCreated(mock, nil)
+	authURL, state := startOIDC(t, router, httptest.NewRequest(http.MethodGet, "/login/oidc/mock", nil))
+	provider.grant("code-1", authURL, jwt.MapClaims{"sub": "sub-1", "email": "john@example.com", "email_verified": true})
+
+	expectOIDCStateConsumed(mock, capture, nil)
+	mock.ExpectQuery("UPDATE user_identities\\s+SET last_login_at = NOW\\(\\)").
+		WithArgs(provider.issuer(), "sub-1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	expectTwoFactorEnabled(mock, 1, false)
+	mock.ExpectExec("INSERT INTO user_sessions").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRoles(mock, 1)
+
+	w := postOIDCCallback(router, "code-1", state)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestOIDCLoginDoesNotTakeOverExistingEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	provider := newMockOIDCProvider(t)
+	router := setupRouterWithServices(db, services.NewMemoryMailer(), []services.OIDCProviderConfig{provider.config()})
+
+	capture := expectOIDCStateCreated(mock, nil)
+	authURL, state := startOIDC(t, router, httptest.NewRequest(http.MethodGet, "/login/oidc/mock", nil))
+	provider.grant("code-1", authURL, jwt.MapClaims{"sub": "sub-2", "email": "john@example.com", "email_verified": true})
+
+	expectOIDCStateConsumed(mock, capture, nil)
+	mock.ExpectQuery("UPDATE user_identities\\s+SET last_login_at = NOW\\(\\)").
+		WithArgs(provider.issuer(), "sub-2").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT id FROM users WHERE LOWER\\(email\\) = LOWER\\(\\$1\\)").
+		WithArgs("john@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	w := postOIDCCallback(router, "code-1", state)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestOIDCLoginRejectsReplayedNonce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	provider := newMockOIDCProvider(t)
+	router := setupRouterWithServices(db, services.NewMemoryMailer(), []services.OIDCProviderConfig{provider.config()})
+
+	capture := expectOIDCStateCreated(mock, nil)
+	authURL, state := startOIDC(t, router, httptest.NewRequest(http.MethodGet, "/login/oidc/mock", nil))
+	provider.grant("code-1", authURL, jwt.MapClaims{"sub": "sub-1", "nonce": "from-another-request"})
+	expectOIDCStateConsumed(mock, capture, nil)
+
+	w := postOIDCCallback(router, "code-1", state)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestLinkIdentityToSignedInUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	provider := newMockOIDCProvider(t)
+	router := setupRouterWithServices(db, services.NewMemoryMailer(), []services.OIDCProviderConfig{provider.config()})
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	capture := expectOIDCStateCreated(mock, sql.NullInt64{Int64: 1, Valid: true})
+	authURL, state := startOIDC(t, router, sessionRequest(t, http.MethodPost, "/user/identities/mock", testSessionID))
+	provider.grant("code-1", authURL, jwt.MapClaims{"sub": "sub-1", "email": "john@gmail.example", "email_verified": true})
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectOIDCStateConsumed(mock, capture, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO user_identities").
+		WithArgs(1, "mock", provider.issuer(), "sub-1", "john@gmail.example", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, models.UserAuditEventTypeIdentityLinked, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	w := postOIDCLinkCallback(t, router, "code-1", state)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "refresh_token") {
+		t.Fatalf("linking must not start a session: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestLinkIdentityCannotBeFinishedByAnotherBrowser(t *testing.T) {
+	tests := []struct {
+		name       string
+		linkUserID interface{}
+	}{
+		{name: "link request posted to the sign-in callback", linkUserID: 1},
+		{name: "link request of another user", linkUserID: 2},
+		{name: "sign-in request posted to the link callback", linkUserID: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			provider := newMockOIDCProvider(t)
+			router := setupRouterWithServices(db, services.NewMemoryMailer(), []services.OIDCProviderConfig{provider.config()})
+
+			capture := expectOIDCStateCreated(mock, nil)
+			authURL, state := startOIDC(t, router, httptest.NewRequest(http.MethodGet, "/login/oidc/mock", nil))
+			provider.grant("code-1", authURL, jwt.MapClaims{"sub": "sub-1", "email": "victim@gmail.example", "email_verified": true})
+
+			var w *httptest.ResponseRecorder
+			if tt.linkUserID == 1 {
+				expectOIDCStateConsumed(mock, capture, tt.linkUserID)
+				w = postOIDCCallback(router, "code-1", state)
+			} else {
+				expectAuthenticatedSession(mock, testSessionID, 1)
+				expectOIDCStateConsumed(mock, capture, tt.linkUserID)
+				w = postOIDCLinkCallback(t, router, "code-1", state)
+			}
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected status 403 got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnlinkIdentityKeepsLastSignInMethod(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	mock.ExpectQuery("SELECT password FROM users WHERE id=\\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(""))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM user_identities WHERE user_id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectRollback()
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, sessionRequest(t, http.MethodDelete, "/user/identities/4", testSessionID))
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
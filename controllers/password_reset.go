@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ForgotPassword godoc
+// @Summary      Request a password reset link
+// @Description  Email a single-use reset link to the stored address of the account using the email. The response is the same, and sent as quickly, whether or not the address is registered.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      forgotPasswordRequest  true  "Account email"
+// @Success      202      {object}  utils.MessageResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /password/forgot [post]
+func ForgotPassword(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	var req forgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "ForgotPassword bind error", "Invalid input")
+		return
+	}
+
+	if err := userService.RequestPasswordReset(ctx.Request.Context(), req.Email); err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ForgotPassword service error", "Could not request password reset")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusAccepted, gin.H{"message": "If the address is registered, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary      Reset a password
+// @Description  Replace the password using the token from a reset email. Every existing session is signed out.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      resetPasswordRequest  true  "Reset token and new password"
+// @Success      200      {object}  utils.MessageResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      422      {object}  utils.ValidationErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /password/reset [post]
+func ResetPassword(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	var req resetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "ResetPassword bind error", "Invalid input")
+		return
+	}
+
+	err := userService.ResetPassword(ctx.Request.Context(), req.Token, req.Password, ctx.ClientIP(), ctx.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, repositories.ErrResetTokenInvalid) {
+			utils.RespondError(ctx, http.StatusBadRequest, err, "ResetPassword invalid token", "Invalid or expired reset token")
+			return
+		}
+		var invalid *utils.ValidationError
+		if errors.As(err, &invalid) {
+			utils.RespondValidationError(ctx, invalid, "ResetPassword validation error")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ResetPassword service error", "Password reset failed")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
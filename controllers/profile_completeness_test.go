@@ -0,0 +1,118 @@
+package controllers_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/icpinto/dating-app/services"
+	"github.com/lib/pq"
+)
+
+func TestGetProfileCompletenessListsMissingSections(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT p.id, p.user_id").
+		WithArgs(1).
+		WillReturnRows(mockProfileRowsWith(map[string]driver.Value{
+			"bio": "hello", "interests": pq.StringArray{"hiking"}, "languages": pq.StringArray{"si"},
+			"gender": "male", "date_of_birth": "1990-01-01", "civil_status": "never_married", "height_cm": 175, "weight_kg": 70,
+			"country_code": "LK", "province": "Western", "district": "Colombo", "city": "Colombo",
+			"religion": "Buddhist", "occupation": "Engineer", "siblings": "{}",
+		}))
+	mock.ExpectQuery("SELECT id, user_id, url").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(profilePhotoColumns).
+			AddRow(3, 1, "a.jpg", "a_medium.jpg", "a_thumb.jpg", "", 0, true, now, "approved").
+			AddRow(4, 1, "b.jpg", "b_medium.jpg", "b_thumb.jpg", "", 1, false, now, "pending").
+			AddRow(5, 1, "c.jpg", "c_medium.jpg", "c_thumb.jpg", "", 2, false, now, "rejected"))
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/completeness", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Score           int `json:"score"`
+		MissingSections []struct {
+			Section       string   `json:"section"`
+			Weight        int      `json:"weight"`
+			MissingFields []string `json:"missing_fields"`
+		} `json:"missing_sections"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	// Two of three photos (13.3), about, basics and location (40), half of religion (2.5) and
+	// career (2.5): 58.3.
+	if resp.Score != 58 {
+		t.Fatalf("expected score 58, got %d", resp.Score)
+	}
+	want := []string{"photos", "religion", "lifestyle", "education", "career", "family", "horoscope"}
+	if len(resp.MissingSections) != len(want) {
+		t.Fatalf("expected missing sections %v, got %+v", want, resp.MissingSections)
+	}
+	for i, section := range resp.MissingSections {
+		if section.Section != want[i] {
+			t.Fatalf("expected missing sections %v, got %+v", want, resp.MissingSections)
+		}
+	}
+	if career := resp.MissingSections[4]; len(career.MissingFields) != 1 || career.MissingFields[0] != "employment_status" || career.Weight != 5 {
+		t.Fatalf("expected the career section to miss employment_status, got %+v", career)
+	}
+	if family := resp.MissingSections[5]; len(family.MissingFields) != 3 {
+		t.Fatalf("expected an empty siblings object to count as missing, got %+v", family)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestGetProfilesByCompleteness(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT p.id, p.user_id(.|\\n)*COALESCE\\(p.completeness, 0\\) >= \\$2 ORDER BY COALESCE\\(p.completeness, 0\\) DESC").
+		WithArgs("female", 60).
+		WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"completeness": 75}))
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profiles?gender=female&min_completeness=60&sort=completeness", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var profiles []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &profiles); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(profiles) != 1 || profiles[0]["completeness"] != float64(75) {
+		t.Fatalf("expected the profile with its completeness score, got %v", profiles)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+
+	for _, query := range []string{"min_completeness=101", "min_completeness=most", "sort=age"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profiles?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400 for %s, got %d: %s", query, w.Code, w.Body.String())
+		}
+	}
+}
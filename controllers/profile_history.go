@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// respondProfileHistory writes a page of the user's profile history selected by the limit and
+// offset query parameters.
+func respondProfileHistory(ctx *gin.Context, handler string, userID int) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+
+	var invalid utils.ValidationError
+	limit := queryInt(ctx, &invalid, "limit")
+	offset := queryInt(ctx, &invalid, "offset")
+	if len(invalid.Fields) > 0 {
+		utils.RespondValidationError(ctx, &invalid, handler+" invalid query")
+		return
+	}
+
+	entries, err := profileService.ListProfileHistory(userID, limit, offset)
+	if err != nil {
+		var validationErr *utils.ValidationError
+		if errors.As(err, &validationErr) {
+			utils.RespondValidationError(ctx, validationErr, handler+" invalid query")
+			return
+		}
+		logMsg := fmt.Sprintf("%s service error for user %d", handler, userID)
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to retrieve profile history")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.ProfileHistoryResponse{Entries: entries})
+}
+
+// GetProfileHistory godoc
+// @Summary      List the changes to the authenticated user's profile
+// @Description  Returns the versions of the profile, newest first. Each version lists the fields one save changed with their old and new values; sensitive values are masked.
+// @Tags         Profiles
+// @Produce      json
+// @Param        limit   query     int  false  "Page size, 20 by default and at most 100"
+// @Param        offset  query     int  false  "Number of versions to skip"
+// @Success      200     {object}  utils.ProfileHistoryResponse
+// @Failure      401     {object}  utils.ErrorResponse
+// @Failure      422     {object}  utils.ValidationErrorResponse
+// @Failure      500     {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/history [get]
+func GetProfileHistory(ctx *gin.Context) {
+	respondProfileHistory(ctx, "GetProfileHistory", ctx.GetInt("userID"))
+}
+
+// GetUserProfileHistory godoc
+// @Summary      List the changes to a user's profile
+// @Description  Admin only. Returns the versions of the user's profile, newest first, with sensitive values masked.
+// @Tags         Admin
+// @Produce      json
+// @Param        user_id  path      int  true   "User ID"
+// @Param        limit    query     int  false  "Page size, 20 by default and at most 100"
+// @Param        offset   query     int  false  "Number of versions to skip"
+// @Success      200      {object}  utils.ProfileHistoryResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      403      {object}  utils.ErrorResponse
+// @Failure      422      {object}  utils.ValidationErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /admin/users/{user_id}/profile/history [get]
+// @Security     BearerAuth
+func GetUserProfileHistory(ctx *gin.Context) {
+	userID, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "GetUserProfileHistory invalid user id", "Invalid user id")
+		return
+	}
+	respondProfileHistory(ctx, "GetUserProfileHistory", userID)
+}
@@ -0,0 +1,107 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/icpinto/dating-app/services"
+)
+
+func profileHistoryRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "version", "changed_by", "changes", "created_at"})
+}
+
+func TestGetProfileHistoryListsOwnVersions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+	mock.ExpectQuery("SELECT id, user_id, version, changed_by, changes, created_at FROM profile_history").
+		WithArgs(1, 20, 0).
+		WillReturnRows(profileHistoryRows().
+			AddRow(7, 1, 2, 1, []byte(`[{"field":"phone_number","old_value":"***67","new_value":"***89","masked":true}]`), time.Now()).
+			AddRow(3, 1, 1, nil, []byte(`[{"field":"religion","old_value":"","new_value":"Buddhist"}]`), time.Now()))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/history", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Entries []struct {
+			Version   int  `json:"version"`
+			ChangedBy *int `json:"changed_by"`
+			Changes   []struct {
+				Field    string `json:"field"`
+				NewValue string `json:"new_value"`
+				Masked   bool   `json:"masked"`
+			} `json:"changes"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(resp.Entries) != 2 || resp.Entries[0].Version != 2 || resp.Entries[0].ChangedBy == nil || *resp.Entries[0].ChangedBy != 1 {
+		t.Fatalf("expected both versions newest first, got %+v", resp.Entries)
+	}
+	if change := resp.Entries[0].Changes[0]; change.Field != "phone_number" || change.NewValue != "***89" || !change.Masked {
+		t.Fatalf("expected the masked phone number change, got %+v", change)
+	}
+	if resp.Entries[1].ChangedBy != nil {
+		t.Fatalf("expected no author for a version whose author was deleted, got %v", *resp.Entries[1].ChangedBy)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestGetProfileHistoryRejectsInvalidPaging(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/history?limit=500&offset=-1", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	assertValidationCodes(t, w.Body.Bytes(), map[string]string{"limit": "out_of_range", "offset": "out_of_range"})
+}
+
+func TestGetUserProfileHistoryForAdmins(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+	mock.ExpectQuery("SELECT id, user_id, version, changed_by, changes, created_at FROM profile_history").
+		WithArgs(2, 5, 10).
+		WillReturnRows(profileHistoryRows())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/users/2/profile/history?limit=5&offset=10", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"entries":[]}` {
+		t.Fatalf("expected an empty page got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/users/abc/profile/history", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
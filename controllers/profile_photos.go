@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+type reorderProfilePhotosRequest struct {
+	PhotoIDs []int `json:"photo_ids" binding:"required"`
+}
+
+// ListProfilePhotos godoc
+// @Summary      List the authenticated user's photos
+// @Description  Returns the photo gallery in display order, including each photo's moderation status. The primary photo is also the profile image.
+// @Tags         Profiles
+// @Produce      json
+// @Success      200  {object}  utils.ProfilePhotosResponse
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/photos [get]
+func ListProfilePhotos(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+
+	photos, err := profileService.ListProfilePhotos(ctx.GetInt("userID"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ListProfilePhotos service error", "Failed to retrieve photos")
+		return
+	}
+
+	signPhotoList(ctx, photos)
+	utils.RespondSuccess(ctx, http.StatusOK, utils.ProfilePhotosResponse{Photos: photos})
+}
+
+// GetUserProfilePhotos godoc
+// @Summary      List a user's photos
+// @Description  Returns another user's photo gallery in display order. Photos rejected by moderation are left out.
+// @Tags         Profiles
+// @Produce      json
+// @Param        user_id  path      int  true  "User ID"
+// @Success      200      {object}  utils.ProfilePhotosResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/{user_id}/photos [get]
+func GetUserProfilePhotos(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+
+	userID, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "GetUserProfilePhotos invalid user id", "Invalid user id")
+		return
+	}
+
+	photos, err := profileService.ListVisibleProfilePhotos(userID)
+	if err != nil {
+		logMsg := fmt.Sprintf("GetUserProfilePhotos service error for user %d", userID)
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to retrieve photos")
+		return
+	}
+
+	signPhotoList(ctx, photos)
+	utils.RespondSuccess(ctx, http.StatusOK, utils.ProfilePhotosResponse{Photos: photos})
+}
+
+// UploadProfilePhoto godoc
+// @Summary      Add a photo to the gallery
+// @Description  Appends a photo to the end of the gallery. The first photo becomes the primary photo and the profile image. Galleries hold at most PROFILE_PHOTO_LIMIT photos (6 by default). JPEG, PNG and WebP uploads within the size and dimension limits are accepted; metadata is stripped and the photo is stored as JPEG in full, medium and thumbnail sizes. New photos are queued for moderation.
+// @Tags         Profiles
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        photo    formData  file    true   "Photo"
+// @Param        caption  formData  string  false  "Caption of at most 200 characters"
+// @Success      201      {object}  models.ProfilePhoto
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      422      {object}  utils.ValidationErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/photos [post]
+func UploadProfilePhoto(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	file, err := ctx.FormFile("photo")
+	if err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "UploadProfilePhoto missing file", "Photo is required")
+		return
+	}
+	caption := ctx.PostForm("caption")
+	var invalid utils.ValidationError
+	services.ValidateProfilePhotoCaption(&invalid, caption)
+	if len(invalid.Fields) > 0 {
+		utils.RespondValidationError(ctx, &invalid, "UploadProfilePhoto validation error")
+		return
+	}
+
+	mediaStorage := ctx.MustGet("mediaStorage").(services.MediaStorage)
+
+	image, err := storeUploadedImage(ctx, mediaStorage, file)
+	if err != nil {
+		if invalid := imageUploadError("photo", err); invalid != nil {
+			utils.RespondValidationError(ctx, invalid, "UploadProfilePhoto image rejected")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "UploadProfilePhoto save error", "Failed to save image")
+		return
+	}
+
+	photo, err := profileService.AddProfilePhoto(ctx.Request.Context(), userID, models.ProfilePhoto{
+		URL:       image.Key,
+		MediumURL: image.MediumKey,
+		ThumbURL:  image.ThumbKey,
+		Caption:   caption,
+	})
+	if err != nil {
+		discardStoredImage(ctx, mediaStorage, profileService, image)
+		logMsg := fmt.Sprintf("UploadProfilePhoto service error for user %d", userID)
+		var validationErr *utils.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			utils.RespondValidationError(ctx, validationErr, logMsg)
+		case errors.Is(err, services.ErrPhotoLimitReached):
+			utils.RespondError(ctx, http.StatusConflict, err, logMsg, "Photo limit reached")
+		case errors.Is(err, repositories.ErrUserNotFound):
+			utils.RespondError(ctx, http.StatusUnauthorized, err, logMsg, "Unauthorized")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to add photo")
+		}
+		return
+	}
+
+	signPhotoMedia(ctx, &photo)
+	utils.RespondSuccess(ctx, http.StatusCreated, photo)
+}
+
+// ReorderProfilePhotos godoc
+// @Summary      Reorder the gallery
+// @Description  Arranges the gallery in the given order. photo_ids must list every photo of the gallery exactly once. The primary photo does not change.
+// @Tags         Profiles
+// @Accept       json
+// @Produce      json
+// @Param        order  body      reorderProfilePhotosRequest  true  "Photo IDs in display order"
+// @Success      200    {object}  utils.ProfilePhotosResponse
+// @Failure      400    {object}  utils.ErrorResponse
+// @Failure      401    {object}  utils.ErrorResponse
+// @Failure      422    {object}  utils.ValidationErrorResponse
+// @Failure      500    {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/photos/order [put]
+func ReorderProfilePhotos(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	var req reorderProfilePhotosRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "ReorderProfilePhotos bind error", "Invalid input")
+		return
+	}
+
+	photos, err := profileService.ReorderProfilePhotos(ctx.Request.Context(), userID, req.PhotoIDs)
+	if err != nil {
+		logMsg := fmt.Sprintf("ReorderProfilePhotos service error for user %d", userID)
+		var validationErr *utils.ValidationError
+		if errors.As(err, &validationErr) {
+			utils.RespondValidationError(ctx, validationErr, logMsg)
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to reorder photos")
+		return
+	}
+
+	signPhotoList(ctx, photos)
+	utils.RespondSuccess(ctx, http.StatusOK, utils.ProfilePhotosResponse{Photos: photos})
+}
+
+// SetPrimaryProfilePhoto godoc
+// @Summary      Choose the primary photo
+// @Description  Makes the photo the primary photo. It becomes the profile image shown in profiles and matches. Photos rejected by moderation cannot be chosen.
+// @Tags         Profiles
+// @Produce      json
+// @Param        photo_id  path      int  true  "Photo ID"
+// @Success      200       {object}  models.ProfilePhoto
+// @Failure      401       {object}  utils.ErrorResponse
+// @Failure      404       {object}  utils.ErrorResponse
+// @Failure      409       {object}  utils.ErrorResponse
+// @Failure      500       {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/photos/{photo_id}/primary [put]
+func SetPrimaryProfilePhoto(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	photoID, err := strconv.Atoi(ctx.Param("photo_id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusNotFound, err, "SetPrimaryProfilePhoto invalid id", "Photo not found")
+		return
+	}
+
+	photo, err := profileService.SetPrimaryProfilePhoto(ctx.Request.Context(), userID, photoID)
+	if err != nil {
+		logMsg := fmt.Sprintf("SetPrimaryProfilePhoto service error for user %d", userID)
+		switch {
+		case errors.Is(err, services.ErrPhotoNotFound):
+			utils.RespondError(ctx, http.StatusNotFound, err, logMsg, "Photo not found")
+		case errors.Is(err, services.ErrPhotoRejected):
+			utils.RespondError(ctx, http.StatusConflict, err, logMsg, "Rejected photos cannot be the primary photo")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to update photo")
+		}
+		return
+	}
+
+	signPhotoMedia(ctx, &photo)
+	utils.RespondSuccess(ctx, http.StatusOK, photo)
+}
+
+// DeleteProfilePhoto godoc
+// @Summary      Delete a photo
+// @Description  Removes the photo from the gallery. When the primary photo is deleted the next photo in the gallery takes its place; deleting the last photo clears the profile image.
+// @Tags         Profiles
+// @Produce      json
+// @Param        photo_id  path      int  true  "Photo ID"
+// @Success      200       {object}  utils.MessageResponse
+// @Failure      401       {object}  utils.ErrorResponse
+// @Failure      404       {object}  utils.ErrorResponse
+// @Failure      500       {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/photos/{photo_id} [delete]
+func DeleteProfilePhoto(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	photoID, err := strconv.Atoi(ctx.Param("photo_id"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusNotFound, err, "DeleteProfilePhoto invalid id", "Photo not found")
+		return
+	}
+
+	photo, err := profileService.DeleteProfilePhoto(ctx.Request.Context(), userID, photoID)
+	if err != nil {
+		logMsg := fmt.Sprintf("DeleteProfilePhoto service error for user %d", userID)
+		if errors.Is(err, services.ErrPhotoNotFound) {
+			utils.RespondError(ctx, http.StatusNotFound, err, logMsg, "Photo not found")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to delete photo")
+		return
+	}
+	mediaStorage := ctx.MustGet("mediaStorage").(services.MediaStorage)
+	discardStoredImage(ctx, mediaStorage, profileService, storedImage{Key: photo.URL, MediumKey: photo.MediumURL, ThumbKey: photo.ThumbURL})
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Photo deleted"})
+}
@@ -0,0 +1,409 @@
+package controllers_test
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/icpinto/dating-app/services"
+)
+
+var profilePhotoColumns = []string{"id", "user_id", "url", "medium_url", "thumb_url", "caption", "position", "is_primary", "created_at", "moderation_status"}
+
+// chdirTemp runs the test from an empty directory so uploaded files do not land in the source tree.
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	return dir
+}
+
+// testPNG encodes a width x height PNG.
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testJPEGWithOrientation encodes a width x height JPEG carrying an EXIF orientation tag.
+func testJPEGWithOrientation(t *testing.T, width, height int, orientation byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08" +
+		"\x00\x01" + "\x01\x12\x00\x03\x00\x00\x00\x01" + string([]byte{0, orientation, 0, 0}) +
+		"\x00\x00\x00\x00")
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := append([]byte{0xFF, 0xE1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}, segment...)
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+}
+
+func photoUploadRequest(t *testing.T, caption string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("photo", "../../beach.jpg")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	_, _ = part.Write(content)
+	_ = writer.WriteField("caption", caption)
+	_ = writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/profile/photos", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func expectGalleryLock(mock sqlmock.Sqlmock, userID int, rows *sqlmock.Rows) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM users WHERE id = \\$1 FOR UPDATE").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+	mock.ExpectQuery("SELECT id, user_id, url, medium_url, thumb_url, caption, position, is_primary, created_at, moderation_status FROM profile_photos").
+		WithArgs(userID).
+		WillReturnRows(rows)
+}
+
+func expectPhotoQueuedForModeration(mock sqlmock.Sqlmock, userID, photoID int) {
+	mock.ExpectExec("INSERT INTO moderation_items \\(user_id, kind, photo_id\\)").
+		WithArgs(userID, "photo", photoID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestUploadFirstProfilePhotoBecomesProfileImage(t *testing.T) {
+	dir := chdirTemp(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectGalleryLock(mock, 1, sqlmock.NewRows(profilePhotoColumns))
+	mock.ExpectQuery("INSERT INTO profile_photos").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "At the beach", 0, true, "pending").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, time.Now()))
+	expectPhotoQueuedForModeration(mock, 1, 7)
+	mock.ExpectExec("UPDATE profiles").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectCompletenessRefresh(mock, 1, nil, nil, 0)
+	mock.ExpectExec("INSERT INTO profile_sync_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, photoUploadRequest(t, "At the beach", testJPEGWithOrientation(t, 400, 300, 6)))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 got %d: %s", w.Code, w.Body.String())
+	}
+	var photo map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &photo); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if photo["id"] != float64(7) || photo["is_primary"] != true {
+		t.Fatalf("expected photo 7 to be primary, got %v", photo)
+	}
+	files, _ := os.ReadDir(filepath.Join(dir, "uploads"))
+	if len(files) != 3 {
+		t.Fatalf("expected full, medium and thumb sizes to be stored, found %d files", len(files))
+	}
+	photoURL, _ := photo["url"].(string)
+	if !regexp.MustCompile(`/uploads/[0-9a-f]{64}\.jpg\?expires=\d+&signature=[\w-]+$`).MatchString(photoURL) {
+		t.Fatalf("expected a signed URL of a content hash file name, got %q", photoURL)
+	}
+	parsed, err := url.Parse(photoURL)
+	if err != nil {
+		t.Fatalf("invalid photo URL: %v", err)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, "uploads", path.Base(parsed.Path)))
+	if err != nil {
+		t.Fatalf("read stored photo: %v", err)
+	}
+	if bytes.Contains(stored, []byte("Exif")) {
+		t.Fatalf("expected EXIF metadata to be stripped")
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("decode stored photo: %v", err)
+	}
+	if config.Width != 300 || config.Height != 400 {
+		t.Fatalf("expected the EXIF rotation to be applied, got %dx%d", config.Width, config.Height)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestCreateProfileImageJoinsGalleryAsPrimaryPhoto(t *testing.T) {
+	chdirTemp(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id FROM users WHERE username=\\$1 AND is_active = true").
+		WithArgs("john").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	expectProfileSaveLock(mock, 1)
+	mock.ExpectQuery("SELECT p.id, p.user_id").WithArgs(1).WillReturnRows(mockProfileRows())
+	args := make([]driver.Value, 44)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[39] = "" // profile_image_url: the profile form no longer writes the image itself
+	mock.ExpectExec("INSERT INTO profiles").WithArgs(args...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT p.id, p.user_id").WithArgs(1).WillReturnRows(mockProfileRows())
+	mock.ExpectCommit()
+	expectCompletenessStored(mock, 1, sqlmock.NewRows(profilePhotoColumns), -1)
+
+	// The upload is appended behind the existing primary photo and queued for review...
+	existing := func() *sqlmock.Rows {
+		return sqlmock.NewRows(profilePhotoColumns).AddRow(3, 1, "a.jpg", "a.jpg", "a.jpg", "", 0, true, time.Now(), "approved")
+	}
+	expectGalleryLock(mock, 1, existing())
+	mock.ExpectQuery("INSERT INTO profile_photos").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "", 1, false, "pending").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(8, time.Now()))
+	expectPhotoQueuedForModeration(mock, 1, 8)
+	mock.ExpectCommit()
+	expectCompletenessRefresh(mock, 1, nil, nil, 0)
+	// ...and then becomes the primary photo and profile image.
+	expectGalleryLock(mock, 1, existing().AddRow(8, 1, "b.jpg", "b.jpg", "b.jpg", "", 1, false, time.Now(), "pending"))
+	mock.ExpectExec("UPDATE profile_photos SET is_primary = FALSE").WithArgs(1, 8).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE profile_photos SET is_primary = TRUE").WithArgs(1, 8).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE profiles").WithArgs(1, "b.jpg", "b.jpg").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT INTO profile_sync_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1,"userId":1}`))
+	}))
+	defer server.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("profile_image", "me.png")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	_, _ = part.Write(testPNG(t, 300, 300))
+	_ = writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/profile", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	setupProfileRouter(db, services.NewMatchService(server.URL), true).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestUploadProfilePhotoRejectedWhenGalleryFull(t *testing.T) {
+	dir := chdirTemp(t)
+	if err := services.ConfigureProfilePhotoLimit(1); err != nil {
+		t.Fatalf("configure limit: %v", err)
+	}
+	t.Cleanup(func() { _ = services.ConfigureProfilePhotoLimit(services.DefaultProfilePhotoLimit) })
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectGalleryLock(mock, 1, sqlmock.NewRows(profilePhotoColumns).
+		AddRow(3, 1, "a.jpg", "a.jpg", "a.jpg", "", 0, true, time.Now(), "approved"))
+	mock.ExpectRollback()
+	mock.ExpectQuery("SELECT EXISTS").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, photoUploadRequest(t, "", testPNG(t, 300, 300)))
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 got %d: %s", w.Code, w.Body.String())
+	}
+	if files, _ := os.ReadDir(filepath.Join(dir, "uploads")); len(files) != 0 {
+		t.Fatalf("expected the rejected photo to be removed, found %d files", len(files))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestUploadProfilePhotoRejectsUnsupportedImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		code    string
+	}{
+		{"not an image", []byte("GIF89a not really"), "unsupported_type"},
+		{"too small", nil, "invalid_dimensions"},
+		{"corrupt", []byte("\x89PNG\r\n\x1a\n broken"), "invalid_image"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := chdirTemp(t)
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			content := tc.content
+			if content == nil {
+				content = testPNG(t, 120, 600)
+			}
+			router := setupProfileRouter(db, services.NewMatchService(""), true)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, photoUploadRequest(t, "", content))
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+			}
+			assertValidationCodes(t, w.Body.Bytes(), map[string]string{"photo": tc.code})
+			if files, _ := os.ReadDir(filepath.Join(dir, "uploads")); len(files) != 0 {
+				t.Fatalf("expected nothing to be stored, found %d files", len(files))
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestReorderProfilePhotosRequiresEveryPhoto(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	expectGalleryLock(mock, 1, sqlmock.NewRows(profilePhotoColumns).
+		AddRow(3, 1, "a", "a", "a", "", 0, true, now, "approved").
+		AddRow(4, 1, "b", "b", "b", "", 1, false, now, "approved"))
+	mock.ExpectRollback()
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+	req := httptest.NewRequest(http.MethodPut, "/profile/photos/order", bytes.NewBufferString(`{"photo_ids":[4,4]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	assertValidationCodes(t, w.Body.Bytes(), map[string]string{"photo_ids": "invalid_order"})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestDeletePrimaryProfilePhotoPromotesNext(t *testing.T) {
+	dir := chdirTemp(t)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	expectGalleryLock(mock, 1, sqlmock.NewRows(profilePhotoColumns).
+		AddRow(3, 1, "a.jpg", "a_medium.jpg", "a_thumb.jpg", "", 0, true, now, "approved").
+		AddRow(4, 1, "b.jpg", "b_medium.jpg", "b_thumb.jpg", "", 1, false, now, "approved"))
+	mock.ExpectExec("DELETE FROM profile_photos").
+		WithArgs(1, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE profile_photos SET position").
+		WithArgs(1, 4, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE profile_photos SET is_primary = FALSE").
+		WithArgs(1, 4).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE profile_photos SET is_primary = TRUE").
+		WithArgs(1, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE profiles").
+		WithArgs(1, "b.jpg", "b_thumb.jpg").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// One photo left of the three that complete the photos section: 20/3 rounds to 7.
+	expectCompletenessRefresh(mock, 1, mockProfileRowsWith(map[string]driver.Value{"completeness": 13}),
+		sqlmock.NewRows(profilePhotoColumns).AddRow(4, 1, "b.jpg", "b_medium.jpg", "b_thumb.jpg", "", 0, true, now, "approved"), 7)
+	mock.ExpectExec("INSERT INTO profile_sync_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs("a.jpg").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	if err := os.MkdirAll(filepath.Join(dir, "uploads"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"a.jpg", "a_medium.jpg", "a_thumb.jpg", "b.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, "uploads", name), []byte("x"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+	req := httptest.NewRequest(http.MethodDelete, "/profile/photos/3", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if files, _ := os.ReadDir(filepath.Join(dir, "uploads")); len(files) != 1 || files[0].Name() != "b.jpg" {
+		t.Fatalf("expected only the remaining photo to be kept, found %v", files)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
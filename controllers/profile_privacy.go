@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// GetProfilePrivacy godoc
+// @Summary      Retrieve who may see the private fields of the authenticated user's profile
+// @Description  Lists every private field with its visibility: everyone, connections (users with an accepted friend request) or nobody. Contact details, birth time, birth place and horoscope default to connections; the other fields default to everyone.
+// @Tags         Profiles
+// @Produce      json
+// @Success      200  {object}  models.ProfilePrivacySettings
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/privacy [get]
+func GetProfilePrivacy(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	settings, err := profileService.GetPrivacySettings(userID)
+	if err != nil {
+		logMsg := fmt.Sprintf("GetProfilePrivacy service error for user %d", userID)
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to retrieve privacy settings")
+		return
+	}
+	utils.RespondSuccess(ctx, http.StatusOK, settings)
+}
+
+// UpdateProfilePrivacy godoc
+// @Summary      Change who may see the private fields of the authenticated user's profile
+// @Description  Sets the visibility of the listed fields and leaves the others unchanged. Unknown fields and visibilities other than everyone, connections and nobody are answered with 422. The owner always sees their full profile.
+// @Tags         Profiles
+// @Accept       json
+// @Produce      json
+// @Param        settings  body      models.ProfilePrivacySettings  true  "Visibility by field"
+// @Success      200       {object}  models.ProfilePrivacySettings
+// @Failure      400       {object}  utils.ErrorResponse
+// @Failure      401       {object}  utils.ErrorResponse
+// @Failure      422       {object}  utils.ValidationErrorResponse
+// @Failure      500       {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/privacy [put]
+func UpdateProfilePrivacy(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	var req models.ProfilePrivacySettings
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "UpdateProfilePrivacy bind error", "Invalid input")
+		return
+	}
+
+	settings, err := profileService.UpdatePrivacySettings(userID, req.Fields)
+	if err != nil {
+		logMsg := fmt.Sprintf("UpdateProfilePrivacy service error for user %d", userID)
+		var validationErr *utils.ValidationError
+		if errors.As(err, &validationErr) {
+			utils.RespondValidationError(ctx, validationErr, logMsg)
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to update privacy settings")
+		return
+	}
+	utils.RespondSuccess(ctx, http.StatusOK, settings)
+}
@@ -0,0 +1,231 @@
+package controllers_test
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/controllers"
+	"github.com/icpinto/dating-app/middlewares"
+	"github.com/icpinto/dating-app/services"
+)
+
+// privateProfileRow is the profile of user 2 with every private field the tests look at filled in.
+func privateProfileRow() *sqlmock.Rows {
+	return mockProfileRowsWith(map[string]driver.Value{
+		"id":            2,
+		"user_id":       2,
+		"username":      "jane",
+		"phone_number":  "+94771234567",
+		"postal_code":   "10100",
+		"caste":         "Karawa",
+		"birth_time":    "06:30:00",
+		"horoscope":     `{"lagna":"mesha"}`,
+		"date_of_birth": "1995-04-01",
+	})
+}
+
+func getProfileAs(t *testing.T, router *gin.Engine, target string) map[string]any {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var profile map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	return profile
+}
+
+func TestGetUserProfileAppliesFieldVisibility(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    map[string]string
+		connected bool
+		visible   map[string]string
+		hidden    []string
+	}{
+		{
+			name:    "defaults hide contact details from non-connections",
+			visible: map[string]string{"caste": "Karawa", "date_of_birth": "1995-04-01"},
+			hidden:  []string{"phone_number", "postal_code", "birth_time", "horoscope"},
+		},
+		{
+			name:      "connections see contact details",
+			connected: true,
+			visible:   map[string]string{"phone_number": "+94771234567", "birth_time": "06:30:00", "caste": "Karawa"},
+		},
+		{
+			name:      "nobody hides a field from connections",
+			stored:    map[string]string{"caste": "nobody", "phone_number": "everyone"},
+			connected: true,
+			visible:   map[string]string{"phone_number": "+94771234567"},
+			hidden:    []string{"caste"},
+		},
+		{
+			name:    "connections only field hidden from others",
+			stored:  map[string]string{"date_of_birth": "connections"},
+			visible: map[string]string{"caste": "Karawa"},
+			hidden:  []string{"date_of_birth", "phone_number"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery("SELECT p.id, p.user_id").WithArgs(2).WillReturnRows(privateProfileRow())
+			expectProfilePrivacy(mock, 1, 2, tt.stored, tt.connected)
+			expectProfileView(mock, 1, 2)
+
+			profile := getProfileAs(t, setupProfileRouter(db, services.NewMatchService(""), true), "/profile/2")
+			for field, want := range tt.visible {
+				if profile[field] != want {
+					t.Errorf("expected %s to be %q, got %v", field, want, profile[field])
+				}
+			}
+			for _, field := range tt.hidden {
+				if profile[field] != "" {
+					t.Errorf("expected %s to be hidden, got %v", field, profile[field])
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetUserProfileShowsOwnerEveryField(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT p.id, p.user_id").
+		WithArgs(1).
+		WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"phone_number": "+94771234567", "bio": "mine", "moderation_status": "rejected"}))
+
+	profile := getProfileAs(t, setupProfileRouter(db, services.NewMatchService(""), true), "/profile/1")
+	if profile["phone_number"] != "+94771234567" || profile["bio"] != "mine" {
+		t.Fatalf("expected the owner to see their whole profile, got %v", profile)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestGetUserMatchesAppliesFieldVisibility(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"user_id":2,"score":0.9,"reasons":{}}]`))
+	}))
+	defer server.Close()
+
+	mock.ExpectQuery("SELECT p.id, p.user_id").WithArgs("{2}").WillReturnRows(privateProfileRow())
+	expectProfilePrivacy(mock, 1, 2, map[string]string{"caste": "connections"}, false)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middlewares.ServiceMiddleware(middlewares.Services{
+		ProfileService: services.NewProfileService(db),
+		MatchService:   services.NewMatchService(server.URL),
+	}))
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", 1)
+		c.Next()
+	})
+	router.GET("/matches/:user_id", controllers.GetUserMatches)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/matches/1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var matches []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &matches); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if len(matches) != 1 || matches[0]["phone_number"] != "" || matches[0]["caste"] != "" || matches[0]["date_of_birth"] != "1995-04-01" {
+		t.Fatalf("expected private fields to be hidden from the match list, got %v", matches)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestUpdateProfilePrivacy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middlewares.ServiceMiddleware(middlewares.Services{ProfileService: services.NewProfileService(db)}))
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", 1)
+		c.Next()
+	})
+	router.GET("/profile/privacy", controllers.GetProfilePrivacy)
+	router.PUT("/profile/privacy", controllers.UpdateProfilePrivacy)
+
+	mock.ExpectExec("INSERT INTO profile_field_visibility").
+		WithArgs(1, `{"caste","phone_number"}`, `{"nobody","everyone"}`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("SELECT user_id, field, visibility FROM profile_field_visibility").
+		WithArgs("{1}").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "field", "visibility"}).
+			AddRow(1, "caste", "nobody").
+			AddRow(1, "phone_number", "everyone"))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/profile/privacy", bytes.NewBufferString(`{"fields":{"phone_number":"everyone","caste":"nobody"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var settings struct {
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &settings); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	want := map[string]string{"caste": "nobody", "phone_number": "everyone", "horoscope": "connections", "city": "everyone"}
+	for field, visibility := range want {
+		if settings.Fields[field] != visibility {
+			t.Errorf("expected %s to be %s, got %q", field, visibility, settings.Fields[field])
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/profile/privacy", bytes.NewBufferString(`{"fields":{"phone_number":"friends","gender":"nobody"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	assertValidationCodes(t, w.Body.Bytes(), map[string]string{"fields.phone_number": "invalid_choice", "fields.gender": "unknown_field"})
+}
@@ -18,35 +18,131 @@ import (
 	"github.com/icpinto/dating-app/controllers"
 	"github.com/icpinto/dating-app/middlewares"
 	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
 	"github.com/lib/pq"
 )
 
 func setupProfileRouter(db *sql.DB, matchService *services.MatchService, withUser bool) *gin.Engine {
+	return setupProfileRouterWithStorage(db, matchService, withUser, services.NewLocalMediaStorage("uploads"))
+}
+
+func setupProfileRouterWithStorage(db *sql.DB, matchService *services.MatchService, withUser bool, mediaStorage services.MediaStorage) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 	profileService := services.NewProfileService(db)
-	r.Use(middlewares.ServiceMiddleware(middlewares.Services{ProfileService: profileService, MatchService: matchService}))
+	r.Use(middlewares.ServiceMiddleware(middlewares.Services{
+		UserService:    services.NewUserService(db, nil),
+		ProfileService: profileService,
+		MatchService:   matchService,
+		MediaStorage:   mediaStorage,
+	}))
+	r.GET("/uploads/*key", controllers.ServeMedia)
 	if withUser {
 		r.Use(func(c *gin.Context) {
 			c.Set("username", "john")
+			c.Set("userID", 1)
 			c.Next()
 		})
 	}
 	r.POST("/profile", controllers.CreateProfile)
 	r.GET("/profile", controllers.GetProfile)
+	r.PATCH("/profile", controllers.PatchProfile)
 	r.GET("/profiles", controllers.GetProfiles)
+	r.GET("/profile/completeness", controllers.GetProfileCompleteness)
 	r.GET("/profile/:user_id", controllers.GetUserProfile)
+	r.GET("/profile/photos", controllers.ListProfilePhotos)
+	r.POST("/profile/photos", controllers.UploadProfilePhoto)
+	r.PUT("/profile/photos/order", controllers.ReorderProfilePhotos)
+	r.PUT("/profile/photos/:photo_id/primary", controllers.SetPrimaryProfilePhoto)
+	r.DELETE("/profile/photos/:photo_id", controllers.DeleteProfilePhoto)
+	r.GET("/profile/history", controllers.GetProfileHistory)
+	r.GET("/profile/views", controllers.GetProfileViews)
+	r.GET("/profile/views/settings", controllers.GetProfileViewSettings)
+	r.PUT("/profile/views/settings", controllers.UpdateProfileViewSettings)
+	r.GET("/admin/users/:user_id/profile/history", controllers.GetUserProfileHistory)
 	return r
 }
 
+// expectProfilePrivacy expects the lookups made to show ownerID's profile to viewerID: the owner's
+// stored field visibility and whether the two are connected.
+func expectProfilePrivacy(mock sqlmock.Sqlmock, viewerID, ownerID int, stored map[string]string, connected bool) {
+	rows := sqlmock.NewRows([]string{"user_id", "field", "visibility"})
+	for field, visibility := range stored {
+		rows.AddRow(ownerID, field, visibility)
+	}
+	mock.ExpectQuery("SELECT user_id, field, visibility FROM profile_field_visibility").
+		WithArgs(fmt.Sprintf("{%d}", ownerID)).
+		WillReturnRows(rows)
+	connections := sqlmock.NewRows([]string{"user_id"})
+	if connected {
+		connections.AddRow(ownerID)
+	}
+	mock.ExpectQuery("SELECT CASE WHEN sender_id = \\$1 THEN receiver_id ELSE sender_id END").
+		WithArgs(viewerID, fmt.Sprintf("{%d}", ownerID)).
+		WillReturnRows(connections)
+}
+
+// expectCompletenessStored expects userID's completeness to be scored from the gallery photos and,
+// unless score is negative, the new score to be saved.
+func expectCompletenessStored(mock sqlmock.Sqlmock, userID int, photos *sqlmock.Rows, score int) {
+	mock.ExpectQuery("SELECT id, user_id, url, medium_url, thumb_url, caption, position, is_primary, created_at, moderation_status FROM profile_photos WHERE user_id = \\$1 ORDER BY").
+		WithArgs(userID).
+		WillReturnRows(photos)
+	if score >= 0 {
+		mock.ExpectExec("UPDATE profiles SET completeness = \\$2 WHERE user_id = \\$1").
+			WithArgs(userID, score).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+}
+
+// expectCompletenessRefresh expects the stored profile of userID to be rescored after a gallery
+// change. A nil profile means the user has none yet.
+func expectCompletenessRefresh(mock sqlmock.Sqlmock, userID int, profile *sqlmock.Rows, photos *sqlmock.Rows, score int) {
+	if profile == nil {
+		mock.ExpectQuery("SELECT p.id, p.user_id").WithArgs(userID).WillReturnError(sql.ErrNoRows)
+		return
+	}
+	mock.ExpectQuery("SELECT p.id, p.user_id").WithArgs(userID).WillReturnRows(profile)
+	expectCompletenessStored(mock, userID, photos, score)
+}
+
+// expectProfileSaveLock expects a profile save to start a transaction that locks the user's row.
+func expectProfileSaveLock(mock sqlmock.Sqlmock, userID int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM users WHERE id = \\$1 FOR UPDATE").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+}
+
+// expectProfileHistory expects a version of userID's profile, saved by the user, to be recorded
+// with the given changes as JSON.
+func expectProfileHistory(mock sqlmock.Sqlmock, userID int, changes string) {
+	mock.ExpectQuery("INSERT INTO profile_history \\(user_id, version, changed_by, changes\\)").
+		WithArgs(userID, userID, []byte(changes)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "created_at"}).AddRow(1, 1, time.Now()))
+}
+
+// expectProfileView expects a view of userID's profile by viewerID to be recorded.
+func expectProfileView(mock sqlmock.Sqlmock, viewerID, userID int) {
+	mock.ExpectExec("INSERT INTO profile_views").
+		WithArgs(viewerID, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
 func mockProfileRows() *sqlmock.Rows {
+	return mockProfileRowsWith(nil)
+}
+
+// mockProfileRowsWith returns a single profile row whose columns default to empty values unless
+// overridden.
+func mockProfileRowsWith(overrides map[string]driver.Value) *sqlmock.Rows {
 	columns := []string{
 		"id", "user_id", "username", "bio", "gender", "date_of_birth", "location_legacy", "interests", "civil_status",
 		"religion", "religion_detail", "caste", "height_cm", "weight_kg", "dietary_preference", "smoking", "alcohol",
 		"languages", "phone_number", "contact_verified", "identity_verified", "country_code", "province", "district", "city", "postal_code", "highest_education", "field_of_study",
 		"institution", "employment_status", "occupation", "father_occupation", "mother_occupation", "siblings_count", "siblings",
 		"horoscope_available", "birth_time", "birth_place", "sinhala_raasi", "nakshatra", "horoscope",
-		"profile_image_url", "profile_image_thumb_url", "verified", "moderation_status", "last_active_at", "metadata",
+		"profile_image_url", "profile_image_thumb_url", "verified", "moderation_status", "completeness", "last_active_at", "metadata",
 		"created_at", "updated_at",
 	}
 	now := time.Now()
@@ -59,7 +155,7 @@ func mockProfileRows() *sqlmock.Rows {
 			row[i] = "john"
 		case "interests", "languages":
 			row[i] = pq.StringArray{}
-		case "height_cm", "weight_kg", "siblings_count":
+		case "height_cm", "weight_kg", "siblings_count", "completeness":
 			row[i] = 0
 		case "horoscope_available", "contact_verified", "identity_verified", "verified":
 			row[i] = false
@@ -68,6 +164,9 @@ func mockProfileRows() *sqlmock.Rows {
 		default:
 			row[i] = ""
 		}
+		if value, ok := overrides[column]; ok {
+			row[i] = value
+		}
 	}
 	return sqlmock.NewRows(columns).AddRow(row...)
 }
@@ -82,11 +181,12 @@ func TestCreateProfileSuccess(t *testing.T) {
 	mock.ExpectQuery("SELECT id FROM users WHERE username=\\$1 AND is_active = true").
 		WithArgs("john").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
-	mock.ExpectQuery("SELECT COALESCE\\(phone_number, ''\\), COALESCE\\(contact_verified, false\\), COALESCE\\(identity_verified, false\\), COALESCE\\(verified, false\\) FROM profiles WHERE user_id = \\$1").
+	expectProfileSaveLock(mock, 1)
+	mock.ExpectQuery("SELECT p.id, p.user_id").
 		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"phone_number", "contact_verified", "identity_verified", "verified"}))
+		WillReturnError(sql.ErrNoRows)
 
-	args := make([]driver.Value, 45)
+	args := make([]driver.Value, 44)
 	for i := range args {
 		args[i] = sqlmock.AnyArg()
 	}
@@ -96,6 +196,8 @@ func TestCreateProfileSuccess(t *testing.T) {
 	mock.ExpectQuery("SELECT p.id, p.user_id").
 		WithArgs(1).
 		WillReturnRows(mockProfileRows())
+	mock.ExpectCommit()
+	expectCompletenessStored(mock, 1, sqlmock.NewRows(profilePhotoColumns), -1)
 
 	payloadCh := make(chan map[string]any, 1)
 	errCh := make(chan error, 1)
@@ -146,6 +248,9 @@ func TestCreateProfileSuccess(t *testing.T) {
 		if userID, found := payload["user_id"]; !found || userID != float64(1) {
 			t.Fatalf("expected user_id 1 in match payload, got: %v", payload["user_id"])
 		}
+		if completeness, found := payload["completeness"]; !found || completeness != float64(0) {
+			t.Fatalf("expected the completeness score in match payload, got: %v", payload["completeness"])
+		}
 	case <-time.After(time.Second):
 		t.Fatalf("timed out waiting for match service payload")
 	}
@@ -154,6 +259,231 @@ func TestCreateProfileSuccess(t *testing.T) {
 	}
 }
 
+func TestPatchProfileUpdatesOnlyPresentFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	stored := map[string]driver.Value{
+		"bio":              "old bio",
+		"religion":         "Buddhist",
+		"caste":            "Karawa",
+		"interests":        pq.StringArray{"music"},
+		"phone_number":     "+94771234567",
+		"contact_verified": true,
+		"country_code":     "LK",
+	}
+	mock.ExpectQuery("SELECT id FROM users WHERE username=\\$1 AND is_active = true").
+		WithArgs("john").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT p.id, p.user_id").
+		WithArgs(1).
+		WillReturnRows(mockProfileRowsWith(stored))
+	mock.ExpectQuery("SELECT id FROM users WHERE username=\\$1 AND is_active = true").
+		WithArgs("john").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	expectProfileSaveLock(mock, 1)
+	mock.ExpectQuery("SELECT p.id, p.user_id").
+		WithArgs(1).
+		WillReturnRows(mockProfileRowsWith(stored))
+
+	args := make([]driver.Value, 44)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[1] = "new bio"       // bio
+	args[5] = nil             // interests
+	args[7] = "Buddhist"      // religion
+	args[16] = "+94771234567" // phone_number
+	args[17] = true           // contact_verified
+	args[19] = "LK"           // country_code
+	mock.ExpectExec("INSERT INTO profiles").
+		WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT p.id, p.user_id").
+		WithArgs(1).
+		WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"bio": "new bio", "religion": "Buddhist", "moderation_status": "pending"}))
+	expectProfileHistory(mock, 1, `[`+
+		`{"field":"bio","old_value":"old bio","new_value":"new bio"},`+
+		`{"field":"caste","old_value":"***","new_value":"","masked":true},`+
+		`{"field":"contact_verified","old_value":"true","new_value":"false"},`+
+		`{"field":"country_code","old_value":"LK","new_value":""},`+
+		`{"field":"interests","old_value":"[\"music\"]","new_value":""},`+
+		`{"field":"phone_number","old_value":"***67","new_value":"","masked":true}]`)
+	mock.ExpectExec("INSERT INTO moderation_items \\(user_id, kind, content\\)").
+		WithArgs(1, "bio", "new bio").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	// Bio and religion fill a third of about and half of religion: 15/3 + 5/2 rounds to 8.
+	expectCompletenessStored(mock, 1, sqlmock.NewRows(profilePhotoColumns), 8)
+	mock.ExpectExec("INSERT INTO profile_sync_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+	req := httptest.NewRequest(http.MethodPatch, "/profile", bytes.NewBufferString(`{"bio":"new bio","interests":null,"caste":null}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var profile map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if profile["bio"] != "new bio" || profile["moderation_status"] != "pending" || profile["completeness"] != float64(8) {
+		t.Fatalf("expected the updated profile with its bio waiting for review, got %v", profile)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestPatchProfileRollsBackWhenBioCannotBeQueued(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT id FROM users WHERE username=\\$1 AND is_active = true").
+			WithArgs("john").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		if i == 1 {
+			expectProfileSaveLock(mock, 1)
+		}
+		mock.ExpectQuery("SELECT p.id, p.user_id").
+			WithArgs(1).
+			WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"country_code": "LK"}))
+	}
+	mock.ExpectExec("INSERT INTO profiles").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT p.id, p.user_id").
+		WithArgs(1).
+		WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"bio": "new bio", "country_code": "LK", "moderation_status": "pending"}))
+	expectProfileHistory(mock, 1, `[{"field":"bio","old_value":"","new_value":"new bio"}]`)
+	mock.ExpectExec("INSERT INTO moderation_items \\(user_id, kind, content\\)").
+		WithArgs(1, "bio", "new bio").
+		WillReturnError(sql.ErrConnDone)
+	// The pending bio must not be saved without its place in the review queue.
+	mock.ExpectRollback()
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+	req := httptest.NewRequest(http.MethodPatch, "/profile", bytes.NewBufferString(`{"bio":"new bio"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestPatchProfileRejectsReadOnlyAndUnclearableFields(t *testing.T) {
+	tests := []struct {
+		body  string
+		field string
+		code  string
+	}{
+		{`{"verified":true}`, "verified", "read_only"},
+		{`{"gender":null}`, "gender", "not_clearable"},
+		{`{"phone_number":null}`, "phone_number", "not_clearable"},
+		{`{"nickname":"jo"}`, "nickname", "unknown_field"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.body, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			router := setupProfileRouter(db, services.NewMatchService(""), true)
+			req := httptest.NewRequest(http.MethodPatch, "/profile", bytes.NewBufferString(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+			}
+			assertValidationCodes(t, w.Body.Bytes(), map[string]string{tc.field: tc.code})
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateProfileReportsEveryInvalidField(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	for _, enumType := range []string{"civil_status_type", "dietary_pref_type", "habit_freq_type", "education_level_type", "employment_status_type"} {
+		mock.ExpectQuery("SELECT enumlabel FROM pg_enum").
+			WithArgs(enumType).
+			WillReturnRows(sqlmock.NewRows([]string{"enumlabel"}).AddRow("single"))
+	}
+
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+	form := url.Values{}
+	form.Set("height_cm", "abc")
+	form.Set("weight_kg", "500")
+	form.Set("date_of_birth", time.Now().AddDate(-17, 0, 0).Format("2006-01-02"))
+	form.Set("country_code", "lk")
+	form.Set("civil_status", "bogus")
+	req := httptest.NewRequest(http.MethodPost, "/profile", bytes.NewBufferString(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	assertValidationCodes(t, w.Body.Bytes(), map[string]string{
+		"height_cm":     "invalid_type",
+		"weight_kg":     "out_of_range",
+		"date_of_birth": "too_young",
+		"country_code":  "invalid_format",
+		"civil_status":  "invalid_choice",
+	})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+// assertValidationCodes checks that a 422 body reports exactly the expected code for each field.
+func assertValidationCodes(t *testing.T, body []byte, want map[string]string) {
+	t.Helper()
+	var resp utils.ValidationErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	got := make(map[string]string, len(resp.Fields))
+	for _, field := range resp.Fields {
+		got[field.Field] = field.Code
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected fields %v, got %v", want, got)
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Fatalf("expected %s to be rejected with %q, got %v", field, code, got)
+		}
+	}
+}
+
 func TestGetProfileSuccess(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -188,6 +518,49 @@ func TestGetProfileSuccess(t *testing.T) {
 	}
 }
 
+func TestGetProfileReturnsDateOfBirthAsDate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id FROM users WHERE username=\\$1 AND is_active = true").
+		WithArgs("john").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT p.id, p.user_id.*COALESCE\\(p.date_of_birth::text, ''\\)").
+		WithArgs(1).
+		WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"date_of_birth": "1990-05-01"}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"id":1,"userId":1}`))
+	}))
+	defer server.Close()
+
+	router := setupProfileRouter(db, services.NewMatchService(server.URL), true)
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		DateOfBirth string `json:"date_of_birth"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.DateOfBirth != "1990-05-01" {
+		t.Fatalf("expected date_of_birth 1990-05-01 got %q", body.DateOfBirth)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
 func TestGetProfilesSuccess(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -197,6 +570,7 @@ func TestGetProfilesSuccess(t *testing.T) {
 
 	mock.ExpectQuery("SELECT p.id, p.user_id").
 		WillReturnRows(mockProfileRows())
+	expectProfilePrivacy(mock, 0, 1, nil, false)
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -225,9 +599,12 @@ func TestGetProfilesWithFilters(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectQuery("SELECT p.id, p.user_id").
-		WithArgs("female", 30, true).
+	// The age only matches owners who share their date of birth with the viewer, falling back to
+	// the privacy settings' default for owners who never chose a visibility.
+	mock.ExpectQuery("SELECT p.id, p.user_id(.|\\n)*AGE\\(CURRENT_DATE, p.date_of_birth::date\\)\\) = \\$2 AND \\(p.user_id = \\$3 OR (.|\\n)*profile_field_visibility(.|\\n)*\\$4::text").
+		WithArgs("female", 30, 0, "everyone", true).
 		WillReturnRows(mockProfileRows())
+	expectProfilePrivacy(mock, 0, 1, nil, false)
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -283,6 +660,7 @@ func TestGetUserProfileSuccess(t *testing.T) {
 	mock.ExpectQuery("SELECT p.id, p.user_id").
 		WithArgs(2).
 		WillReturnRows(mockProfileRows())
+	expectProfilePrivacy(mock, 0, 1, nil, false)
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
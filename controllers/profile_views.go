@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+type updateProfileViewSettingsRequest struct {
+	Incognito *bool `json:"incognito" binding:"required"`
+}
+
+// GetProfileViews godoc
+// @Summary      List who viewed the authenticated user's profile
+// @Description  Returns the users who viewed the profile, most recent first, with how many days each viewed it, and the view counts. Views are counted once per viewer per day; views made in incognito mode are not shown or counted.
+// @Tags         Profiles
+// @Produce      json
+// @Param        limit   query     int  false  "Page size, 20 by default and at most 100"
+// @Param        offset  query     int  false  "Number of viewers to skip"
+// @Success      200     {object}  models.ProfileViews
+// @Failure      401     {object}  utils.ErrorResponse
+// @Failure      422     {object}  utils.ValidationErrorResponse
+// @Failure      500     {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/views [get]
+func GetProfileViews(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	var invalid utils.ValidationError
+	limit := queryInt(ctx, &invalid, "limit")
+	offset := queryInt(ctx, &invalid, "offset")
+	if len(invalid.Fields) > 0 {
+		utils.RespondValidationError(ctx, &invalid, "GetProfileViews invalid query")
+		return
+	}
+
+	views, err := profileService.ListProfileViews(userID, limit, offset)
+	if err != nil {
+		var validationErr *utils.ValidationError
+		if errors.As(err, &validationErr) {
+			utils.RespondValidationError(ctx, validationErr, "GetProfileViews invalid query")
+			return
+		}
+		logMsg := fmt.Sprintf("GetProfileViews service error for user %d", userID)
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to retrieve profile views")
+		return
+	}
+	utils.RespondSuccess(ctx, http.StatusOK, views)
+}
+
+// GetProfileViewSettings godoc
+// @Summary      Retrieve whether the authenticated user browses in incognito mode
+// @Tags         Profiles
+// @Produce      json
+// @Success      200  {object}  models.ProfileViewSettings
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/views/settings [get]
+func GetProfileViewSettings(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	settings, err := profileService.GetProfileViewSettings(userID)
+	if err != nil {
+		logMsg := fmt.Sprintf("GetProfileViewSettings service error for user %d", userID)
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to retrieve view settings")
+		return
+	}
+	utils.RespondSuccess(ctx, http.StatusOK, settings)
+}
+
+// UpdateProfileViewSettings godoc
+// @Summary      Switch incognito mode for the authenticated user
+// @Description  Profiles viewed in incognito mode do not show the caller among their viewers. The mode applies to views from then on; a profile already viewed publicly that day keeps showing the caller.
+// @Tags         Profiles
+// @Accept       json
+// @Produce      json
+// @Param        settings  body      models.ProfileViewSettings  true  "View settings"
+// @Success      200       {object}  models.ProfileViewSettings
+// @Failure      400       {object}  utils.ErrorResponse
+// @Failure      401       {object}  utils.ErrorResponse
+// @Failure      500       {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/views/settings [put]
+func UpdateProfileViewSettings(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	var req updateProfileViewSettingsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "UpdateProfileViewSettings bind error", "Invalid input")
+		return
+	}
+
+	settings, err := profileService.UpdateProfileViewSettings(userID, models.ProfileViewSettings{Incognito: *req.Incognito})
+	if err != nil {
+		logMsg := fmt.Sprintf("UpdateProfileViewSettings service error for user %d", userID)
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to update view settings")
+		return
+	}
+	utils.RespondSuccess(ctx, http.StatusOK, settings)
+}
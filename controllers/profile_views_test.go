@@ -0,0 +1,203 @@
+package controllers_test
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/icpinto/dating-app/services"
+)
+
+func TestGetProfileViewsListsViewersWithCounts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), COUNT\\(DISTINCT v.viewer_id\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "unique", "recent"}).AddRow(5, 3, 2))
+	mock.ExpectQuery("SELECT v.viewer_id, u.username, COUNT\\(\\*\\), MAX\\(v.viewed_at\\) FROM profile_views v").
+		WithArgs(1, 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"viewer_id", "username", "count", "last_viewed_at"}).
+			AddRow(4, "amal", 2, time.Now()).
+			AddRow(7, "nimali", 1, time.Now().Add(-time.Hour)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/views?limit=2&offset=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		TotalViews     int `json:"total_views"`
+		UniqueViewers  int `json:"unique_viewers"`
+		ViewsLast7Days int `json:"views_last_7_days"`
+		Viewers        []struct {
+			UserID    int    `json:"user_id"`
+			Username  string `json:"username"`
+			ViewCount int    `json:"view_count"`
+		} `json:"viewers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if resp.TotalViews != 5 || resp.UniqueViewers != 3 || resp.ViewsLast7Days != 2 {
+		t.Fatalf("expected the view counts, got %+v", resp)
+	}
+	if len(resp.Viewers) != 2 || resp.Viewers[0].Username != "amal" || resp.Viewers[0].ViewCount != 2 || resp.Viewers[1].UserID != 7 {
+		t.Fatalf("expected the viewers most recent first, got %+v", resp.Viewers)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestGetProfileViewsRejectsInvalidPaging(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/views?limit=101&offset=-5", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422 got %d: %s", w.Code, w.Body.String())
+	}
+	assertValidationCodes(t, w.Body.Bytes(), map[string]string{"limit": "out_of_range", "offset": "out_of_range"})
+}
+
+func TestProfileViewSettings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+	mock.ExpectQuery("SELECT incognito FROM profile_view_settings WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"incognito"}))
+	mock.ExpectExec("INSERT INTO profile_view_settings \\(user_id, incognito\\)").
+		WithArgs(1, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/views/settings", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"incognito":false}` {
+		t.Fatalf("expected incognito to be off by default, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/profile/views/settings", bytes.NewBufferString(`{"incognito":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != `{"incognito":true}` {
+		t.Fatalf("expected incognito to be on, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/profile/views/settings", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestProfileViewStaysPublicWhenIncognitoIsToggled(t *testing.T) {
+	tests := []struct {
+		name  string
+		first bool
+	}{
+		{name: "incognito then public view", first: true},
+		{name: "public then incognito view", first: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+			router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+			// Both views of the day land on one row, which only stays hidden while every view
+			// was incognito.
+			expectView := func() {
+				mock.ExpectQuery("SELECT p.id, p.user_id").
+					WithArgs(2).
+					WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"id": 2, "user_id": 2}))
+				expectProfilePrivacy(mock, 1, 2, nil, false)
+				mock.ExpectExec("INSERT INTO profile_views(.|\\n)*ON CONFLICT \\(viewed_id, viewer_id, view_date\\)(.|\\n)*incognito = profile_views.incognito AND EXCLUDED.incognito").
+					WithArgs(1, 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			expectView()
+			mock.ExpectExec("INSERT INTO profile_view_settings \\(user_id, incognito\\)").
+				WithArgs(1, !tt.first).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			expectView()
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/2", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+			}
+			w = httptest.NewRecorder()
+			body, _ := json.Marshal(map[string]bool{"incognito": !tt.first})
+			req := httptest.NewRequest(http.MethodPut, "/profile/views/settings", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+			}
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/2", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetUserProfileSucceedsWhenViewCannotBeRecorded(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+	router := setupProfileRouter(db, services.NewMatchService(""), true)
+
+	mock.ExpectQuery("SELECT p.id, p.user_id").
+		WithArgs(2).
+		WillReturnRows(mockProfileRowsWith(map[string]driver.Value{"id": 2, "user_id": 2}))
+	expectProfilePrivacy(mock, 1, 2, nil, false)
+	mock.ExpectExec("INSERT INTO profile_views").
+		WithArgs(1, 2).
+		WillReturnError(errors.New("connection reset"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile/2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
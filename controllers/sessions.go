@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// ListSessions godoc
+// @Summary      List active sessions
+// @Description  Returns the sessions of the current user that are neither revoked nor expired, most recently used first. The session making the request is flagged as current. Last used time and IP address are updated whenever the session's token is refreshed.
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  utils.SessionsResponse
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /user/sessions [get]
+// @Security     BearerAuth
+func ListSessions(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	sessions, err := userService.ListSessions(ctx.GetInt("userID"), ctx.GetString("sessionID"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "ListSessions service error", "Could not retrieve sessions")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.SessionsResponse{Sessions: sessions})
+}
+
+// RevokeSession godoc
+// @Summary      Revoke a session
+// @Description  Sign out one session of the current user. Its refresh token stops working immediately and its access token is rejected on the next request.
+// @Tags         User
+// @Produce      json
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  utils.MessageResponse
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      404  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /user/sessions/{id} [delete]
+// @Security     BearerAuth
+func RevokeSession(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	sessionID := ctx.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		utils.RespondError(ctx, http.StatusNotFound, err, "RevokeSession invalid id", "Session not found")
+		return
+	}
+
+	if err := userService.RevokeSession(ctx.GetInt("userID"), sessionID); err != nil {
+		if errors.Is(err, repositories.ErrSessionNotFound) {
+			utils.RespondError(ctx, http.StatusNotFound, err, "RevokeSession not found", "Session not found")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "RevokeSession service error", "Could not revoke session")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeAllSessions godoc
+// @Summary      Revoke all sessions
+// @Description  Sign out every session of the current user. With except_current=true the session making the request stays signed in.
+// @Tags         User
+// @Produce      json
+// @Param        except_current  query     bool  false  "Keep the current session"
+// @Success      200             {object}  utils.RevokedSessionsResponse
+// @Failure      401             {object}  utils.ErrorResponse
+// @Failure      500             {object}  utils.ErrorResponse
+// @Router       /user/sessions [delete]
+// @Security     BearerAuth
+func RevokeAllSessions(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+
+	exceptID := ""
+	if ctx.Query("except_current") == "true" {
+		exceptID = ctx.GetString("sessionID")
+	}
+
+	revoked, err := userService.RevokeAllSessions(ctx.GetInt("userID"), exceptID)
+	if err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "RevokeAllSessions service error", "Could not revoke sessions")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.RevokedSessionsResponse{Message: "Sessions revoked", Revoked: revoked})
+}
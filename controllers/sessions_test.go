@@ -0,0 +1,197 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/icpinto/dating-app/utils"
+)
+
+const otherSessionID = "5c1d2e3f-4a5b-4c6d-8e7f-9a0b1c2d3e4f"
+
+func expectAuthenticatedSession(mock sqlmock.Sqlmock, sessionID string, userID int) {
+	mock.ExpectQuery("SELECT EXISTS \\(\\s*SELECT 1 FROM user_sessions").
+		WithArgs(sessionID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("john"))
+	expectEmailVerified(mock, userID)
+}
+
+func sessionRequest(t *testing.T, method, target, sessionID string) *http.Request {
+	t.Helper()
+	token, err := utils.GenerateSessionToken(1, sessionID)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", token)
+	return req
+}
+
+func TestListSessionsFlagsCurrentSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	mock.ExpectQuery("SELECT id, user_id, device_label, user_agent, ip_address, created_at, last_used_at, expires_at\\s+FROM user_sessions").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "device_label", "user_agent", "ip_address", "created_at", "last_used_at", "expires_at"}).
+			AddRow(otherSessionID, 1, "Safari on iOS", "Mozilla/5.0 (iPhone)", "198.51.100.7", now, now, now.Add(time.Hour)).
+			AddRow(testSessionID, 1, "Firefox on Linux", "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0", testClientIP, now, now, now.Add(time.Hour)))
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, sessionRequest(t, http.MethodGet, "/user/sessions", testSessionID))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Sessions []struct {
+			ID          string `json:"id"`
+			DeviceLabel string `json:"device_label"`
+			IPAddress   string `json:"ip_address"`
+			Current     bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if len(resp.Sessions) != 2 {
+		t.Fatalf("expected 2 sessions got %d", len(resp.Sessions))
+	}
+	if resp.Sessions[0].Current || resp.Sessions[0].DeviceLabel != "Safari on iOS" {
+		t.Fatalf("unexpected first session: %+v", resp.Sessions[0])
+	}
+	if !resp.Sessions[1].Current || resp.Sessions[1].IPAddress != testClientIP {
+		t.Fatalf("expected second session to be current: %+v", resp.Sessions[1])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestRevokeSessionEndsOtherSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE id = \\$1 AND user_id = \\$2").
+		WithArgs(otherSessionID, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, sessionRequest(t, http.MethodDelete, "/user/sessions/"+otherSessionID, testSessionID))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestRevokeSessionNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	// A session of another user matches no rows, same as an unknown or already revoked one.
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE id = \\$1 AND user_id = \\$2").
+		WithArgs(otherSessionID, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectAuthenticatedSession(mock, testSessionID, 1)
+
+	router := setupRouter(db)
+	for _, target := range []string{"/user/sessions/" + otherSessionID, "/user/sessions/not-a-uuid"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, sessionRequest(t, http.MethodDelete, target, testSessionID))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected status 404 got %d: %s", target, w.Code, w.Body.String())
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestRevokeAllSessionsCanKeepCurrentSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE user_id = \\$1 AND revoked_at IS NULL AND id::text <> \\$2").
+		WithArgs(1, testSessionID).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	mock.ExpectExec("UPDATE user_sessions\\s+SET revoked_at = NOW\\(\\)\\s+WHERE user_id = \\$1 AND revoked_at IS NULL AND id::text <> \\$2").
+		WithArgs(1, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	router := setupRouter(db)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, sessionRequest(t, http.MethodDelete, "/user/sessions?except_current=true", testSessionID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp utils.RevokedSessionsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if resp.Revoked != 3 {
+		t.Fatalf("expected 3 revoked sessions got %d", resp.Revoked)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, sessionRequest(t, http.MethodDelete, "/user/sessions", testSessionID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestRevokedSessionIsRejectedOnNextRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT EXISTS \\(\\s*SELECT 1 FROM user_sessions").
+		WithArgs(otherSessionID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	router := setupRouter(db)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, sessionRequest(t, http.MethodGet, "/user/sessions", otherSessionID))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
+)
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type disableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// CompleteTwoFactorLogin godoc
+// @Summary      Complete a two-factor login
+// @Description  Exchange the challenge token returned by /login and a TOTP or recovery code for a session.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      twoFactorLoginRequest  true  "Challenge token and code"
+// @Success      200      {object}  utils.TokenResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      429      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /login/2fa [post]
+func CompleteTwoFactorLogin(ctx *gin.Context) {
+	userService := ctx.MustGet("userService").(*services.UserService)
+	twoFactorService := ctx.MustGet("twoFactorService").(*services.TwoFactorService)
+
+	var req twoFactorLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "CompleteTwoFactorLogin bind error", "Invalid input")
+		return
+	}
+
+	userID, err := twoFactorService.CompleteLogin(ctx.Request.Context(), req.ChallengeToken, req.Code, ctx.ClientIP())
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			utils.RespondError(ctx, http.StatusTooManyRequests, err, "CompleteTwoFactorLogin throttled", "Too many failed login attempts, try again later")
+		case errors.Is(err, utils.ErrInvalidToken):
+			utils.RespondError(ctx, http.StatusUnauthorized, err, "CompleteTwoFactorLogin invalid challenge", "Invalid or expired challenge token")
+		case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrTwoFactorNotEnabled):
+			utils.RespondError(ctx, http.StatusUnauthorized, err, "CompleteTwoFactorLogin invalid code", "Invalid two-factor code")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, "CompleteTwoFactorLogin service error", "Login failed")
+		}
+		return
+	}
+
+	tokens, err := userService.CreateSession(userID, ctx.Request.UserAgent(), ctx.ClientIP())
+	if err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "CompleteTwoFactorLogin session creation error", "Token generation failed")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.NewTokenResponse(tokens))
+}
+
+// GetTwoFactorStatus godoc
+// @Summary      Retrieve two-factor status
+// @Description  Returns whether two-factor authentication is on and how many recovery codes are unused.
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  models.TwoFactorStatus
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /user/2fa [get]
+// @Security     BearerAuth
+func GetTwoFactorStatus(ctx *gin.Context) {
+	twoFactorService := ctx.MustGet("twoFactorService").(*services.TwoFactorService)
+
+	status, err := twoFactorService.Status(ctx.GetInt("userID"))
+	if err != nil {
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "GetTwoFactorStatus service error", "Could not retrieve two-factor status")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, status)
+}
+
+// EnrollTwoFactor godoc
+// @Summary      Start two-factor enrollment
+// @Description  Generate a TOTP secret and its otpauth URI. Two-factor authentication is only enabled once a code is confirmed.
+// @Tags         User
+// @Produce      json
+// @Success      200  {object}  utils.TwoFactorEnrollmentResponse
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      409  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Router       /user/2fa/enroll [post]
+// @Security     BearerAuth
+func EnrollTwoFactor(ctx *gin.Context) {
+	twoFactorService := ctx.MustGet("twoFactorService").(*services.TwoFactorService)
+
+	secret, uri, err := twoFactorService.Enroll(ctx.GetInt("userID"))
+	if err != nil {
+		if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+			utils.RespondError(ctx, http.StatusConflict, err, "EnrollTwoFactor already enabled", "Two-factor authentication is already enabled")
+			return
+		}
+		utils.RespondError(ctx, http.StatusInternalServerError, err, "EnrollTwoFactor service error", "Could not start two-factor enrollment")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.TwoFactorEnrollmentResponse{Secret: secret, OTPAuthURI: uri})
+}
+
+// ConfirmTwoFactor godoc
+// @Summary      Confirm two-factor enrollment
+// @Description  Enable two-factor authentication with a code from the authenticator app and return recovery codes. The codes are not shown again.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      twoFactorCodeRequest  true  "TOTP code"
+// @Success      200      {object}  utils.RecoveryCodesResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      429      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /user/2fa/confirm [post]
+// @Security     BearerAuth
+func ConfirmTwoFactor(ctx *gin.Context) {
+	twoFactorService := ctx.MustGet("twoFactorService").(*services.TwoFactorService)
+
+	var req twoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "ConfirmTwoFactor bind error", "Invalid input")
+		return
+	}
+
+	codes, err := twoFactorService.Confirm(ctx.Request.Context(), ctx.GetInt("userID"), req.Code, ctx.ClientIP())
+	if err != nil {
+		respondTwoFactorError(ctx, err, "ConfirmTwoFactor", "Could not enable two-factor authentication")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary      Regenerate recovery codes
+// @Description  Replace every recovery code with a new set after checking a current TOTP code.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      twoFactorCodeRequest  true  "TOTP code"
+// @Success      200      {object}  utils.RecoveryCodesResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      429      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /user/2fa/recovery-codes [post]
+// @Security     BearerAuth
+func RegenerateRecoveryCodes(ctx *gin.Context) {
+	twoFactorService := ctx.MustGet("twoFactorService").(*services.TwoFactorService)
+
+	var req twoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "RegenerateRecoveryCodes bind error", "Invalid input")
+		return
+	}
+
+	codes, err := twoFactorService.RegenerateRecoveryCodes(ctx.Request.Context(), ctx.GetInt("userID"), req.Code, ctx.ClientIP())
+	if err != nil {
+		respondTwoFactorError(ctx, err, "RegenerateRecoveryCodes", "Could not regenerate recovery codes")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, utils.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor godoc
+// @Summary      Disable two-factor authentication
+// @Description  Turn two-factor authentication off. Requires the password and a TOTP or recovery code. Wrong passwords and codes count as failed logins, so repeated failures are answered with 429 and a Retry-After header.
+// @Tags         User
+// @Accept       json
+// @Produce      json
+// @Param        payload  body      disableTwoFactorRequest  true  "Password and code"
+// @Success      200      {object}  utils.MessageResponse
+// @Failure      400      {object}  utils.ErrorResponse
+// @Failure      401      {object}  utils.ErrorResponse
+// @Failure      409      {object}  utils.ErrorResponse
+// @Failure      429      {object}  utils.ErrorResponse
+// @Failure      500      {object}  utils.ErrorResponse
+// @Router       /user/2fa [delete]
+// @Security     BearerAuth
+func DisableTwoFactor(ctx *gin.Context) {
+	twoFactorService := ctx.MustGet("twoFactorService").(*services.TwoFactorService)
+
+	var req disableTwoFactorRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "DisableTwoFactor bind error", "Invalid input")
+		return
+	}
+
+	if err := twoFactorService.Disable(ctx.Request.Context(), ctx.GetInt("userID"), req.Password, req.Code, ctx.ClientIP()); err != nil {
+		respondTwoFactorError(ctx, err, "DisableTwoFactor", "Could not disable two-factor authentication")
+		return
+	}
+
+	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func respondTwoFactorError(ctx *gin.Context, err error, handler, clientMsg string) {
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		utils.RespondError(ctx, http.StatusTooManyRequests, err, handler+" throttled", "Too many failed attempts, try again later")
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		utils.RespondError(ctx, http.StatusUnauthorized, err, handler+" invalid code", "Invalid two-factor code")
+	case errors.Is(err, services.ErrInvalidCredentials):
+		utils.RespondError(ctx, http.StatusUnauthorized, err, handler+" invalid password", "Invalid credentials")
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		utils.RespondError(ctx, http.StatusConflict, err, handler+" not enabled", "Two-factor authentication is not enabled")
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		utils.RespondError(ctx, http.StatusConflict, err, handler+" already enabled", "Two-factor authentication is already enabled")
+	default:
+		utils.RespondError(ctx, http.StatusInternalServerError, err, handler+" service error", clientMsg)
+	}
+}
@@ -0,0 +1,314 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/utils"
+)
+
+func expectTOTPEnrollment(mock sqlmock.Sqlmock, userID int, secret string, lastUsedStep int64) {
+	encrypted, err := utils.EncryptSecret(secret)
+	if err != nil {
+		panic(err)
+	}
+	mock.ExpectQuery("SELECT secret_encrypted, confirmed_at, last_used_step\\s+FROM user_totp").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"secret_encrypted", "confirmed_at", "last_used_step"}).
+			AddRow(encrypted, time.Now().Add(-24*time.Hour), lastUsedStep))
+}
+
+func TestLoginReturnsChallengeWhenTwoFactorEnabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	hashed, err := utils.HashPassword("pass")
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT id, password FROM users WHERE username=\\$1").
+		WithArgs("john").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password"}).AddRow(1, hashed))
+	expectLoginNotThrottled(mock, "user:1")
+	mock.ExpectExec("DELETE FROM login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectTwoFactorEnabled(mock, 1, true)
+
+	router := setupRouter(db)
+
+	body := []byte(`{"username":"john","password":"pass"}`)
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	var resp utils.TwoFactorChallengeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+	if !resp.TwoFactorRequired || resp.ChallengeToken == "" {
+		t.Fatalf("expected a two-factor challenge, got: %s", w.Body.String())
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("refresh_token")) {
+		t.Fatalf("no session must be created before the second factor: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestCompleteTwoFactorLoginWithTOTPCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("secret error: %v", err)
+	}
+	step := utils.TOTPStep(time.Now())
+	code, err := utils.TOTPCode(secret, step)
+	if err != nil {
+		t.Fatalf("code error: %v", err)
+	}
+	challenge, err := utils.GenerateChallengeToken(1)
+	if err != nil {
+		t.Fatalf("challenge error: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("john"))
+	expectLoginNotThrottled(mock, "user:1")
+	expectTOTPEnrollment(mock, 1, secret, 0)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE user_totp\\s+SET last_used_step = \\$2").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("DELETE FROM login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO user_sessions").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRoles(mock, 1)
+
+	router := setupRouter(db)
+
+	body, _ := json.Marshal(map[string]string{"challenge_token": challenge, "code": code})
+	req := httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("refresh_token")) {
+		t.Fatalf("expected a token pair: %s", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestCompleteTwoFactorLoginRejectsReplayedCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("secret error: %v", err)
+	}
+	step := utils.TOTPStep(time.Now())
+	code, err := utils.TOTPCode(secret, step)
+	if err != nil {
+		t.Fatalf("code error: %v", err)
+	}
+	challenge, err := utils.GenerateChallengeToken(1)
+	if err != nil {
+		t.Fatalf("challenge error: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("john"))
+	expectLoginNotThrottled(mock, "user:1")
+	// The code was already accepted once, so its step is recorded as used.
+	expectTOTPEnrollment(mock, 1, secret, step+1)
+	mock.ExpectBegin()
+	expectLoginFailure(mock, "user:1", 1, 1)
+	mock.ExpectRollback()
+
+	router := setupRouter(db)
+
+	body, _ := json.Marshal(map[string]string{"challenge_token": challenge, "code": code})
+	req := httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestCompleteTwoFactorLoginWithRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	challenge, err := utils.GenerateChallengeToken(1)
+	if err != nil {
+		t.Fatalf("challenge error: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("john"))
+	expectLoginNotThrottled(mock, "user:1")
+	expectTOTPEnrollment(mock, 1, "JBSWY3DPEHPK3PXP", 0)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE user_recovery_codes\\s+SET used_at = NOW\\(\\)").
+		WithArgs(1, utils.HashToken("abcdefghij")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO user_audit_outbox").
+		WithArgs(sqlmock.AnyArg(), 1, "recovery_code_used", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("DELETE FROM login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO user_sessions").
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRoles(mock, 1)
+
+	router := setupRouter(db)
+
+	body, _ := json.Marshal(map[string]string{"challenge_token": challenge, "code": "ABCDE-FGHIJ"})
+	req := httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestCompleteTwoFactorLoginRejectsAccessToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	accessToken, err := utils.GenerateSessionToken(1, testSessionID)
+	if err != nil {
+		t.Fatalf("token error: %v", err)
+	}
+
+	router := setupRouter(db)
+
+	body, _ := json.Marshal(map[string]string{"challenge_token": accessToken, "code": "123456"})
+	req := httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestDisableTwoFactorLocksOutRepeatedWrongCodes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("secret error: %v", err)
+	}
+	hashed, err := utils.HashPassword("pass")
+	if err != nil {
+		t.Fatalf("hash error: %v", err)
+	}
+
+	// The last allowed wrong code locks the account...
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	expectLoginNotThrottled(mock, "user:1")
+	mock.ExpectQuery("SELECT password FROM users WHERE id=\\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(hashed))
+	// Every current step counts as used, so no code can be accepted.
+	expectTOTPEnrollment(mock, 1, secret, utils.TOTPStep(time.Now())+1)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(10))
+	mock.ExpectExec("UPDATE login_attempts\\s+SET locked_until = \\$3").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO login_attempts").
+		WithArgs(repositories.LoginAttemptScopeIP, testClientIP, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+	mock.ExpectRollback()
+	// ...so the next attempt is turned away before the password or code is checked.
+	expectAuthenticatedSession(mock, testSessionID, 1)
+	mock.ExpectQuery("SELECT MAX\\(locked_until\\)\\s+FROM login_attempts").
+		WithArgs(repositories.LoginAttemptScopeUsername, "user:1", repositories.LoginAttemptScopeIP, testClientIP).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(time.Now().Add(90 * time.Second)))
+
+	router := setupRouter(db)
+	for _, want := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req := sessionRequest(t, http.MethodDelete, "/user/2fa", testSessionID)
+		req.Body = io.NopCloser(strings.NewReader(`{"password":"pass","code":"000000"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Fatalf("expected status %d got %d: %s", want, w.Code, w.Body.String())
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
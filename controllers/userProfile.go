@@ -5,11 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/icpinto/dating-app/models"
@@ -27,9 +24,37 @@ func filterEmptyStrings(values []string) []string {
 	return result
 }
 
+// postFormInt reads an optional whole number from the form. Missing values are zero; values that
+// are not numbers are recorded in v.
+func postFormInt(ctx *gin.Context, v *utils.ValidationError, field string) int {
+	raw := strings.TrimSpace(ctx.PostForm(field))
+	if raw == "" {
+		return 0
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		v.Add(field, "invalid_type", "Value must be a whole number")
+	}
+	return value
+}
+
+// queryInt parses an optional integer query parameter, recording invalid_type when it is not a
+// whole number. Missing parameters are zero.
+func queryInt(ctx *gin.Context, v *utils.ValidationError, field string) int {
+	raw := ctx.Query(field)
+	if raw == "" {
+		return 0
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		v.Add(field, "invalid_type", "Value must be a whole number")
+	}
+	return value
+}
+
 // CreateProfile godoc
 // @Summary      Create or update the authenticated user's profile
-// @Description  Updates the profile information for the authenticated user. Supports multipart form data with optional profile image upload.
+// @Description  Updates the profile information for the authenticated user. Supports multipart form data with optional profile image upload. Invalid values are answered with 422 and one entry per rejected field: enums must be one of the values from /profile/enums, the date of birth must be YYYY-MM-DD and at least 18 years ago, height must be 80-250 cm, weight 30-300 kg, country_code two uppercase letters, birth_time HH:MM[:SS] and siblings/horoscope JSON objects.
 // @Tags         Profiles
 // @Accept       multipart/form-data
 // @Produce      json
@@ -49,10 +74,12 @@ func filterEmptyStrings(values []string) []string {
 // @Param        occupation            formData  string false "Occupation"
 // @Param        siblings_count        formData  int    false "Number of siblings"
 // @Param        horoscope_available   formData  bool   false "Whether a horoscope is available"
-// @Param        profile_image         formData  file   false "Profile image"
+// @Param        profile_image         formData  file   false "Profile image, added to the gallery as the primary photo and queued for moderation"
 // @Success      200                   {object}  utils.MessageResponse
 // @Failure      400                   {object}  utils.ErrorResponse
 // @Failure      401                   {object}  utils.ErrorResponse
+// @Failure      409                   {object}  utils.ErrorResponse
+// @Failure      422                   {object}  utils.ValidationErrorResponse
 // @Failure      500                   {object}  utils.ErrorResponse
 // @Security     BearerAuth
 // @Router       /user/profile [post]
@@ -66,6 +93,7 @@ func CreateProfile(ctx *gin.Context) {
 	profileService := ctx.MustGet("profileService").(*services.ProfileService)
 	matchService := ctx.MustGet("matchService").(*services.MatchService)
 
+	var invalid utils.ValidationError
 	var profile models.Profile
 	profile.Bio = ctx.PostForm("bio")
 	profile.Gender = ctx.PostForm("gender")
@@ -76,12 +104,8 @@ func CreateProfile(ctx *gin.Context) {
 	profile.Religion = ctx.PostForm("religion")
 	profile.ReligionDetail = ctx.PostForm("religion_detail")
 	profile.Caste = ctx.PostForm("caste")
-	if v, err := strconv.Atoi(ctx.DefaultPostForm("height_cm", "0")); err == nil {
-		profile.HeightCM = v
-	}
-	if v, err := strconv.Atoi(ctx.DefaultPostForm("weight_kg", "0")); err == nil {
-		profile.WeightKG = v
-	}
+	profile.HeightCM = postFormInt(ctx, &invalid, "height_cm")
+	profile.WeightKG = postFormInt(ctx, &invalid, "weight_kg")
 	profile.DietaryPreference = ctx.PostForm("dietary_preference")
 	profile.Smoking = ctx.PostForm("smoking")
 	profile.Alcohol = ctx.PostForm("alcohol")
@@ -98,11 +122,13 @@ func CreateProfile(ctx *gin.Context) {
 	profile.Occupation = ctx.PostForm("occupation")
 	profile.FatherOccupation = ctx.PostForm("father_occupation")
 	profile.MotherOccupation = ctx.PostForm("mother_occupation")
-	if v, err := strconv.Atoi(ctx.DefaultPostForm("siblings_count", "0")); err == nil {
-		profile.SiblingsCount = v
-	}
+	profile.SiblingsCount = postFormInt(ctx, &invalid, "siblings_count")
 	profile.Siblings = ctx.PostForm("siblings")
-	if v, err := strconv.ParseBool(ctx.DefaultPostForm("horoscope_available", "false")); err == nil {
+	if raw := strings.TrimSpace(ctx.PostForm("horoscope_available")); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			invalid.Add("horoscope_available", "invalid_type", "Value must be true or false")
+		}
 		profile.HoroscopeAvailable = v
 	}
 	profile.BirthTime = ctx.PostForm("birth_time")
@@ -111,21 +137,32 @@ func CreateProfile(ctx *gin.Context) {
 	profile.Nakshatra = ctx.PostForm("nakshatra")
 	profile.Horoscope = ctx.PostForm("horoscope")
 
-	file, err := ctx.FormFile("profile_image")
-	if err == nil {
-		if err := os.MkdirAll("uploads", os.ModePerm); err != nil {
-			utils.RespondError(ctx, http.StatusInternalServerError, err, "CreateProfile mkdir error", "Failed to save image")
+	// Report unparsable numbers together with every other problem in the form.
+	if len(invalid.Fields) > 0 {
+		if err := profileService.ValidateProfile(&invalid, profile); err != nil {
+			utils.RespondError(ctx, http.StatusInternalServerError, err, "CreateProfile validation error", "Failed to update profile")
 			return
 		}
-		filename := fmt.Sprintf("%d_%s", time.Now().Unix(), filepath.Base(file.Filename))
-		dst := filepath.Join("uploads", filename)
-		if err := ctx.SaveUploadedFile(file, dst); err != nil {
+		utils.RespondValidationError(ctx, &invalid, "CreateProfile validation error")
+		return
+	}
+
+	// The image is stored up front so a rejected upload fails before the profile changes; it joins
+	// the gallery once the profile is saved.
+	var mediaStorage services.MediaStorage
+	var image *storedImage
+	if file, err := ctx.FormFile("profile_image"); err == nil {
+		mediaStorage = ctx.MustGet("mediaStorage").(services.MediaStorage)
+		stored, err := storeUploadedImage(ctx, mediaStorage, file)
+		if err != nil {
+			if invalid := imageUploadError("profile_image", err); invalid != nil {
+				utils.RespondValidationError(ctx, invalid, "CreateProfile image rejected")
+				return
+			}
 			utils.RespondError(ctx, http.StatusInternalServerError, err, "CreateProfile save error", "Failed to save image")
 			return
 		}
-		url := fmt.Sprintf("http://%s/uploads/%s", ctx.Request.Host, filename)
-		profile.ProfileImageURL = url
-		profile.ProfileImageThumbURL = url
+		image = &stored
 	}
 
 	phoneNumber := ctx.PostForm("phone_number")
@@ -140,7 +177,15 @@ func CreateProfile(ctx *gin.Context) {
 
 	persistedProfile, err := profileService.CreateOrUpdateProfile(username.(string), profile, phoneNumber, contactToken, identityToken)
 	if err != nil {
+		if image != nil {
+			discardStoredImage(ctx, mediaStorage, profileService, *image)
+		}
 		logMsg := fmt.Sprintf("CreateProfile service error for %s", username.(string))
+		var validationErr *utils.ValidationError
+		if errors.As(err, &validationErr) {
+			utils.RespondValidationError(ctx, validationErr, logMsg)
+			return
+		}
 		status := http.StatusInternalServerError
 		clientMsg := "Failed to update profile"
 		if errors.Is(err, services.ErrInvalidEnum) {
@@ -157,6 +202,10 @@ func CreateProfile(ctx *gin.Context) {
 		return
 	}
 
+	if image != nil && !addPrimaryProfileImage(ctx, mediaStorage, profileService, persistedProfile.UserID, *image) {
+		return
+	}
+
 	if _, err := matchService.UpsertProfile(ctx.Request.Context(), persistedProfile); err != nil {
 		log.Printf("CreateProfile match service upsert error for user %s: %v", username.(string), err)
 		if enqueueErr := profileService.EnqueueProfileSync(persistedProfile.UserID); enqueueErr != nil {
@@ -167,6 +216,83 @@ func CreateProfile(ctx *gin.Context) {
 	utils.RespondSuccess(ctx, http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
 
+// addPrimaryProfileImage adds an image uploaded with the profile form to the gallery as the primary
+// photo, queued for moderation like any other upload. It responds and returns false on failure.
+func addPrimaryProfileImage(ctx *gin.Context, mediaStorage services.MediaStorage, profileService *services.ProfileService, userID int, image storedImage) bool {
+	photo, err := profileService.AddProfilePhoto(ctx.Request.Context(), userID, models.ProfilePhoto{
+		URL:       image.Key,
+		MediumURL: image.MediumKey,
+		ThumbURL:  image.ThumbKey,
+	})
+	if err != nil {
+		discardStoredImage(ctx, mediaStorage, profileService, image)
+	} else if !photo.IsPrimary {
+		_, err = profileService.SetPrimaryProfilePhoto(ctx.Request.Context(), userID, photo.ID)
+	}
+	if err != nil {
+		logMsg := fmt.Sprintf("CreateProfile profile image error for user %d", userID)
+		if errors.Is(err, services.ErrPhotoLimitReached) {
+			utils.RespondError(ctx, http.StatusConflict, err, logMsg, "Photo limit reached")
+		} else {
+			utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to save image")
+		}
+		return false
+	}
+	return true
+}
+
+// PatchProfile godoc
+// @Summary      Partially update the authenticated user's profile
+// @Description  Applies a JSON merge patch to the profile: members that are present replace the stored value, null clears it and missing members are left alone. Gender and phone_number cannot be cleared, and clearing country_code resets it to LK. phone_number, contact_verification_token and identity_verification_token follow the same verification rules as POST /user/profile. Profile images are not part of the patch. Unknown, read-only or mistyped members and a resulting profile that fails validation are answered with 422. The updated profile is returned and queued for synchronization with the matching service.
+// @Tags         Profiles
+// @Accept       json
+// @Produce      json
+// @Param        patch  body      object  true  "Profile fields to change"
+// @Success      200    {object}  models.Profile
+// @Failure      400    {object}  utils.ErrorResponse
+// @Failure      401    {object}  utils.ErrorResponse
+// @Failure      422    {object}  utils.ValidationErrorResponse
+// @Failure      500    {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile [patch]
+func PatchProfile(ctx *gin.Context) {
+	username, exists := ctx.Get("username")
+	if !exists {
+		utils.RespondError(ctx, http.StatusUnauthorized, nil, "PatchProfile unauthorized", "Unauthorized")
+		return
+	}
+
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+
+	var patch services.ProfilePatch
+	if err := ctx.ShouldBindJSON(&patch); err != nil {
+		utils.RespondError(ctx, http.StatusBadRequest, err, "PatchProfile bind error", "Invalid input")
+		return
+	}
+
+	profile, err := profileService.PatchProfile(username.(string), patch)
+	if err != nil {
+		logMsg := fmt.Sprintf("PatchProfile service error for %s", username.(string))
+		var validationErr *utils.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			utils.RespondValidationError(ctx, validationErr, logMsg)
+		case errors.Is(err, services.ErrInvalidEnum):
+			utils.RespondError(ctx, http.StatusBadRequest, err, logMsg, "Invalid profile data")
+		case errors.Is(err, services.ErrInvalidVerificationToken):
+			utils.RespondError(ctx, http.StatusBadRequest, err, logMsg, "Invalid verification token")
+		case errors.Is(err, services.ErrVerificationMismatch):
+			utils.RespondError(ctx, http.StatusBadRequest, err, logMsg, "Verification data mismatch")
+		default:
+			utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to update profile")
+		}
+		return
+	}
+
+	signProfileMedia(ctx, &profile)
+	utils.RespondSuccess(ctx, http.StatusOK, profile)
+}
+
 // GetProfile godoc
 // @Summary      Retrieve the authenticated user's profile
 // @Tags         Profiles
@@ -192,11 +318,36 @@ func GetProfile(ctx *gin.Context) {
 		return
 	}
 
+	signProfileMedia(ctx, &profile.Profile)
 	utils.RespondSuccess(ctx, http.StatusOK, profile)
 }
 
+// GetProfileCompleteness godoc
+// @Summary      Score how complete the authenticated user's profile is
+// @Description  Returns a weighted score from 0 to 100 over the profile sections and photos, with every section that still lacks information and the fields missing from it. Photos rejected by moderation and a rejected bio do not count.
+// @Tags         Profiles
+// @Produce      json
+// @Success      200  {object}  models.ProfileCompleteness
+// @Failure      401  {object}  utils.ErrorResponse
+// @Failure      500  {object}  utils.ErrorResponse
+// @Security     BearerAuth
+// @Router       /user/profile/completeness [get]
+func GetProfileCompleteness(ctx *gin.Context) {
+	profileService := ctx.MustGet("profileService").(*services.ProfileService)
+	userID := ctx.GetInt("userID")
+
+	completeness, err := profileService.GetProfileCompleteness(userID)
+	if err != nil {
+		logMsg := fmt.Sprintf("GetProfileCompleteness service error for user %d", userID)
+		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to score profile")
+		return
+	}
+	utils.RespondSuccess(ctx, http.StatusOK, completeness)
+}
+
 // GetProfiles godoc
 // @Summary      List user profiles with optional filters
+// @Description  Private fields are blanked unless their owner shares them with the caller, see /user/profile/privacy.
 // @Tags         Profiles
 // @Produce      json
 // @Param        gender               query     string false "Filter by gender"
@@ -207,8 +358,10 @@ func GetProfile(ctx *gin.Context) {
 // @Param        country_code         query     string false "Filter by country code"
 // @Param        highest_education    query     string false "Filter by education"
 // @Param        employment_status    query     string false "Filter by employment status"
-// @Param        age                  query     int    false "Filter by age"
+// @Param        age                  query     int    false "Filter by age; only matches users who share their date of birth with you"
 // @Param        horoscope_available  query     bool   false "Filter by horoscope availability"
+// @Param        min_completeness     query     int    false "Only profiles with at least this completeness score (0-100)"
+// @Param        sort                 query     string false "Sort order; completeness lists the most complete profiles first"  Enums(completeness)
 // @Success      200                  {array}   models.UserProfile
 // @Failure      400                  {object}  utils.ErrorResponse
 // @Failure      500                  {object}  utils.ErrorResponse
@@ -246,16 +399,37 @@ func GetProfiles(ctx *gin.Context) {
 		filters.HoroscopeAvailable = &horoscope
 	}
 
-	profiles, err := profileService.GetProfiles(filters)
+	if minStr := ctx.Query("min_completeness"); minStr != "" {
+		minCompleteness, err := strconv.Atoi(minStr)
+		if err != nil || minCompleteness < 0 || minCompleteness > 100 {
+			utils.RespondError(ctx, http.StatusBadRequest, err, "GetProfiles invalid completeness filter", "Invalid completeness filter")
+			return
+		}
+		filters.MinCompleteness = &minCompleteness
+	}
+
+	switch sortBy := ctx.Query("sort"); sortBy {
+	case "", models.ProfileSortCompleteness:
+		filters.SortBy = sortBy
+	default:
+		utils.RespondError(ctx, http.StatusBadRequest, nil, "GetProfiles invalid sort", "Invalid sort")
+		return
+	}
+
+	profiles, err := profileService.GetProfiles(ctx.GetInt("userID"), filters)
 	if err != nil {
 		utils.RespondError(ctx, http.StatusInternalServerError, err, "GetProfiles service error", "Failed to retrieve profiles")
 		return
 	}
+	for i := range profiles {
+		signProfileMedia(ctx, &profiles[i].Profile)
+	}
 	utils.RespondSuccess(ctx, http.StatusOK, profiles)
 }
 
 // GetUserProfile godoc
 // @Summary      Retrieve a user profile by ID
+// @Description  Image URLs in the response are signed and expire after MEDIA_URL_TTL. Private fields are blanked unless their owner shares them with the caller, see /user/profile/privacy. Viewing another user's profile is recorded once per day for their /user/profile/views unless the caller browses in incognito mode.
 // @Tags         Profiles
 // @Produce      json
 // @Param        user_id  path      int  true  "User ID"
@@ -275,13 +449,14 @@ func GetUserProfile(ctx *gin.Context) {
 		return
 	}
 
-	profile, err := profileService.GetProfileByUserID(userID)
+	profile, err := profileService.GetProfileByUserID(ctx.GetInt("userID"), userID)
 	if err != nil {
 		logMsg := fmt.Sprintf("GetUserProfile service error for user %d", userID)
 		utils.RespondError(ctx, http.StatusInternalServerError, err, logMsg, "Failed to retrieve profile")
 		return
 	}
 
+	signProfileMedia(ctx, &profile.Profile)
 	utils.RespondSuccess(ctx, http.StatusOK, profile)
 }
 
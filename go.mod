@@ -28,13 +28,16 @@ require (
 	github.com/go-openapi/swag v0.19.15 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/mailru/easyjson v0.7.6 // indirect
-	github.com/rabbitmq/amqp091-go v1.10.0 // indirect
 	golang.org/x/mod v0.17.0 // indirect
 	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
-require github.com/gin-contrib/cors v1.7.2
+require (
+	github.com/gin-contrib/cors v1.7.2
+	github.com/rabbitmq/amqp091-go v1.10.0
+	golang.org/x/image v0.25.0
+)
 
 require (
 	github.com/bytedance/sonic v1.12.3 // indirect
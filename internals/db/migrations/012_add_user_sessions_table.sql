@@ -0,0 +1,19 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id                          UUID PRIMARY KEY,
+    user_id                     INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash          CHAR(64)     NOT NULL UNIQUE,
+    previous_refresh_token_hash CHAR(64),
+    user_agent                  TEXT         NOT NULL DEFAULT '',
+    ip_address                  VARCHAR(64)  NOT NULL DEFAULT '',
+    created_at                  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    last_used_at                TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    expires_at                  TIMESTAMPTZ  NOT NULL,
+    revoked_at                  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_active ON user_sessions (user_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_user_sessions_previous_hash ON user_sessions (previous_refresh_token_hash);
+
+COMMIT;
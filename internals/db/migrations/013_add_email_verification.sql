@@ -0,0 +1,23 @@
+BEGIN;
+
+-- Accounts that existed before email verification was introduced are treated as verified;
+-- new accounts start unverified.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+ALTER TABLE users ALTER COLUMN email_verified SET DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INT           NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email       VARCHAR(100)  NOT NULL,
+    token_hash  CHAR(64)      NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ   NOT NULL,
+    used_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user ON email_verification_tokens (user_id) WHERE used_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash  CHAR(64)     NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ  NOT NULL,
+    used_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user ON password_reset_tokens (user_id) WHERE used_at IS NULL;
+
+-- Security relevant account events published to the audit consumer. user_id is not a foreign key so
+-- the trail survives account deletion.
+CREATE TABLE IF NOT EXISTS user_audit_outbox (
+    event_id     UUID PRIMARY KEY,
+    user_id      INT          NOT NULL,
+    event_type   VARCHAR(50)  NOT NULL,
+    payload      JSONB        NOT NULL DEFAULT '{}'::jsonb,
+    processed    BOOLEAN      NOT NULL DEFAULT FALSE,
+    processed_at TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_audit_outbox_processed ON user_audit_outbox (processed, created_at);
+CREATE INDEX IF NOT EXISTS idx_user_audit_outbox_user ON user_audit_outbox (user_id);
+
+COMMIT;
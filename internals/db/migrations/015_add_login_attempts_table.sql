@@ -0,0 +1,17 @@
+BEGIN;
+
+-- Failed login attempts tracked per normalized username and per client IP. Rows are shared by every
+-- API replica so backoff and lockouts apply no matter which instance serves the request.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    scope           VARCHAR(16)   NOT NULL,
+    key             VARCHAR(255)  NOT NULL,
+    failures        INT           NOT NULL DEFAULT 0,
+    last_failed_at  TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMPTZ,
+    PRIMARY KEY (scope, key),
+    CONSTRAINT login_attempts_scope_chk CHECK (scope IN ('username', 'ip'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failed ON login_attempts (last_failed_at);
+
+COMMIT;
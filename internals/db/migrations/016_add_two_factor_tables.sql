@@ -0,0 +1,22 @@
+BEGIN;
+
+-- TOTP secrets are stored encrypted. An enrollment stays pending until confirmed_at is set, and
+-- last_used_step keeps an accepted code from being replayed.
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id           INT          PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret_encrypted  TEXT         NOT NULL,
+    confirmed_at      TIMESTAMPTZ,
+    last_used_step    BIGINT       NOT NULL DEFAULT 0,
+    created_at        TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash   CHAR(64)     NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    used_at     TIMESTAMPTZ,
+    CONSTRAINT user_recovery_codes_unique UNIQUE (user_id, code_hash)
+);
+
+COMMIT;
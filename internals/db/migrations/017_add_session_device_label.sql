@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE user_sessions
+    ADD COLUMN IF NOT EXISTS device_label VARCHAR(100) NOT NULL DEFAULT '';
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- A requested address change is kept here until the new address is confirmed.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS pending_email VARCHAR(100);
+
+COMMIT;
@@ -0,0 +1,32 @@
+BEGIN;
+
+-- Accounts at external OpenID Connect providers, identified by issuer and subject. A user can link
+-- at most one account per provider.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id             SERIAL PRIMARY KEY,
+    user_id        INT           NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider       VARCHAR(50)   NOT NULL,
+    issuer         VARCHAR(255)  NOT NULL,
+    subject        VARCHAR(255)  NOT NULL,
+    email          VARCHAR(100)  NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    last_login_at  TIMESTAMPTZ,
+    CONSTRAINT user_identities_subject_unique UNIQUE (issuer, subject),
+    CONSTRAINT user_identities_provider_unique UNIQUE (user_id, provider)
+);
+
+-- Pending authorization requests. The state parameter is stored hashed; the nonce and PKCE verifier
+-- are checked when the provider redirects back. link_user_id is set when a signed-in user links an
+-- account instead of signing in.
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash     CHAR(64)     PRIMARY KEY,
+    provider       VARCHAR(50)  NOT NULL,
+    nonce          TEXT         NOT NULL,
+    code_verifier  TEXT         NOT NULL,
+    link_user_id   INT          REFERENCES users(id) ON DELETE CASCADE,
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    expires_at     TIMESTAMPTZ  NOT NULL,
+    used_at        TIMESTAMPTZ
+);
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Roles that unlock the /admin endpoints. Users without a row have no elevated access.
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id     INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role        VARCHAR(32)  NOT NULL CHECK (role IN ('admin', 'moderator')),
+    granted_by  INT          REFERENCES users(id) ON DELETE SET NULL,
+    granted_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role)
+);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Users can sign in with their email address in any letter case, so addresses have to be unique
+-- regardless of case. Creating the index fails while such duplicates exist; merge them first.
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_unique ON users (LOWER(email));
+
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+
+-- Photo gallery of a profile. The primary photo is mirrored into profiles.profile_image_url and
+-- profiles.profile_image_thumb_url so existing readers keep working.
+CREATE TABLE IF NOT EXISTS profile_photos (
+    id          SERIAL        PRIMARY KEY,
+    user_id     INT           NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url         VARCHAR(512)  NOT NULL,
+    thumb_url   VARCHAR(512)  NOT NULL,
+    caption     VARCHAR(200)  NOT NULL DEFAULT '',
+    position    INT           NOT NULL,
+    is_primary  BOOLEAN       NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ   NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS profile_photos_user_position_idx ON profile_photos (user_id, position);
+CREATE UNIQUE INDEX IF NOT EXISTS profile_photos_one_primary_idx ON profile_photos (user_id) WHERE is_primary;
+
+-- Existing profile images become the first, primary photo of each gallery.
+INSERT INTO profile_photos (user_id, url, thumb_url, position, is_primary)
+SELECT p.user_id, p.profile_image_url, COALESCE(NULLIF(p.profile_image_thumb_url, ''), p.profile_image_url), 0, TRUE
+FROM profiles p
+WHERE COALESCE(p.profile_image_url, '') <> ''
+  AND NOT EXISTS (SELECT 1 FROM profile_photos pp WHERE pp.user_id = p.user_id);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+-- Uploads are now stored in three sizes. Photos from before keep pointing at the single stored file.
+ALTER TABLE profile_photos
+    ADD COLUMN IF NOT EXISTS medium_url VARCHAR(512) NOT NULL DEFAULT '';
+
+UPDATE profile_photos SET medium_url = url WHERE medium_url = '';
+
+COMMIT;
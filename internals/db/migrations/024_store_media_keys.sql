@@ -0,0 +1,25 @@
+BEGIN;
+
+-- Media is now served through signed URLs built per response, so photos and profiles store the
+-- storage key instead of a URL bound to the host that handled the upload.
+UPDATE profile_photos
+SET url = regexp_replace(url, '^.*/uploads/', '')
+WHERE url LIKE '%/uploads/%';
+
+UPDATE profile_photos
+SET medium_url = regexp_replace(medium_url, '^.*/uploads/', '')
+WHERE medium_url LIKE '%/uploads/%';
+
+UPDATE profile_photos
+SET thumb_url = regexp_replace(thumb_url, '^.*/uploads/', '')
+WHERE thumb_url LIKE '%/uploads/%';
+
+UPDATE profiles
+SET profile_image_url = regexp_replace(profile_image_url, '^.*/uploads/', '')
+WHERE profile_image_url LIKE '%/uploads/%';
+
+UPDATE profiles
+SET profile_image_thumb_url = regexp_replace(profile_image_thumb_url, '^.*/uploads/', '')
+WHERE profile_image_thumb_url LIKE '%/uploads/%';
+
+COMMIT;
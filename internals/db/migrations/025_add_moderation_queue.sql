@@ -0,0 +1,31 @@
+BEGIN;
+
+-- Photos already on display count as approved; new uploads start out pending.
+ALTER TABLE profile_photos
+    ADD COLUMN IF NOT EXISTS moderation_status VARCHAR(20) NOT NULL DEFAULT 'approved';
+
+-- profiles.moderation_status tracks the bio: clean, pending or rejected.
+
+-- Review queue for new photos and bio changes. Decided items are kept as the history shown to
+-- the user; items of deleted photos go with them.
+CREATE TABLE IF NOT EXISTS moderation_items (
+    id           SERIAL        PRIMARY KEY,
+    user_id      INT           NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind         VARCHAR(20)   NOT NULL CHECK (kind IN ('photo', 'bio')),
+    photo_id     INT           REFERENCES profile_photos(id) ON DELETE CASCADE,
+    content      TEXT          NOT NULL DEFAULT '',
+    status       VARCHAR(20)   NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    reason       VARCHAR(500)  NOT NULL DEFAULT '',
+    reviewed_by  INT           REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at  TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    CHECK ((kind = 'photo') = (photo_id IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS moderation_items_status_created_idx ON moderation_items (status, created_at);
+CREATE INDEX IF NOT EXISTS moderation_items_user_created_idx ON moderation_items (user_id, created_at DESC);
+-- A bio has at most one pending review; later edits replace its content.
+CREATE UNIQUE INDEX IF NOT EXISTS moderation_items_pending_bio_idx ON moderation_items (user_id)
+    WHERE kind = 'bio' AND status = 'pending';
+
+COMMIT;
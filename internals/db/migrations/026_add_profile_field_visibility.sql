@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Who may see each private profile field. Fields without a row use the default visibility.
+CREATE TABLE IF NOT EXISTS profile_field_visibility (
+    user_id     INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    field       VARCHAR(64)  NOT NULL,
+    visibility  VARCHAR(20)  NOT NULL CHECK (visibility IN ('everyone', 'connections', 'nobody')),
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, field)
+);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Weighted completeness score of the profile, 0-100. NULL marks profiles not scored yet; the
+-- application scores them at startup and rescores a profile whenever it or its photos change.
+ALTER TABLE profiles
+    ADD COLUMN IF NOT EXISTS completeness SMALLINT CHECK (completeness BETWEEN 0 AND 100);
+
+CREATE INDEX IF NOT EXISTS profiles_completeness_idx ON profiles (completeness);
+
+COMMIT;
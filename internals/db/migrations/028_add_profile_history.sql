@@ -0,0 +1,15 @@
+BEGIN;
+
+-- Versioned history of profile changes. Each row holds the fields one save changed with their old
+-- and new values; sensitive values are masked before they are stored.
+CREATE TABLE IF NOT EXISTS profile_history (
+    id          BIGSERIAL    PRIMARY KEY,
+    user_id     INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    version     INT          NOT NULL,
+    changed_by  INT          REFERENCES users(id) ON DELETE SET NULL,
+    changes     JSONB        NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, version)
+);
+
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+
+-- Profile views, one row per viewer, viewed profile and UTC day. Incognito views are kept for
+-- engagement metrics but never shown to the viewed user.
+CREATE TABLE IF NOT EXISTS profile_views (
+    viewer_id   INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    viewed_id   INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    view_date   DATE         NOT NULL,
+    viewed_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    incognito   BOOLEAN      NOT NULL DEFAULT false,
+    PRIMARY KEY (viewed_id, viewer_id, view_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_profile_views_viewed_at ON profile_views (viewed_id, viewed_at DESC);
+
+-- Users browsing in incognito mode. Users without a row are not incognito.
+CREATE TABLE IF NOT EXISTS profile_view_settings (
+    user_id     INT          PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    incognito   BOOLEAN      NOT NULL DEFAULT false,
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+COMMIT;
@@ -5,14 +5,12 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"github.com/icpinto/dating-app/models"
 	"github.com/icpinto/dating-app/repositories"
 	"github.com/icpinto/dating-app/services"
+	"github.com/icpinto/dating-app/utils"
 )
 
-var jwtSecret = []byte("secret") // Secret key used for signing tokens
-
 func Authenticate(c *gin.Context) {
 	tokenString := c.GetHeader("Authorization")
 	if tokenString == "" {
@@ -21,22 +19,28 @@ func Authenticate(c *gin.Context) {
 		return
 	}
 
-	claims := &models.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	claims, err := ValidateAccessToken(c, tokenString)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		case errors.Is(err, repositories.ErrSessionNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify session"})
+		}
 		c.Abort()
 		return
 	}
 
-	// Make the user ID available to downstream handlers regardless of account status.
+	userService := c.MustGet("userService").(*services.UserService)
+
+	// Make the user and session IDs available to downstream handlers regardless of account status.
 	c.Set("userID", claims.UserID)
+	c.Set("sessionID", claims.SessionID)
+	c.Set("roles", claims.Roles)
 
 	// Retrieve the username based on user ID and set both in the context
-	userService := c.MustGet("userService").(*services.UserService)
 	username, err := userService.GetUsernameByID(claims.UserID)
 	if err != nil {
 		if errors.Is(err, repositories.ErrUserNotFound) && allowsInactiveAccess(c) {
@@ -51,9 +55,42 @@ func Authenticate(c *gin.Context) {
 
 	c.Set("username", username)
 
+	// Accounts whose email address is not verified yet may only reach the routes needed to finish
+	// verification or leave.
+	verified, err := userService.IsEmailVerified(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+	if !verified && !allowsUnverifiedAccess(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		c.Abort()
+		return
+	}
+	c.Set("emailVerified", verified)
+
 	c.Next() // Proceed to the next middleware or route handler
 }
 
+// ValidateAccessToken returns the claims of tokenString if it is an access token of a live session.
+// Access tokens are only honoured while the session that issued them is alive, so signing out or
+// revoking a session takes effect on the next request. Tokens that are malformed, expired or not
+// access tokens yield utils.ErrInvalidToken and sessions that were revoked or expired yield
+// repositories.ErrSessionNotFound; any other error means the session could not be checked.
+func ValidateAccessToken(c *gin.Context, tokenString string) (*models.Claims, error) {
+	claims, err := utils.ParseToken(tokenString)
+	if err != nil || claims.TokenUse != "" || claims.SessionID == "" {
+		return nil, utils.ErrInvalidToken
+	}
+
+	userService := c.MustGet("userService").(*services.UserService)
+	if err := userService.ValidateSession(claims.UserID, claims.SessionID); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
 func allowsInactiveAccess(c *gin.Context) bool {
 	path := c.FullPath()
 	if path == "/user/reactivate" || path == "/user/status" {
@@ -72,3 +109,19 @@ func allowsInactiveAccess(c *gin.Context) bool {
 
 	return false
 }
+
+func allowsUnverifiedAccess(c *gin.Context) bool {
+	switch c.FullPath() {
+	case "/signout",
+		"/user/status",
+		"/user/verify-email/resend":
+		return true
+	case "/user":
+		return c.Request.Method == http.MethodDelete
+	case "/user/email":
+		// Lets users correct a mistyped address they could never verify.
+		return c.Request.Method == http.MethodPut
+	}
+
+	return false
+}
@@ -1,23 +1,46 @@
 package middlewares_test
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
+	"encoding/pem"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
 	"github.com/icpinto/dating-app/middlewares"
+	"github.com/icpinto/dating-app/models"
 	"github.com/icpinto/dating-app/services"
 	"github.com/icpinto/dating-app/utils"
 )
 
+const testSessionID = "7f1d2c3b-4a5e-4f60-8a7b-9c0d1e2f3a4b"
+
+func expectSessionCheck(mock sqlmock.Sqlmock, userID int, active bool) {
+	mock.ExpectQuery("SELECT EXISTS \\(\\s*SELECT 1 FROM user_sessions").
+		WithArgs(testSessionID, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(active))
+}
+
+func expectEmailVerified(mock sqlmock.Sqlmock, userID int, verified bool) {
+	mock.ExpectQuery("SELECT email, email_verified FROM users WHERE id=\\$1").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "email_verified"}).AddRow("user@example.com", verified))
+}
+
 func setupAuthRouter(db *sql.DB) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	userService := services.NewUserService(db)
+	userService := services.NewUserService(db, services.NewMemoryMailer())
 	router.Use(middlewares.ServiceMiddleware(middlewares.Services{UserService: userService}))
 	return router
 }
@@ -29,12 +52,14 @@ func TestAuthenticateAllowsInactiveUserForRequestListingRoutes(t *testing.T) {
 	}
 	defer db.Close()
 
+	expectSessionCheck(mock, 42, true)
 	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
 		WithArgs(42).
 		WillReturnError(sql.ErrNoRows)
 	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1").
 		WithArgs(42).
 		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("inactive_jane"))
+	expectEmailVerified(mock, 42, true)
 
 	router := setupAuthRouter(db)
 	router.GET("/user/requests", middlewares.Authenticate, func(c *gin.Context) {
@@ -42,7 +67,7 @@ func TestAuthenticateAllowsInactiveUserForRequestListingRoutes(t *testing.T) {
 		c.JSON(http.StatusOK, gin.H{"username": username})
 	})
 
-	token, err := utils.GenerateToken(42)
+	token, err := utils.GenerateSessionToken(42, testSessionID)
 	if err != nil {
 		t.Fatalf("error generating token: %v", err)
 	}
@@ -71,6 +96,7 @@ func TestAuthenticateBlocksInactiveUserForDisallowedReadRoutes(t *testing.T) {
 	}
 	defer db.Close()
 
+	expectSessionCheck(mock, 99, true)
 	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
 		WithArgs(99).
 		WillReturnError(sql.ErrNoRows)
@@ -82,7 +108,7 @@ func TestAuthenticateBlocksInactiveUserForDisallowedReadRoutes(t *testing.T) {
 		c.Status(http.StatusOK)
 	})
 
-	token, err := utils.GenerateToken(99)
+	token, err := utils.GenerateSessionToken(99, testSessionID)
 	if err != nil {
 		t.Fatalf("error generating token: %v", err)
 	}
@@ -111,6 +137,7 @@ func TestAuthenticateBlocksInactiveUserForWriteRoutes(t *testing.T) {
 	}
 	defer db.Close()
 
+	expectSessionCheck(mock, 7, true)
 	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
 		WithArgs(7).
 		WillReturnError(sql.ErrNoRows)
@@ -122,7 +149,7 @@ func TestAuthenticateBlocksInactiveUserForWriteRoutes(t *testing.T) {
 		c.Status(http.StatusOK)
 	})
 
-	token, err := utils.GenerateToken(7)
+	token, err := utils.GenerateSessionToken(7, testSessionID)
 	if err != nil {
 		t.Fatalf("error generating token: %v", err)
 	}
@@ -143,3 +170,413 @@ func TestAuthenticateBlocksInactiveUserForWriteRoutes(t *testing.T) {
 		t.Fatalf("unmet db expectations: %v", err)
 	}
 }
+
+func TestAuthenticateRejectsRevokedSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	expectSessionCheck(mock, 5, false)
+
+	router := setupAuthRouter(db)
+	handlerCalled := false
+	router.GET("/user/profile", middlewares.Authenticate, func(c *gin.Context) {
+		handlerCalled = true
+		c.Status(http.StatusOK)
+	})
+
+	token, err := utils.GenerateSessionToken(5, testSessionID)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	req.Header.Set("Authorization", token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if handlerCalled {
+		t.Fatalf("handler should not be called for a revoked session")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestAuthenticateFailsWhenSessionCannotBeChecked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT EXISTS \\(\\s*SELECT 1 FROM user_sessions").
+		WithArgs(testSessionID, 5).
+		WillReturnError(errors.New("connection reset"))
+
+	router := setupAuthRouter(db)
+	handlerCalled := false
+	router.GET("/user/profile", middlewares.Authenticate, func(c *gin.Context) {
+		handlerCalled = true
+		c.Status(http.StatusOK)
+	})
+
+	token, err := utils.GenerateSessionToken(5, testSessionID)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	req.Header.Set("Authorization", token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// A database outage must not look like a revoked session to the client.
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500 got %d: %s", w.Code, w.Body.String())
+	}
+	if handlerCalled {
+		t.Fatalf("handler should not be called when the session cannot be checked")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestAuthenticateRejectsTokenWithoutSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	router := setupAuthRouter(db)
+	router.GET("/user/profile", middlewares.Authenticate, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	token, err := utils.GenerateToken(5)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	req.Header.Set("Authorization", token)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestAuthenticateRestrictsUnverifiedUsers(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "profile is blocked", method: http.MethodGet, path: "/user/profile", wantStatus: http.StatusForbidden},
+		{name: "resend is allowed", method: http.MethodPost, path: "/user/verify-email/resend", wantStatus: http.StatusOK},
+		{name: "status is allowed", method: http.MethodGet, path: "/user/status", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			expectSessionCheck(mock, 11, true)
+			mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
+				WithArgs(11).
+				WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("new_user"))
+			expectEmailVerified(mock, 11, false)
+
+			router := setupAuthRouter(db)
+			router.Handle(tt.method, tt.path, middlewares.Authenticate, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			token, err := utils.GenerateSessionToken(11, testSessionID)
+			if err != nil {
+				t.Fatalf("error generating token: %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func useSigningKeys(t *testing.T, keys []utils.SigningKey, activeID string) {
+	t.Helper()
+	if err := utils.ConfigureSigningKeys(keys, activeID); err != nil {
+		t.Fatalf("error configuring signing keys: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := utils.LoadSigningKeysFromEnv(); err != nil {
+			t.Fatalf("error restoring signing keys: %v", err)
+		}
+	})
+}
+
+func TestAuthenticateAcceptsTokensSignedWithRotatedOutKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	oldKey := utils.SigningKey{ID: "2024-01", Algorithm: "HS256", Secret: []byte("old-secret")}
+	newKey := utils.SigningKey{ID: "2024-06", Algorithm: "HS256", Secret: []byte("new-secret")}
+
+	useSigningKeys(t, []utils.SigningKey{oldKey}, "")
+	token, err := utils.GenerateSessionToken(42, testSessionID)
+	if err != nil {
+		t.Fatalf("error generating token: %v", err)
+	}
+	useSigningKeys(t, []utils.SigningKey{newKey, oldKey}, newKey.ID)
+
+	expectSessionCheck(mock, 42, true)
+	mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("jane"))
+	expectEmailVerified(mock, 42, true)
+
+	router := setupAuthRouter(db)
+	router.GET("/user/profile", middlewares.Authenticate, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	req.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestAuthenticateRejectsForgedTokens(t *testing.T) {
+	key := utils.SigningKey{ID: "current", Algorithm: "HS256", Secret: []byte("current-secret")}
+	useSigningKeys(t, []utils.SigningKey{key}, "")
+
+	claims := &models.Claims{
+		UserID:         1,
+		SessionID:      testSessionID,
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	unsigned.Header["kid"] = key.ID
+	noneToken, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("error building alg=none token: %v", err)
+	}
+
+	wrongAlg := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	wrongAlg.Header["kid"] = key.ID
+	wrongAlgToken, err := wrongAlg.SignedString(key.Secret)
+	if err != nil {
+		t.Fatalf("error building HS512 token: %v", err)
+	}
+
+	unknownKid := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	unknownKid.Header["kid"] = "retired"
+	unknownKidToken, err := unknownKid.SignedString(key.Secret)
+	if err != nil {
+		t.Fatalf("error building unknown kid token: %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"alg none":    noneToken,
+		"wrong alg":   wrongAlgToken,
+		"unknown kid": unknownKidToken,
+	} {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			router := setupAuthRouter(db)
+			router.GET("/user/profile", middlewares.Authenticate, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+			req.Header.Set("Authorization", token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAcceptsAsymmetricallySignedTokens(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating rsa key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating ed25519 key: %v", err)
+	}
+
+	for _, key := range []utils.SigningKey{
+		{ID: "rsa-1", Algorithm: "RS256", PrivateKey: rsaKey},
+		{ID: "ed-1", Algorithm: "EdDSA", PrivateKey: edKey},
+	} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			useSigningKeys(t, []utils.SigningKey{key}, "")
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("error creating sqlmock: %v", err)
+			}
+			defer db.Close()
+
+			expectSessionCheck(mock, 42, true)
+			mock.ExpectQuery("SELECT username FROM users WHERE id=\\$1 AND is_active = true").
+				WithArgs(42).
+				WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("jane"))
+			expectEmailVerified(mock, 42, true)
+
+			router := setupAuthRouter(db)
+			router.GET("/user/profile", middlewares.Authenticate, func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			token, err := utils.GenerateSessionToken(42, testSessionID)
+			if err != nil {
+				t.Fatalf("error generating token: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+			req.Header.Set("Authorization", token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200 got %d: %s", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet db expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating rsa key: %v", err)
+	}
+	useSigningKeys(t, []utils.SigningKey{{ID: "rsa-1", Algorithm: "RS256", PrivateKey: rsaKey}}, "")
+
+	// An attacker who knows the published public key signs an HS256 token with it as the secret.
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("error encoding public key: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &models.Claims{
+		UserID:         1,
+		SessionID:      testSessionID,
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	})
+	forged.Header["kid"] = "rsa-1"
+	token, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("error signing forged token: %v", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	router := setupAuthRouter(db)
+	router.GET("/user/profile", middlewares.Authenticate, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	req.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
+
+func TestAuthenticateRejectsTwoFactorChallengeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	router := setupAuthRouter(db)
+	router.GET("/user/profile", middlewares.Authenticate, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	challenge, err := utils.GenerateChallengeToken(5)
+	if err != nil {
+		t.Fatalf("error generating challenge token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	req.Header.Set("Authorization", challenge)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401 got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet db expectations: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/icpinto/dating-app/services"
+)
+
+// RequireRole only lets users holding at least one of the roles through and must run after
+// Authenticate. The roles in the access token are checked first so most requests are turned away
+// without a query, then confirmed against the database so a revoked role stops working on the next
+// request instead of when the token expires. Newly granted roles apply once the token is refreshed.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !holdsAnyRole(c.GetStringSlice("roles"), roles) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		roleService := c.MustGet("roleService").(*services.RoleService)
+		granted, err := roleService.HasAnyRole(c.GetInt("userID"), roles...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify permissions"})
+			c.Abort()
+			return
+		}
+		if !granted {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func holdsAnyRole(held, required []string) bool {
+	for _, role := range required {
+		for _, h := range held {
+			if h == role {
+				return true
+			}
+		}
+	}
+	return false
+}
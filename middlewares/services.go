@@ -10,6 +10,10 @@ type Services struct {
 	FriendRequestService *services.FriendRequestService
 	ProfileService       *services.ProfileService
 	MatchService         *services.MatchService
+	TwoFactorService     *services.TwoFactorService
+	OIDCService          *services.OIDCService
+	RoleService          *services.RoleService
+	MediaStorage         services.MediaStorage
 }
 
 func ServiceMiddleware(s Services) gin.HandlerFunc {
@@ -18,6 +22,10 @@ func ServiceMiddleware(s Services) gin.HandlerFunc {
 		c.Set("friendRequestService", s.FriendRequestService)
 		c.Set("profileService", s.ProfileService)
 		c.Set("matchService", s.MatchService)
+		c.Set("twoFactorService", s.TwoFactorService)
+		c.Set("oidcService", s.OIDCService)
+		c.Set("roleService", s.RoleService)
+		c.Set("mediaStorage", s.MediaStorage)
 		c.Next()
 	}
 }
@@ -4,6 +4,11 @@ import "github.com/golang-jwt/jwt"
 
 // Claims defines the structure of the JWT payload
 type Claims struct {
-	UserID int `json:"user_id"`
+	UserID    int    `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	// TokenUse is empty for access tokens and names the purpose of any other token.
+	TokenUse string `json:"token_use,omitempty"`
+	// Roles lists the roles the user held when the token was issued.
+	Roles []string `json:"roles,omitempty"`
 	jwt.StandardClaims
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// LinkedIdentity is an account at an external OpenID Connect provider that can sign in as a user.
+type LinkedIdentity struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// OIDCLoginState is a pending authorization request waiting for the provider to redirect back.
+// LinkUserID is set when a signed-in user links an account rather than signing in with it.
+type OIDCLoginState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	LinkUserID   int
+}
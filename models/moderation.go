@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	// ModerationKindPhoto marks the review of an uploaded gallery photo.
+	ModerationKindPhoto = "photo"
+	// ModerationKindBio marks the review of a changed bio.
+	ModerationKindBio = "bio"
+
+	// ModerationStatusPending is the status of content waiting for a moderator.
+	ModerationStatusPending = "pending"
+	// ModerationStatusApproved is the status of content a moderator accepted.
+	ModerationStatusApproved = "approved"
+	// ModerationStatusRejected is the status of content a moderator refused. Rejected content is only
+	// shown to its owner.
+	ModerationStatusRejected = "rejected"
+
+	// ProfileModerationClean is the bio status of profiles whose bio is empty or approved. A bio
+	// waiting for review or refused is marked pending or rejected like its moderation item.
+	ProfileModerationClean = "clean"
+)
+
+// ModerationItem is one entry of the review queue: a new photo or a changed bio.
+type ModerationItem struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	Kind     string `json:"kind"`
+	PhotoID  *int   `json:"photo_id,omitempty"`
+	// PhotoURL is the full size image of a photo item.
+	PhotoURL string `json:"photo_url,omitempty"`
+	// Content is the submitted bio of a bio item.
+	Content    string     `json:"content,omitempty"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	ReviewedBy *int       `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ModerationFilters selects the items listed in the moderation queue.
+type ModerationFilters struct {
+	Status string
+	Kind   string
+	Limit  int
+	Offset int
+}
@@ -47,3 +47,48 @@ type UserLifecycleOutbox struct {
 	ProcessedAt *time.Time             `json:"processed_at,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 }
+
+// UserAuditEventType enumerates security relevant account events recorded for auditing.
+type UserAuditEventType string
+
+const (
+	// UserAuditEventTypePasswordReset indicates that the password was replaced through a reset link.
+	UserAuditEventTypePasswordReset UserAuditEventType = "password_reset"
+	// UserAuditEventTypeTwoFactorEnabled indicates that a TOTP enrollment was confirmed.
+	UserAuditEventTypeTwoFactorEnabled UserAuditEventType = "two_factor_enabled"
+	// UserAuditEventTypeTwoFactorDisabled indicates that the second factor was removed.
+	UserAuditEventTypeTwoFactorDisabled UserAuditEventType = "two_factor_disabled"
+	// UserAuditEventTypeRecoveryCodesRegenerated indicates that a new set of recovery codes replaced the old one.
+	UserAuditEventTypeRecoveryCodesRegenerated UserAuditEventType = "recovery_codes_regenerated"
+	// UserAuditEventTypeRecoveryCodeUsed indicates that a recovery code was spent to sign in.
+	UserAuditEventTypeRecoveryCodeUsed UserAuditEventType = "recovery_code_used"
+	// UserAuditEventTypePasswordChanged indicates that the user replaced their password while signed in.
+	UserAuditEventTypePasswordChanged UserAuditEventType = "password_changed"
+	// UserAuditEventTypeEmailChangeRequested indicates that a new address is waiting for confirmation.
+	UserAuditEventTypeEmailChangeRequested UserAuditEventType = "email_change_requested"
+	// UserAuditEventTypeEmailChanged indicates that a pending address was confirmed and replaced the old one.
+	UserAuditEventTypeEmailChanged UserAuditEventType = "email_changed"
+	// UserAuditEventTypeIdentityLinked indicates that an external OpenID Connect account was linked.
+	UserAuditEventTypeIdentityLinked UserAuditEventType = "identity_linked"
+	// UserAuditEventTypeIdentityUnlinked indicates that a linked external account was removed.
+	UserAuditEventTypeIdentityUnlinked UserAuditEventType = "identity_unlinked"
+	// UserAuditEventTypeRoleGranted indicates that an admin granted the user a role.
+	UserAuditEventTypeRoleGranted UserAuditEventType = "role_granted"
+	// UserAuditEventTypeRoleRevoked indicates that an admin took a role away from the user.
+	UserAuditEventTypeRoleRevoked UserAuditEventType = "role_revoked"
+	// UserAuditEventTypeContentApproved indicates that a moderator approved a photo or bio of the user.
+	UserAuditEventTypeContentApproved UserAuditEventType = "content_approved"
+	// UserAuditEventTypeContentRejected indicates that a moderator rejected a photo or bio of the user.
+	UserAuditEventTypeContentRejected UserAuditEventType = "content_rejected"
+)
+
+// UserAuditOutbox represents an audit record queued for delivery to the audit consumer.
+type UserAuditOutbox struct {
+	EventID     string             `json:"event_id"`
+	UserID      int                `json:"user_id"`
+	EventType   UserAuditEventType `json:"event_type"`
+	Payload     json.RawMessage    `json:"payload"`
+	Processed   bool               `json:"processed"`
+	ProcessedAt *time.Time         `json:"processed_at,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ProfileFieldChange is one field changed by a profile save. Masked values of sensitive fields only
+// show whether the field was set.
+type ProfileFieldChange struct {
+	Field    string `json:"field"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+	Masked   bool   `json:"masked,omitempty"`
+}
+
+// ProfileHistoryEntry is a version of a profile: the changes one save made, who made them and when.
+type ProfileHistoryEntry struct {
+	ID        int64                `json:"id"`
+	UserID    int                  `json:"user_id"`
+	Version   int                  `json:"version"`
+	ChangedBy *int                 `json:"changed_by,omitempty"`
+	Changes   []ProfileFieldChange `json:"changes"`
+	CreatedAt time.Time            `json:"created_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ProfilePhoto is one photo in a profile's gallery. Photos are shown in Position order and the
+// primary photo doubles as the profile image.
+type ProfilePhoto struct {
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	URL       string `json:"url"`
+	MediumURL string `json:"medium_url"`
+	ThumbURL  string `json:"thumb_url"`
+	Caption   string `json:"caption"`
+	Position  int    `json:"position"`
+	IsPrimary bool   `json:"is_primary"`
+	// ModerationStatus is pending, approved or rejected. Rejected photos are only shown to their
+	// owner and cannot be the primary photo.
+	ModerationStatus string    `json:"moderation_status"`
+	CreatedAt        time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+const (
+	// VisibilityEveryone shows a profile field to every signed-in user.
+	VisibilityEveryone = "everyone"
+	// VisibilityConnections shows a profile field to users with an accepted friend request.
+	VisibilityConnections = "connections"
+	// VisibilityNobody shows a profile field to its owner only.
+	VisibilityNobody = "nobody"
+)
+
+// ProfilePrivacySettings maps each private profile field, by its JSON name, to who may see it.
+type ProfilePrivacySettings struct {
+	Fields map[string]string `json:"fields"`
+}
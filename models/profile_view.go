@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// ProfileViewer is a user who viewed a profile. Views are counted once per viewer per day.
+type ProfileViewer struct {
+	UserID       int       `json:"user_id"`
+	Username     string    `json:"username"`
+	ViewCount    int       `json:"view_count"`
+	LastViewedAt time.Time `json:"last_viewed_at"`
+}
+
+// ProfileViewCounts summarises the views of a profile, excluding incognito viewers.
+type ProfileViewCounts struct {
+	TotalViews     int `json:"total_views"`
+	UniqueViewers  int `json:"unique_viewers"`
+	ViewsLast7Days int `json:"views_last_7_days"`
+}
+
+// ProfileViews is a page of the users who viewed a profile, most recent first, with the counts.
+type ProfileViews struct {
+	ProfileViewCounts
+	Viewers []ProfileViewer `json:"viewers"`
+}
+
+// ProfileViewSettings controls how the user's own profile views are recorded. Views made in
+// incognito mode are not shown to the viewed user.
+type ProfileViewSettings struct {
+	Incognito bool `json:"incognito"`
+}
@@ -0,0 +1,23 @@
+package models
+
+const (
+	// RoleAdmin grants access to every /admin endpoint, including managing roles.
+	RoleAdmin = "admin"
+	// RoleModerator grants access to the moderation endpoints under /admin.
+	RoleModerator = "moderator"
+)
+
+// IsValidRole reports whether role is one of the known roles.
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleModerator:
+		return true
+	}
+	return false
+}
+
+// UserRoles lists the roles held by a user.
+type UserRoles struct {
+	UserID int      `json:"user_id"`
+	Roles  []string `json:"roles"`
+}
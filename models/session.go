@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Session represents a server-side login session backing a refresh token.
+type Session struct {
+	ID          string     `json:"id"`
+	UserID      int        `json:"user_id"`
+	DeviceLabel string     `json:"device_label"`
+	UserAgent   string     `json:"user_agent"`
+	IPAddress   string     `json:"ip_address"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  time.Time  `json:"last_used_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// AuthTokens bundles the access and refresh tokens issued for a session.
+type AuthTokens struct {
+	UserID       int
+	SessionID    string
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// TOTPEnrollment is the TOTP configuration of a user as stored, with its secret still encrypted.
+type TOTPEnrollment struct {
+	UserID          int
+	SecretEncrypted string
+	ConfirmedAt     *time.Time
+	LastUsedStep    int64
+}
+
+// TwoFactorStatus summarises the second factor configuration of a user.
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
@@ -12,7 +12,7 @@ type Profile struct {
 	UserID               int      `json:"user_id"` // Foreign key to users table
 	Bio                  string   `json:"bio"`
 	Gender               string   `json:"gender"`
-	DateOfBirth          string   `json:"date_of_birth"`
+	DateOfBirth          string   `json:"date_of_birth"` // YYYY-MM-DD, empty when unset
 	LocationLegacy       string   `json:"location"`
 	Interests            []string `json:"interests"` // Array of interests
 	CivilStatus          string   `json:"civil_status"`
@@ -52,6 +52,7 @@ type Profile struct {
 	ProfileImageThumbURL string   `json:"profile_image_thumb_url"`
 	Verified             bool     `json:"verified"`
 	ModerationStatus     string   `json:"moderation_status"`
+	Completeness         int      `json:"completeness"`
 	LastActiveAt         string   `json:"last_active_at"`
 	Metadata             string   `json:"metadata"`
 	CreatedAt            string   `json:"created_at"`
@@ -63,14 +64,6 @@ type UserProfile struct {
 	Username string `json:"username"`
 }
 
-// ProfileVerificationStatus captures persisted verification state for a profile.
-type ProfileVerificationStatus struct {
-	PhoneNumber      string
-	ContactVerified  bool
-	IdentityVerified bool
-	Verified         bool
-}
-
 // ProfileEnums represents available enum values for profile fields.
 type ProfileEnums struct {
 	CivilStatus       []string `json:"civil_status"`
@@ -92,4 +85,25 @@ type ProfileFilters struct {
 	HighestEducation   string
 	EmploymentStatus   string
 	HoroscopeAvailable *bool
+	MinCompleteness    *int
+	// SortBy orders the profiles; "completeness" lists the most complete profiles first.
+	SortBy string
+}
+
+// ProfileSortCompleteness sorts profiles by completeness score, highest first.
+const ProfileSortCompleteness = "completeness"
+
+// ProfileCompleteness is the weighted completeness score of a profile, 0 to 100, with the sections
+// that still lack information.
+type ProfileCompleteness struct {
+	Score           int                     `json:"score"`
+	MissingSections []MissingProfileSection `json:"missing_sections"`
+}
+
+// MissingProfileSection is a profile section that is not complete. Weight is the share of the
+// score the whole section is worth.
+type MissingProfileSection struct {
+	Section       string   `json:"section"`
+	Weight        int      `json:"weight"`
+	MissingFields []string `json:"missing_fields"`
 }
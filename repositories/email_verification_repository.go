@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrVerificationTokenInvalid indicates that a verification token is unknown, expired or already used.
+var ErrVerificationTokenInvalid = errors.New("verification token invalid")
+
+// EmailVerificationRepository stores single-use email verification tokens.
+type EmailVerificationRepository struct {
+	db *sql.DB
+}
+
+// NewEmailVerificationRepository creates a new EmailVerificationRepository.
+func NewEmailVerificationRepository(db *sql.DB) *EmailVerificationRepository {
+	return &EmailVerificationRepository{db: db}
+}
+
+// CreateTx stores the hash of a verification token for the given address within the supplied transaction.
+func (r *EmailVerificationRepository) CreateTx(tx *sql.Tx, userID int, email, tokenHash string, expiresAt time.Time) error {
+	_, err := tx.Exec(`
+        INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+        VALUES ($1, $2, $3, $4)`, userID, email, tokenHash, expiresAt)
+	if err != nil {
+		log.Printf("EmailVerificationRepository.CreateTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// ConsumeTx marks the token as used and returns the user and address it was issued for.
+func (r *EmailVerificationRepository) ConsumeTx(tx *sql.Tx, tokenHash string) (int, string, error) {
+	var userID int
+	var email string
+	err := tx.QueryRow(`
+        UPDATE email_verification_tokens
+        SET used_at = NOW()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id, email`, tokenHash).Scan(&userID, &email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", ErrVerificationTokenInvalid
+		}
+		log.Printf("EmailVerificationRepository.ConsumeTx exec error: %v", err)
+		return 0, "", err
+	}
+	return userID, email, nil
+}
+
+// InvalidateForUserTx marks every outstanding token of the user as used, so only the newest link works.
+func (r *EmailVerificationRepository) InvalidateForUserTx(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`
+        UPDATE email_verification_tokens
+        SET used_at = NOW()
+        WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		log.Printf("EmailVerificationRepository.InvalidateForUserTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
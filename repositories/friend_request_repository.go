@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/icpinto/dating-app/models"
+	"github.com/lib/pq"
 )
 
 // FriendRequestRepository manages CRUD operations for friend requests.
@@ -159,3 +160,45 @@ func (r *FriendRequestRepository) LinkConversation(senderID, receiverID int, con
 	}
 	return err
 }
+
+// AreConnected reports whether either user has accepted a friend request from the other.
+func (r *FriendRequestRepository) AreConnected(userID, otherUserID int) (bool, error) {
+	var connected bool
+	err := r.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM friend_requests
+            WHERE status = 'accepted'
+              AND ((sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1))
+        )`, userID, otherUserID).Scan(&connected)
+	if err != nil {
+		log.Printf("FriendRequestRepository.AreConnected query error for users %d and %d: %v", userID, otherUserID, err)
+	}
+	return connected, err
+}
+
+// ConnectedUserIDs returns which of otherUserIDs the user is connected with, meaning either side
+// accepted a friend request from the other.
+func (r *FriendRequestRepository) ConnectedUserIDs(userID int, otherUserIDs []int) (map[int]bool, error) {
+	rows, err := r.db.Query(`
+        SELECT CASE WHEN sender_id = $1 THEN receiver_id ELSE sender_id END
+        FROM friend_requests
+        WHERE status = 'accepted'
+          AND ((sender_id = $1 AND receiver_id = ANY($2)) OR (receiver_id = $1 AND sender_id = ANY($2)))`,
+		userID, pq.Array(otherUserIDs))
+	if err != nil {
+		log.Printf("FriendRequestRepository.ConnectedUserIDs query error for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	connected := make(map[int]bool)
+	for rows.Next() {
+		var otherUserID int
+		if err := rows.Scan(&otherUserID); err != nil {
+			log.Printf("FriendRequestRepository.ConnectedUserIDs scan error for user %d: %v", userID, err)
+			return nil, err
+		}
+		connected[otherUserID] = true
+	}
+	return connected, rows.Err()
+}
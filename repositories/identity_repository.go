@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrIdentityNotFound indicates that no linked identity matched the lookup.
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrIdentityAlreadyLinked indicates that the external account, or another account at the same
+	// provider, is already linked.
+	ErrIdentityAlreadyLinked = errors.New("identity already linked")
+)
+
+// IdentityRepository stores the external OpenID Connect accounts linked to users.
+type IdentityRepository struct {
+	db *sql.DB
+}
+
+// NewIdentityRepository creates a new IdentityRepository.
+func NewIdentityRepository(db *sql.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// RecordLogin returns the user linked to the issuer and subject and records the time of the login.
+func (r *IdentityRepository) RecordLogin(issuer, subject string) (int, error) {
+	var userID int
+	err := r.db.QueryRow(`
+        UPDATE user_identities
+        SET last_login_at = NOW()
+        WHERE issuer = $1 AND subject = $2
+        RETURNING user_id`, issuer, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrIdentityNotFound
+		}
+		log.Printf("IdentityRepository.RecordLogin query error for issuer %s: %v", issuer, err)
+		return 0, err
+	}
+	return userID, nil
+}
+
+// CreateTx links an external account to the user within the supplied transaction.
+func (r *IdentityRepository) CreateTx(tx *sql.Tx, identity models.LinkedIdentity) error {
+	_, err := tx.Exec(`
+        INSERT INTO user_identities (user_id, provider, issuer, subject, email, last_login_at)
+        VALUES ($1, $2, $3, $4, $5, $6)`,
+		identity.UserID, identity.Provider, identity.Issuer, identity.Subject, identity.Email, identity.LastLoginAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrIdentityAlreadyLinked
+		}
+		log.Printf("IdentityRepository.CreateTx exec error for user %d: %v", identity.UserID, err)
+	}
+	return err
+}
+
+// ListForUser returns the identities linked to the user, oldest first.
+func (r *IdentityRepository) ListForUser(userID int) ([]models.LinkedIdentity, error) {
+	rows, err := r.db.Query(`
+        SELECT id, user_id, provider, issuer, subject, email, created_at, last_login_at
+        FROM user_identities
+        WHERE user_id = $1
+        ORDER BY created_at`, userID)
+	if err != nil {
+		log.Printf("IdentityRepository.ListForUser query error for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.LinkedIdentity{}
+	for rows.Next() {
+		var identity models.LinkedIdentity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Issuer, &identity.Subject,
+			&identity.Email, &identity.CreatedAt, &identity.LastLoginAt); err != nil {
+			log.Printf("IdentityRepository.ListForUser scan error for user %d: %v", userID, err)
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("IdentityRepository.ListForUser rows error for user %d: %v", userID, err)
+		return nil, err
+	}
+	return identities, nil
+}
+
+// CountForUserTx returns how many identities are linked to the user, locking them for the rest of
+// the transaction.
+func (r *IdentityRepository) CountForUserTx(tx *sql.Tx, userID int) (int, error) {
+	rows, err := tx.Query(`SELECT id FROM user_identities WHERE user_id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		log.Printf("IdentityRepository.CountForUserTx query error for user %d: %v", userID, err)
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	return count, rows.Err()
+}
+
+// DeleteTx unlinks one identity of the user within the supplied transaction.
+func (r *IdentityRepository) DeleteTx(tx *sql.Tx, userID, identityID int) error {
+	res, err := tx.Exec(`DELETE FROM user_identities WHERE id = $1 AND user_id = $2`, identityID, userID)
+	if err != nil {
+		log.Printf("IdentityRepository.DeleteTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
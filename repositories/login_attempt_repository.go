@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+const (
+	// LoginAttemptScopeUsername tracks failures against an account, or against the normalized
+	// identifier when it names no account.
+	LoginAttemptScopeUsername = "username"
+	// LoginAttemptScopeIP tracks failures coming from a client IP address.
+	LoginAttemptScopeIP = "ip"
+)
+
+// LoginAttemptRepository persists failed login attempts used for backoff and lockout.
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+// NewLoginAttemptRepository creates a new LoginAttemptRepository.
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// LockedUntil returns the latest lock still in force for the username or the IP address.
+func (r *LoginAttemptRepository) LockedUntil(username, ipAddress string) (time.Time, bool, error) {
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRow(`
+        SELECT MAX(locked_until)
+        FROM login_attempts
+        WHERE ((scope = $1 AND key = $2) OR (scope = $3 AND key = $4)) AND locked_until > NOW()`,
+		LoginAttemptScopeUsername, username, LoginAttemptScopeIP, ipAddress).Scan(&lockedUntil)
+	if err != nil {
+		log.Printf("LoginAttemptRepository.LockedUntil query error: %v", err)
+		return time.Time{}, false, err
+	}
+	return lockedUntil.Time, lockedUntil.Valid, nil
+}
+
+// RecordFailure counts a failed attempt and returns the number of failures in the current window.
+// The count restarts when the previous failure is older than window.
+func (r *LoginAttemptRepository) RecordFailure(scope, key string, window time.Duration) (int, error) {
+	var failures int
+	err := r.db.QueryRow(`
+        INSERT INTO login_attempts (scope, key, failures, last_failed_at)
+        VALUES ($1, $2, 1, NOW())
+        ON CONFLICT (scope, key) DO UPDATE
+        SET failures = CASE
+                WHEN login_attempts.last_failed_at < NOW() - make_interval(secs => $3) THEN 1
+                ELSE login_attempts.failures + 1
+            END,
+            last_failed_at = NOW()
+        RETURNING failures`, scope, key, window.Seconds()).Scan(&failures)
+	if err != nil {
+		log.Printf("LoginAttemptRepository.RecordFailure exec error for %s: %v", scope, err)
+	}
+	return failures, err
+}
+
+// Lock blocks further attempts for the scope and key until the given time.
+func (r *LoginAttemptRepository) Lock(scope, key string, until time.Time) error {
+	_, err := r.db.Exec(`
+        UPDATE login_attempts
+        SET locked_until = $3
+        WHERE scope = $1 AND key = $2`, scope, key, until)
+	if err != nil {
+		log.Printf("LoginAttemptRepository.Lock exec error for %s: %v", scope, err)
+	}
+	return err
+}
+
+// Clear forgets the failures recorded for the scope and key.
+func (r *LoginAttemptRepository) Clear(scope, key string) error {
+	_, err := r.db.Exec(`DELETE FROM login_attempts WHERE scope = $1 AND key = $2`, scope, key)
+	if err != nil {
+		log.Printf("LoginAttemptRepository.Clear exec error for %s: %v", scope, err)
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// ErrModerationItemNotFound indicates that no moderation item has the requested ID.
+var ErrModerationItemNotFound = errors.New("moderation item not found")
+
+// ModerationRepository stores the review queue for photos and bios.
+type ModerationRepository struct {
+	db *sql.DB
+}
+
+// NewModerationRepository creates a new ModerationRepository.
+func NewModerationRepository(db *sql.DB) *ModerationRepository {
+	return &ModerationRepository{db: db}
+}
+
+const moderationItemSelect = `
+        SELECT m.id, m.user_id, u.username, m.kind, m.photo_id, COALESCE(pp.url, ''), m.content, m.status, m.reason,
+               m.reviewed_by, m.reviewed_at, m.created_at
+        FROM moderation_items m
+        JOIN users u ON u.id = m.user_id
+        LEFT JOIN profile_photos pp ON pp.id = m.photo_id`
+
+// EnqueuePhotoTx queues a new photo for review.
+func (r *ModerationRepository) EnqueuePhotoTx(tx *sql.Tx, userID, photoID int) error {
+	_, err := tx.Exec(`INSERT INTO moderation_items (user_id, kind, photo_id) VALUES ($1, $2, $3)`,
+		userID, models.ModerationKindPhoto, photoID)
+	if err != nil {
+		log.Printf("ModerationRepository.EnqueuePhotoTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// UpsertPendingBioTx queues the bio for review. A bio that is already waiting has its content
+// replaced and goes to the back of the queue; resubmitting the same content changes nothing.
+func (r *ModerationRepository) UpsertPendingBioTx(tx *sql.Tx, userID int, content string) error {
+	_, err := tx.Exec(`
+        INSERT INTO moderation_items (user_id, kind, content)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id) WHERE kind = 'bio' AND status = 'pending'
+        DO UPDATE SET content = EXCLUDED.content, created_at = NOW()
+        WHERE moderation_items.content <> EXCLUDED.content`,
+		userID, models.ModerationKindBio, content)
+	if err != nil {
+		log.Printf("ModerationRepository.UpsertPendingBioTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// DeletePendingBioTx drops the bio waiting for review, for example after the user cleared it.
+func (r *ModerationRepository) DeletePendingBioTx(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`DELETE FROM moderation_items WHERE user_id = $1 AND kind = $2 AND status = $3`,
+		userID, models.ModerationKindBio, models.ModerationStatusPending)
+	if err != nil {
+		log.Printf("ModerationRepository.DeletePendingBioTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// List returns the items matching the filters, oldest first so the queue is worked in order.
+func (r *ModerationRepository) List(filters models.ModerationFilters) ([]models.ModerationItem, error) {
+	rows, err := r.db.Query(moderationItemSelect+`
+        WHERE m.status = $1 AND ($2 = '' OR m.kind = $2)
+        ORDER BY m.created_at, m.id
+        LIMIT $3 OFFSET $4`, filters.Status, filters.Kind, filters.Limit, filters.Offset)
+	if err != nil {
+		log.Printf("ModerationRepository.List query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	items, err := scanModerationItems(rows)
+	if err != nil {
+		log.Printf("ModerationRepository.List scan error: %v", err)
+	}
+	return items, err
+}
+
+// ListForUser returns the user's most recent items, newest first.
+func (r *ModerationRepository) ListForUser(userID, limit int) ([]models.ModerationItem, error) {
+	rows, err := r.db.Query(moderationItemSelect+`
+        WHERE m.user_id = $1
+        ORDER BY m.created_at DESC, m.id DESC
+        LIMIT $2`, userID, limit)
+	if err != nil {
+		log.Printf("ModerationRepository.ListForUser query error for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+	items, err := scanModerationItems(rows)
+	if err != nil {
+		log.Printf("ModerationRepository.ListForUser scan error for user %d: %v", userID, err)
+	}
+	return items, err
+}
+
+// GetForUpdateTx loads an item and locks it until the transaction ends.
+func (r *ModerationRepository) GetForUpdateTx(tx *sql.Tx, itemID int) (models.ModerationItem, error) {
+	rows, err := tx.Query(moderationItemSelect+`
+        WHERE m.id = $1
+        FOR UPDATE OF m`, itemID)
+	if err != nil {
+		log.Printf("ModerationRepository.GetForUpdateTx query error for item %d: %v", itemID, err)
+		return models.ModerationItem{}, err
+	}
+	defer rows.Close()
+	items, err := scanModerationItems(rows)
+	if err != nil {
+		log.Printf("ModerationRepository.GetForUpdateTx scan error for item %d: %v", itemID, err)
+		return models.ModerationItem{}, err
+	}
+	if len(items) == 0 {
+		return models.ModerationItem{}, ErrModerationItemNotFound
+	}
+	return items[0], nil
+}
+
+// DecideTx records a moderator's decision on a pending item.
+func (r *ModerationRepository) DecideTx(tx *sql.Tx, item *models.ModerationItem) error {
+	err := tx.QueryRow(`
+        UPDATE moderation_items
+        SET status = $2, reason = $3, reviewed_by = $4, reviewed_at = NOW()
+        WHERE id = $1
+        RETURNING reviewed_at`, item.ID, item.Status, item.Reason, item.ReviewedBy).Scan(&item.ReviewedAt)
+	if err != nil {
+		log.Printf("ModerationRepository.DecideTx exec error for item %d: %v", item.ID, err)
+	}
+	return err
+}
+
+func scanModerationItems(rows *sql.Rows) ([]models.ModerationItem, error) {
+	items := []models.ModerationItem{}
+	for rows.Next() {
+		var item models.ModerationItem
+		var photoID, reviewedBy sql.NullInt64
+		var reviewedAt sql.NullTime
+		if err := rows.Scan(&item.ID, &item.UserID, &item.Username, &item.Kind, &photoID, &item.PhotoURL, &item.Content,
+			&item.Status, &item.Reason, &reviewedBy, &reviewedAt, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		if photoID.Valid {
+			id := int(photoID.Int64)
+			item.PhotoID = &id
+		}
+		if reviewedBy.Valid {
+			id := int(reviewedBy.Int64)
+			item.ReviewedBy = &id
+		}
+		if reviewedAt.Valid {
+			item.ReviewedAt = &reviewedAt.Time
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
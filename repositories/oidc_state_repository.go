@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// ErrOIDCStateInvalid indicates that an authorization state is unknown, expired or already used.
+var ErrOIDCStateInvalid = errors.New("oidc state invalid")
+
+// OIDCStateRepository stores pending OpenID Connect authorization requests.
+type OIDCStateRepository struct {
+	db *sql.DB
+}
+
+// NewOIDCStateRepository creates a new OIDCStateRepository.
+func NewOIDCStateRepository(db *sql.DB) *OIDCStateRepository {
+	return &OIDCStateRepository{db: db}
+}
+
+// Create stores a pending authorization request under the hash of its state parameter.
+func (r *OIDCStateRepository) Create(stateHash string, state models.OIDCLoginState, expiresAt time.Time) error {
+	var linkUserID sql.NullInt64
+	if state.LinkUserID != 0 {
+		linkUserID = sql.NullInt64{Int64: int64(state.LinkUserID), Valid: true}
+	}
+	_, err := r.db.Exec(`
+        INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, link_user_id, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)`,
+		stateHash, state.Provider, state.Nonce, state.CodeVerifier, linkUserID, expiresAt)
+	if err != nil {
+		log.Printf("OIDCStateRepository.Create exec error for provider %s: %v", state.Provider, err)
+	}
+	return err
+}
+
+// Consume marks the authorization request for the provider as used and returns it.
+func (r *OIDCStateRepository) Consume(stateHash, provider string) (models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	var linkUserID sql.NullInt64
+	err := r.db.QueryRow(`
+        UPDATE oidc_login_states
+        SET used_at = NOW()
+        WHERE state_hash = $1 AND provider = $2 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING provider, nonce, code_verifier, link_user_id`, stateHash, provider).
+		Scan(&state.Provider, &state.Nonce, &state.CodeVerifier, &linkUserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.OIDCLoginState{}, ErrOIDCStateInvalid
+		}
+		log.Printf("OIDCStateRepository.Consume query error for provider %s: %v", provider, err)
+		return models.OIDCLoginState{}, err
+	}
+	state.LinkUserID = int(linkUserID.Int64)
+	return state, nil
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrResetTokenInvalid indicates that a password reset token is unknown, expired or already used.
+var ErrResetTokenInvalid = errors.New("password reset token invalid")
+
+// PasswordResetRepository stores single-use password reset tokens.
+type PasswordResetRepository struct {
+	db *sql.DB
+}
+
+// NewPasswordResetRepository creates a new PasswordResetRepository.
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// CreateTx stores the hash of a reset token within the supplied transaction.
+func (r *PasswordResetRepository) CreateTx(tx *sql.Tx, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := tx.Exec(`
+        INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+        VALUES ($1, $2, $3)`, userID, tokenHash, expiresAt)
+	if err != nil {
+		log.Printf("PasswordResetRepository.CreateTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// ConsumeTx marks the token as used and returns the user it was issued for.
+func (r *PasswordResetRepository) ConsumeTx(tx *sql.Tx, tokenHash string) (int, error) {
+	var userID int
+	err := tx.QueryRow(`
+        UPDATE password_reset_tokens
+        SET used_at = NOW()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id`, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrResetTokenInvalid
+		}
+		log.Printf("PasswordResetRepository.ConsumeTx exec error: %v", err)
+		return 0, err
+	}
+	return userID, nil
+}
+
+// InvalidateForUserTx marks every outstanding token of the user as used.
+func (r *PasswordResetRepository) InvalidateForUserTx(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`
+        UPDATE password_reset_tokens
+        SET used_at = NOW()
+        WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		log.Printf("PasswordResetRepository.InvalidateForUserTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// ProfileHistoryRepository stores the versioned history of profile changes.
+type ProfileHistoryRepository struct {
+	db *sql.DB
+}
+
+// NewProfileHistoryRepository creates a new ProfileHistoryRepository.
+func NewProfileHistoryRepository(db *sql.DB) *ProfileHistoryRepository {
+	return &ProfileHistoryRepository{db: db}
+}
+
+// InsertTx stores the entry as the next version of the user's profile and fills in its ID, version
+// and creation time. The caller must hold the lock taken by ProfileRepository.LockUserTx so that
+// concurrent saves are numbered one after the other.
+func (r *ProfileHistoryRepository) InsertTx(tx *sql.Tx, entry *models.ProfileHistoryEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(`
+        INSERT INTO profile_history (user_id, version, changed_by, changes)
+        SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3 FROM profile_history WHERE user_id = $1
+        RETURNING id, version, created_at`, entry.UserID, entry.ChangedBy, changes).
+		Scan(&entry.ID, &entry.Version, &entry.CreatedAt)
+	if err != nil {
+		log.Printf("ProfileHistoryRepository.InsertTx exec error for user %d: %v", entry.UserID, err)
+	}
+	return err
+}
+
+// ListForUser returns the user's profile versions, newest first.
+func (r *ProfileHistoryRepository) ListForUser(userID, limit, offset int) ([]models.ProfileHistoryEntry, error) {
+	rows, err := r.db.Query(`
+        SELECT id, user_id, version, changed_by, changes, created_at FROM profile_history
+        WHERE user_id = $1
+        ORDER BY version DESC
+        LIMIT $2 OFFSET $3`, userID, limit, offset)
+	if err != nil {
+		log.Printf("ProfileHistoryRepository.ListForUser query error for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.ProfileHistoryEntry{}
+	for rows.Next() {
+		var entry models.ProfileHistoryEntry
+		var changedBy sql.NullInt64
+		var changes []byte
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Version, &changedBy, &changes, &entry.CreatedAt); err != nil {
+			log.Printf("ProfileHistoryRepository.ListForUser scan error for user %d: %v", userID, err)
+			return nil, err
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			entry.ChangedBy = &id
+		}
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			log.Printf("ProfileHistoryRepository.ListForUser decode error for user %d: %v", userID, err)
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("ProfileHistoryRepository.ListForUser rows error for user %d: %v", userID, err)
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,210 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// ProfilePhotoRepository stores the photo galleries of profiles.
+type ProfilePhotoRepository struct {
+	db *sql.DB
+}
+
+// NewProfilePhotoRepository creates a new ProfilePhotoRepository.
+func NewProfilePhotoRepository(db *sql.DB) *ProfilePhotoRepository {
+	return &ProfilePhotoRepository{db: db}
+}
+
+const profilePhotoColumns = `id, user_id, url, medium_url, thumb_url, caption, position, is_primary, created_at, moderation_status`
+
+// ListForUser returns the user's photos in gallery order.
+func (r *ProfilePhotoRepository) ListForUser(userID int) ([]models.ProfilePhoto, error) {
+	rows, err := r.db.Query(`SELECT `+profilePhotoColumns+` FROM profile_photos WHERE user_id = $1 ORDER BY position, id`, userID)
+	if err != nil {
+		log.Printf("ProfilePhotoRepository.ListForUser query error for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+	photos, err := scanProfilePhotos(rows)
+	if err != nil {
+		log.Printf("ProfilePhotoRepository.ListForUser scan error for user %d: %v", userID, err)
+	}
+	return photos, err
+}
+
+// LockGalleryTx locks the user's row so that concurrent gallery changes are applied one at a time,
+// then returns the user's photos in gallery order.
+func (r *ProfilePhotoRepository) LockGalleryTx(tx *sql.Tx, userID int) ([]models.ProfilePhoto, error) {
+	var id int
+	if err := tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		log.Printf("ProfilePhotoRepository.LockGalleryTx lock error for user %d: %v", userID, err)
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT `+profilePhotoColumns+` FROM profile_photos WHERE user_id = $1 ORDER BY position, id`, userID)
+	if err != nil {
+		log.Printf("ProfilePhotoRepository.LockGalleryTx query error for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+	photos, err := scanProfilePhotos(rows)
+	if err != nil {
+		log.Printf("ProfilePhotoRepository.LockGalleryTx scan error for user %d: %v", userID, err)
+	}
+	return photos, err
+}
+
+// InsertTx stores a new photo and fills in its ID and creation time.
+func (r *ProfilePhotoRepository) InsertTx(tx *sql.Tx, photo *models.ProfilePhoto) error {
+	err := tx.QueryRow(`
+        INSERT INTO profile_photos (user_id, url, medium_url, thumb_url, caption, position, is_primary, moderation_status)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id, created_at`,
+		photo.UserID, photo.URL, photo.MediumURL, photo.ThumbURL, photo.Caption, photo.Position, photo.IsPrimary, photo.ModerationStatus,
+	).Scan(&photo.ID, &photo.CreatedAt)
+	if err != nil {
+		log.Printf("ProfilePhotoRepository.InsertTx exec error for user %d: %v", photo.UserID, err)
+	}
+	return err
+}
+
+// SetPrimaryTx makes photoID the user's only primary photo.
+func (r *ProfilePhotoRepository) SetPrimaryTx(tx *sql.Tx, userID, photoID int) error {
+	// Clear the old primary first; the one-primary index is checked row by row.
+	if _, err := tx.Exec(`UPDATE profile_photos SET is_primary = FALSE WHERE user_id = $1 AND is_primary AND id <> $2`, userID, photoID); err != nil {
+		log.Printf("ProfilePhotoRepository.SetPrimaryTx clear error for user %d: %v", userID, err)
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE profile_photos SET is_primary = TRUE WHERE user_id = $1 AND id = $2`, userID, photoID); err != nil {
+		log.Printf("ProfilePhotoRepository.SetPrimaryTx set error for user %d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// ClearPrimaryTx leaves the user without a primary photo.
+func (r *ProfilePhotoRepository) ClearPrimaryTx(tx *sql.Tx, userID int) error {
+	if _, err := tx.Exec(`UPDATE profile_photos SET is_primary = FALSE WHERE user_id = $1 AND is_primary`, userID); err != nil {
+		log.Printf("ProfilePhotoRepository.ClearPrimaryTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// SetModerationStatusTx records the moderation decision on a photo.
+func (r *ProfilePhotoRepository) SetModerationStatusTx(tx *sql.Tx, userID, photoID int, status string) error {
+	if _, err := tx.Exec(`UPDATE profile_photos SET moderation_status = $3 WHERE user_id = $1 AND id = $2`, userID, photoID, status); err != nil {
+		log.Printf("ProfilePhotoRepository.SetModerationStatusTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// SetPositionTx moves a photo to the given position in the gallery.
+func (r *ProfilePhotoRepository) SetPositionTx(tx *sql.Tx, userID, photoID, position int) error {
+	if _, err := tx.Exec(`UPDATE profile_photos SET position = $3 WHERE user_id = $1 AND id = $2`, userID, photoID, position); err != nil {
+		log.Printf("ProfilePhotoRepository.SetPositionTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteTx removes a photo from the user's gallery.
+func (r *ProfilePhotoRepository) DeleteTx(tx *sql.Tx, userID, photoID int) error {
+	if _, err := tx.Exec(`DELETE FROM profile_photos WHERE user_id = $1 AND id = $2`, userID, photoID); err != nil {
+		log.Printf("ProfilePhotoRepository.DeleteTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// SetProfileImageTx mirrors the primary photo into the profile. Empty URLs clear the profile image.
+func (r *ProfilePhotoRepository) SetProfileImageTx(tx *sql.Tx, userID int, url, thumbURL string) error {
+	_, err := tx.Exec(`
+        UPDATE profiles
+        SET profile_image_url = NULLIF($2, ''), profile_image_thumb_url = NULLIF($3, ''), updated_at = NOW()
+        WHERE user_id = $1`, userID, url, thumbURL)
+	if err != nil {
+		log.Printf("ProfilePhotoRepository.SetProfileImageTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// IsImageReferenced reports whether any photo or profile still uses the image at url. Uploads are
+// named by content hash, so the same file can back several photos.
+func (r *ProfilePhotoRepository) IsImageReferenced(url string) (bool, error) {
+	var referenced bool
+	err := r.db.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM profile_photos WHERE url = $1)
+            OR EXISTS (SELECT 1 FROM profiles WHERE profile_image_url = $1)`, url).Scan(&referenced)
+	if err != nil {
+		log.Printf("ProfilePhotoRepository.IsImageReferenced query error: %v", err)
+	}
+	return referenced, err
+}
+
+func scanProfilePhotos(rows *sql.Rows) ([]models.ProfilePhoto, error) {
+	photos := []models.ProfilePhoto{}
+	for rows.Next() {
+		var photo models.ProfilePhoto
+		if err := rows.Scan(&photo.ID, &photo.UserID, &photo.URL, &photo.MediumURL, &photo.ThumbURL, &photo.Caption,
+			&photo.Position, &photo.IsPrimary, &photo.CreatedAt, &photo.ModerationStatus); err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	return photos, rows.Err()
+}
+
+// MediaOwner is a user whose photos or profile image use a stored media object.
+type MediaOwner struct {
+	UserID int
+	Active bool
+	// Rejected is set when the user only uses the media in photos moderators rejected.
+	Rejected bool
+}
+
+// FindMediaOwners returns the users whose photos or profile image use the media stored under key,
+// in any of its sizes.
+func (r *ProfilePhotoRepository) FindMediaOwners(key string) ([]MediaOwner, error) {
+	rows, err := r.db.Query(`
+        SELECT u.id, u.is_active,
+               NOT EXISTS (
+                   SELECT 1 FROM profile_photos ph
+                   WHERE ph.user_id = u.id AND $1 IN (ph.url, ph.medium_url, ph.thumb_url) AND ph.moderation_status <> 'rejected')
+               AND NOT EXISTS (
+                   SELECT 1 FROM profiles p
+                   WHERE p.user_id = u.id AND $1 IN (p.profile_image_url, p.profile_image_thumb_url))
+        FROM users u
+        WHERE u.id IN (
+            SELECT user_id FROM profile_photos WHERE $1 IN (url, medium_url, thumb_url)
+            UNION
+            SELECT user_id FROM profiles WHERE $1 IN (profile_image_url, profile_image_thumb_url)
+        )
+        ORDER BY u.id`, key)
+	if err != nil {
+		log.Printf("ProfilePhotoRepository.FindMediaOwners query error for %s: %v", key, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners := []MediaOwner{}
+	for rows.Next() {
+		var owner MediaOwner
+		if err := rows.Scan(&owner.UserID, &owner.Active, &owner.Rejected); err != nil {
+			log.Printf("ProfilePhotoRepository.FindMediaOwners scan error for %s: %v", key, err)
+			return nil, err
+		}
+		owners = append(owners, owner)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("ProfilePhotoRepository.FindMediaOwners rows error for %s: %v", key, err)
+		return nil, err
+	}
+	return owners, nil
+}
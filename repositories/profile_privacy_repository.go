@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// ProfilePrivacyRepository stores who may see the private fields of each profile.
+type ProfilePrivacyRepository struct {
+	db *sql.DB
+}
+
+// NewProfilePrivacyRepository creates a new ProfilePrivacyRepository.
+func NewProfilePrivacyRepository(db *sql.DB) *ProfilePrivacyRepository {
+	return &ProfilePrivacyRepository{db: db}
+}
+
+// GetByUserIDs returns the stored visibility of each field, indexed by user ID. Users who kept the
+// defaults have no entry.
+func (r *ProfilePrivacyRepository) GetByUserIDs(userIDs []int) (map[int]map[string]string, error) {
+	rows, err := r.db.Query(`
+        SELECT user_id, field, visibility FROM profile_field_visibility
+        WHERE user_id = ANY($1)`, pq.Array(userIDs))
+	if err != nil {
+		log.Printf("ProfilePrivacyRepository.GetByUserIDs query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[int]map[string]string)
+	for rows.Next() {
+		var userID int
+		var field, visibility string
+		if err := rows.Scan(&userID, &field, &visibility); err != nil {
+			log.Printf("ProfilePrivacyRepository.GetByUserIDs scan error: %v", err)
+			return nil, err
+		}
+		if settings[userID] == nil {
+			settings[userID] = make(map[string]string)
+		}
+		settings[userID][field] = visibility
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("ProfilePrivacyRepository.GetByUserIDs rows error: %v", err)
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Save stores the visibility of the given fields, leaving the other fields as they are.
+func (r *ProfilePrivacyRepository) Save(userID int, fields map[string]string) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	visibilities := make([]string, len(names))
+	for i, name := range names {
+		visibilities[i] = fields[name]
+	}
+
+	_, err := r.db.Exec(`
+        INSERT INTO profile_field_visibility (user_id, field, visibility)
+        SELECT $1, f.field, f.visibility FROM unnest($2::text[], $3::text[]) AS f(field, visibility)
+        ON CONFLICT (user_id, field) DO UPDATE SET visibility = EXCLUDED.visibility, updated_at = NOW()`,
+		userID, pq.Array(names), pq.Array(visibilities))
+	if err != nil {
+		log.Printf("ProfilePrivacyRepository.Save exec error for user %d: %v", userID, err)
+	}
+	return err
+}
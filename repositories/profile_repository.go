@@ -21,15 +21,35 @@ func NewProfileRepository(db *sql.DB) *ProfileRepository {
 	return &ProfileRepository{db: db}
 }
 
-// Upsert creates or updates a profile record.
-func (r *ProfileRepository) Upsert(profile models.Profile) error {
+// profileQueryer is implemented by both *sql.DB and *sql.Tx, so a profile can be read on its own or
+// as part of a transaction.
+type profileQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// LockUserTx locks the user's row so that concurrent profile saves are applied one at a time, even
+// before the user has a profile.
+func (r *ProfileRepository) LockUserTx(tx *sql.Tx, userID int) error {
+	var id int
+	if err := tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		log.Printf("ProfileRepository.LockUserTx lock error for user %d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// UpsertTx creates or updates a profile record within tx.
+func (r *ProfileRepository) UpsertTx(tx *sql.Tx, profile models.Profile) error {
 	// Ensure JSONB fields are valid; default to empty JSON object if not provided or invalid
 	metadata := "{}"
 	if profile.Metadata != "" {
 		if json.Valid([]byte(profile.Metadata)) {
 			metadata = profile.Metadata
 		} else {
-			log.Printf("ProfileRepository.Upsert invalid metadata for user %d: %s", profile.UserID, profile.Metadata)
+			log.Printf("ProfileRepository.UpsertTx invalid metadata for user %d: %s", profile.UserID, profile.Metadata)
 		}
 	}
 
@@ -38,7 +58,7 @@ func (r *ProfileRepository) Upsert(profile models.Profile) error {
 		if json.Valid([]byte(profile.Siblings)) {
 			siblingsJSON = profile.Siblings
 		} else {
-			log.Printf("ProfileRepository.Upsert invalid siblings for user %d: %s", profile.UserID, profile.Siblings)
+			log.Printf("ProfileRepository.UpsertTx invalid siblings for user %d: %s", profile.UserID, profile.Siblings)
 		}
 	}
 
@@ -47,7 +67,7 @@ func (r *ProfileRepository) Upsert(profile models.Profile) error {
 		if json.Valid([]byte(profile.Horoscope)) {
 			horoscopeJSON = profile.Horoscope
 		} else {
-			log.Printf("ProfileRepository.Upsert invalid horoscope for user %d: %s", profile.UserID, profile.Horoscope)
+			log.Printf("ProfileRepository.UpsertTx invalid horoscope for user %d: %s", profile.UserID, profile.Horoscope)
 		}
 	}
 
@@ -61,8 +81,13 @@ func (r *ProfileRepository) Upsert(profile models.Profile) error {
 	dateOfBirth := sql.NullString{String: profile.DateOfBirth, Valid: profile.DateOfBirth != ""}
 	birthTime := sql.NullString{String: profile.BirthTime, Valid: profile.BirthTime != ""}
 	lastActiveAt := sql.NullString{String: profile.LastActiveAt, Valid: profile.LastActiveAt != ""}
+	// Zero means the height or weight was not provided; the columns only accept plausible values.
+	heightCM := sql.NullInt64{Int64: int64(profile.HeightCM), Valid: profile.HeightCM != 0}
+	weightKG := sql.NullInt64{Int64: int64(profile.WeightKG), Valid: profile.WeightKG != 0}
 
-	_, err := r.db.Exec(`
+	// A profile created after photos were uploaded takes its image from the primary photo. A new or
+	// changed bio is marked pending until a moderator reviews it; an empty bio needs no review.
+	_, err := tx.Exec(`
 INSERT INTO profiles (
 user_id, bio, gender, date_of_birth, location_legacy, interests, civil_status, religion, religion_detail,
 caste, height_cm, weight_kg, dietary_preference, smoking, alcohol, languages,
@@ -77,8 +102,10 @@ $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
 $17, $18, $19,
 $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30,
 $31, $32, $33, $34,
-$35, $36, $37, $38, $39, $40,
-$41, $42, $43, $44, $45)
+$35, $36, $37, $38, $39,
+COALESCE(NULLIF($40, ''), (SELECT url FROM profile_photos WHERE user_id = $1 AND is_primary), ''),
+COALESCE(NULLIF($41, ''), (SELECT thumb_url FROM profile_photos WHERE user_id = $1 AND is_primary), ''),
+$42, CASE WHEN COALESCE($2, '') = '' THEN 'clean' ELSE 'pending' END, $43, $44)
 ON CONFLICT (user_id)
 DO UPDATE SET bio = EXCLUDED.bio, gender = COALESCE(EXCLUDED.gender, profiles.gender), date_of_birth = EXCLUDED.date_of_birth,
 location_legacy = EXCLUDED.location_legacy, interests = EXCLUDED.interests, civil_status = EXCLUDED.civil_status,
@@ -100,30 +127,87 @@ sinhala_raasi = EXCLUDED.sinhala_raasi, nakshatra = EXCLUDED.nakshatra,
 horoscope = EXCLUDED.horoscope,
 profile_image_url = CASE WHEN EXCLUDED.profile_image_url <> '' THEN EXCLUDED.profile_image_url ELSE profiles.profile_image_url END,
 profile_image_thumb_url = CASE WHEN EXCLUDED.profile_image_thumb_url <> '' THEN EXCLUDED.profile_image_thumb_url ELSE profiles.profile_image_thumb_url END,
-verified = EXCLUDED.verified, moderation_status = EXCLUDED.moderation_status,
+verified = EXCLUDED.verified,
+moderation_status = CASE WHEN EXCLUDED.bio IS NOT DISTINCT FROM profiles.bio THEN profiles.moderation_status ELSE EXCLUDED.moderation_status END,
 last_active_at = EXCLUDED.last_active_at, metadata = EXCLUDED.metadata,
 updated_at = NOW()`,
 		profile.UserID, profile.Bio, gender, dateOfBirth, profile.LocationLegacy,
 		pq.Array(profile.Interests), civilStatus, profile.Religion, profile.ReligionDetail,
-		profile.Caste, profile.HeightCM, profile.WeightKG, dietaryPreference, smoking, alcohol,
+		profile.Caste, heightCM, weightKG, dietaryPreference, smoking, alcohol,
 		pq.Array(profile.Languages), profile.PhoneNumber, profile.ContactVerified, profile.IdentityVerified,
 		profile.CountryCode, profile.Province, profile.District, profile.City, profile.PostalCode,
 		highestEducation, profile.FieldOfStudy, profile.Institution, employmentStatus, profile.Occupation,
 		profile.FatherOccupation, profile.MotherOccupation, profile.SiblingsCount, siblingsJSON,
 		profile.HoroscopeAvailable, birthTime, profile.BirthPlace, profile.SinhalaRaasi, profile.Nakshatra, horoscopeJSON,
-		profile.ProfileImageURL, profile.ProfileImageThumbURL, profile.Verified, profile.ModerationStatus,
+		profile.ProfileImageURL, profile.ProfileImageThumbURL, profile.Verified,
 		lastActiveAt, metadata)
 	if err != nil {
-		log.Printf("ProfileRepository.Upsert error for user %d: %v", profile.UserID, err)
+		log.Printf("ProfileRepository.UpsertTx error for user %d: %v", profile.UserID, err)
+	}
+	return err
+}
+
+// SetBioModerationStatusTx records the moderation decision on the bio, provided the profile still
+// has the reviewed bio. It reports whether the profile was updated.
+func (r *ProfileRepository) SetBioModerationStatusTx(tx *sql.Tx, userID int, bio, status string) (bool, error) {
+	result, err := tx.Exec(`
+        UPDATE profiles SET moderation_status = $3, updated_at = NOW()
+        WHERE user_id = $1 AND bio = $2`, userID, bio, status)
+	if err != nil {
+		log.Printf("ProfileRepository.SetBioModerationStatusTx exec error for user %d: %v", userID, err)
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated > 0, err
+}
+
+// SetCompleteness stores the completeness score of the user's profile.
+func (r *ProfileRepository) SetCompleteness(userID, score int) error {
+	_, err := r.db.Exec(`UPDATE profiles SET completeness = $2 WHERE user_id = $1`, userID, score)
+	if err != nil {
+		log.Printf("ProfileRepository.SetCompleteness exec error for user %d: %v", userID, err)
 	}
 	return err
 }
 
+// ListUnscoredUserIDs returns up to limit active users whose profile has no completeness score yet.
+// Inactive users are skipped because GetByUserID does not return their profiles.
+func (r *ProfileRepository) ListUnscoredUserIDs(limit int) ([]int, error) {
+	rows, err := r.db.Query(`SELECT p.user_id
+       FROM profiles p JOIN users u ON p.user_id = u.id
+       WHERE p.completeness IS NULL AND u.is_active = true ORDER BY p.user_id LIMIT $1`, limit)
+	if err != nil {
+		log.Printf("ProfileRepository.ListUnscoredUserIDs query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			log.Printf("ProfileRepository.ListUnscoredUserIDs scan error: %v", err)
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
 // GetByUserID retrieves a profile for the specified user ID.
 func (r *ProfileRepository) GetByUserID(userID int) (models.UserProfile, error) {
+	return getProfileByUserID(r.db, userID)
+}
+
+// GetByUserIDTx retrieves a profile for the specified user ID within tx.
+func (r *ProfileRepository) GetByUserIDTx(tx *sql.Tx, userID int) (models.UserProfile, error) {
+	return getProfileByUserID(tx, userID)
+}
+
+func getProfileByUserID(q profileQueryer, userID int) (models.UserProfile, error) {
 	var profile models.UserProfile
-	err := r.db.QueryRow(`
-       SELECT p.id, p.user_id, u.username, p.bio, COALESCE(p.gender::text, ''), p.date_of_birth,
+	err := q.QueryRow(`
+       SELECT p.id, p.user_id, u.username, p.bio, COALESCE(p.gender::text, ''), COALESCE(p.date_of_birth::text, ''),
               COALESCE(p.location_legacy, ''), COALESCE(p.interests, ARRAY[]::text[]),
               COALESCE(p.civil_status::text, ''), COALESCE(p.religion, ''), COALESCE(p.religion_detail, ''), COALESCE(p.caste, ''),
               COALESCE(p.height_cm, 0), COALESCE(p.weight_kg, 0), COALESCE(p.dietary_preference::text, ''), COALESCE(p.smoking::text, ''), COALESCE(p.alcohol::text, ''),
@@ -132,7 +216,7 @@ func (r *ProfileRepository) GetByUserID(userID int) (models.UserProfile, error)
               COALESCE(p.highest_education::text, ''), COALESCE(p.field_of_study, ''), COALESCE(p.institution, ''), COALESCE(p.employment_status::text, ''), COALESCE(p.occupation, ''),
               COALESCE(p.father_occupation, ''), COALESCE(p.mother_occupation, ''), COALESCE(p.siblings_count, 0), COALESCE(p.siblings::text, ''),
               COALESCE(p.horoscope_available, false), COALESCE(p.birth_time::text, ''), COALESCE(p.birth_place, ''), COALESCE(p.sinhala_raasi, ''), COALESCE(p.nakshatra, ''), COALESCE(p.horoscope::text, ''),
-              COALESCE(p.profile_image_url, ''), COALESCE(p.profile_image_thumb_url, ''), COALESCE(p.verified, false), COALESCE(p.moderation_status, ''), COALESCE(p.last_active_at::text, ''), COALESCE(p.metadata::text, ''),
+              COALESCE(p.profile_image_url, ''), COALESCE(p.profile_image_thumb_url, ''), COALESCE(p.verified, false), COALESCE(p.moderation_status, ''), COALESCE(p.completeness, 0), COALESCE(p.last_active_at::text, ''), COALESCE(p.metadata::text, ''),
               p.created_at, p.updated_at
        FROM profiles p JOIN users u ON p.user_id = u.id WHERE p.user_id = $1 AND u.is_active = true`, userID).Scan(
 		&profile.ID, &profile.UserID, &profile.Username, &profile.Bio, &profile.Gender,
@@ -144,7 +228,7 @@ func (r *ProfileRepository) GetByUserID(userID int) (models.UserProfile, error)
 		&profile.HighestEducation, &profile.FieldOfStudy, &profile.Institution, &profile.EmploymentStatus, &profile.Occupation,
 		&profile.FatherOccupation, &profile.MotherOccupation, &profile.SiblingsCount, &profile.Siblings,
 		&profile.HoroscopeAvailable, &profile.BirthTime, &profile.BirthPlace, &profile.SinhalaRaasi, &profile.Nakshatra, &profile.Horoscope,
-		&profile.ProfileImageURL, &profile.ProfileImageThumbURL, &profile.Verified, &profile.ModerationStatus, &profile.LastActiveAt, &profile.Metadata,
+		&profile.ProfileImageURL, &profile.ProfileImageThumbURL, &profile.Verified, &profile.ModerationStatus, &profile.Completeness, &profile.LastActiveAt, &profile.Metadata,
 		&profile.CreatedAt, &profile.UpdatedAt)
 	if err != nil && err != sql.ErrNoRows {
 		log.Printf("ProfileRepository.GetByUserID query error for user %d: %v", userID, err)
@@ -152,17 +236,6 @@ func (r *ProfileRepository) GetByUserID(userID int) (models.UserProfile, error)
 	return profile, err
 }
 
-// GetVerificationStatus returns stored verification details for a profile.
-func (r *ProfileRepository) GetVerificationStatus(userID int) (models.ProfileVerificationStatus, error) {
-	var status models.ProfileVerificationStatus
-	err := r.db.QueryRow(`SELECT COALESCE(phone_number, ''), COALESCE(contact_verified, false), COALESCE(identity_verified, false), COALESCE(verified, false) FROM profiles WHERE user_id = $1`, userID).
-		Scan(&status.PhoneNumber, &status.ContactVerified, &status.IdentityVerified, &status.Verified)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("ProfileRepository.GetVerificationStatus query error for user %d: %v", userID, err)
-	}
-	return status, err
-}
-
 // GetByUserIDs retrieves profiles for the specified user IDs indexed by user ID.
 func (r *ProfileRepository) GetByUserIDs(userIDs []int) (map[int]models.UserProfile, error) {
 	profiles := make(map[int]models.UserProfile)
@@ -171,7 +244,7 @@ func (r *ProfileRepository) GetByUserIDs(userIDs []int) (map[int]models.UserProf
 	}
 
 	rows, err := r.db.Query(`
-       SELECT p.id, p.user_id, u.username, p.bio, COALESCE(p.gender::text, ''), p.date_of_birth,
+       SELECT p.id, p.user_id, u.username, p.bio, COALESCE(p.gender::text, ''), COALESCE(p.date_of_birth::text, ''),
               COALESCE(p.location_legacy, ''), COALESCE(p.interests, ARRAY[]::text[]),
               COALESCE(p.civil_status::text, ''), COALESCE(p.religion, ''), COALESCE(p.religion_detail, ''), COALESCE(p.caste, ''),
               COALESCE(p.height_cm, 0), COALESCE(p.weight_kg, 0), COALESCE(p.dietary_preference::text, ''), COALESCE(p.smoking::text, ''), COALESCE(p.alcohol::text, ''),
@@ -180,7 +253,7 @@ func (r *ProfileRepository) GetByUserIDs(userIDs []int) (map[int]models.UserProf
               COALESCE(p.highest_education::text, ''), COALESCE(p.field_of_study, ''), COALESCE(p.institution, ''), COALESCE(p.employment_status::text, ''), COALESCE(p.occupation, ''),
               COALESCE(p.father_occupation, ''), COALESCE(p.mother_occupation, ''), COALESCE(p.siblings_count, 0), COALESCE(p.siblings::text, ''),
               COALESCE(p.horoscope_available, false), COALESCE(p.birth_time::text, ''), COALESCE(p.birth_place, ''), COALESCE(p.sinhala_raasi, ''), COALESCE(p.nakshatra, ''), COALESCE(p.horoscope::text, ''),
-              COALESCE(p.profile_image_url, ''), COALESCE(p.profile_image_thumb_url, ''), COALESCE(p.verified, false), COALESCE(p.moderation_status, ''), COALESCE(p.last_active_at::text, ''), COALESCE(p.metadata::text, ''),
+              COALESCE(p.profile_image_url, ''), COALESCE(p.profile_image_thumb_url, ''), COALESCE(p.verified, false), COALESCE(p.moderation_status, ''), COALESCE(p.completeness, 0), COALESCE(p.last_active_at::text, ''), COALESCE(p.metadata::text, ''),
               p.created_at, p.updated_at
        FROM profiles p JOIN users u ON p.user_id = u.id WHERE p.user_id = ANY($1) AND u.is_active = true`, pq.Array(userIDs))
 	if err != nil {
@@ -201,7 +274,7 @@ func (r *ProfileRepository) GetByUserIDs(userIDs []int) (map[int]models.UserProf
 			&profile.HighestEducation, &profile.FieldOfStudy, &profile.Institution, &profile.EmploymentStatus, &profile.Occupation,
 			&profile.FatherOccupation, &profile.MotherOccupation, &profile.SiblingsCount, &profile.Siblings,
 			&profile.HoroscopeAvailable, &profile.BirthTime, &profile.BirthPlace, &profile.SinhalaRaasi, &profile.Nakshatra, &profile.Horoscope,
-			&profile.ProfileImageURL, &profile.ProfileImageThumbURL, &profile.Verified, &profile.ModerationStatus, &profile.LastActiveAt, &profile.Metadata,
+			&profile.ProfileImageURL, &profile.ProfileImageThumbURL, &profile.Verified, &profile.ModerationStatus, &profile.Completeness, &profile.LastActiveAt, &profile.Metadata,
 			&profile.CreatedAt, &profile.UpdatedAt,
 		); err != nil {
 			log.Printf("ProfileRepository.GetByUserIDs scan error: %v", err)
@@ -217,15 +290,30 @@ func (r *ProfileRepository) GetByUserIDs(userIDs []int) (map[int]models.UserProf
 	return profiles, nil
 }
 
+// dateOfBirthVisibleCondition limits a filter on the date of birth to owners who share it with the
+// viewer, whose ID is argument %[1]d, so filtering cannot reveal hidden birth dates. Owners without
+// a stored setting fall back to the default visibility in argument %[2]d.
+const dateOfBirthVisibleCondition = `(p.user_id = $%[1]d OR CASE COALESCE(
+           (SELECT v.visibility FROM profile_field_visibility v WHERE v.user_id = p.user_id AND v.field = 'date_of_birth'),
+           $%[2]d::text)
+         WHEN 'everyone' THEN true
+         WHEN 'connections' THEN EXISTS (
+           SELECT 1 FROM friend_requests f
+           WHERE f.status = 'accepted'
+             AND ((f.sender_id = $%[1]d AND f.receiver_id = p.user_id) OR (f.receiver_id = $%[1]d AND f.sender_id = p.user_id)))
+         ELSE false END)`
+
 // GetAll retrieves all profiles.
 func (r *ProfileRepository) GetAll() ([]models.UserProfile, error) {
-	return r.GetAllWithFilters(models.ProfileFilters{})
+	return r.GetAllWithFilters(0, models.VisibilityEveryone, models.ProfileFilters{})
 }
 
-// GetAllWithFilters retrieves profiles applying optional filters.
-func (r *ProfileRepository) GetAllWithFilters(filters models.ProfileFilters) ([]models.UserProfile, error) {
+// GetAllWithFilters retrieves profiles applying optional filters as seen by viewerID, who only
+// matches filters on fields the owners share with them. dateOfBirthDefault is who may see a date
+// of birth whose owner has not chosen a visibility.
+func (r *ProfileRepository) GetAllWithFilters(viewerID int, dateOfBirthDefault string, filters models.ProfileFilters) ([]models.UserProfile, error) {
 	baseQuery := `
-       SELECT p.id, p.user_id, u.username, p.bio, COALESCE(p.gender::text, ''), p.date_of_birth,
+       SELECT p.id, p.user_id, u.username, p.bio, COALESCE(p.gender::text, ''), COALESCE(p.date_of_birth::text, ''),
               COALESCE(p.location_legacy, ''), COALESCE(p.interests, ARRAY[]::text[]),
               COALESCE(p.civil_status::text, ''), COALESCE(p.religion, ''), COALESCE(p.religion_detail, ''), COALESCE(p.caste, ''),
               COALESCE(p.height_cm, 0), COALESCE(p.weight_kg, 0), COALESCE(p.dietary_preference::text, ''), COALESCE(p.smoking::text, ''), COALESCE(p.alcohol::text, ''),
@@ -234,7 +322,7 @@ func (r *ProfileRepository) GetAllWithFilters(filters models.ProfileFilters) ([]
               COALESCE(p.highest_education::text, ''), COALESCE(p.field_of_study, ''), COALESCE(p.institution, ''), COALESCE(p.employment_status::text, ''), COALESCE(p.occupation, ''),
               COALESCE(p.father_occupation, ''), COALESCE(p.mother_occupation, ''), COALESCE(p.siblings_count, 0), COALESCE(p.siblings::text, ''),
               COALESCE(p.horoscope_available, false), COALESCE(p.birth_time::text, ''), COALESCE(p.birth_place, ''), COALESCE(p.sinhala_raasi, ''), COALESCE(p.nakshatra, ''), COALESCE(p.horoscope::text, ''),
-              COALESCE(p.profile_image_url, ''), COALESCE(p.profile_image_thumb_url, ''), COALESCE(p.verified, false), COALESCE(p.moderation_status, ''), COALESCE(p.last_active_at::text, ''), COALESCE(p.metadata::text, ''),
+              COALESCE(p.profile_image_url, ''), COALESCE(p.profile_image_thumb_url, ''), COALESCE(p.verified, false), COALESCE(p.moderation_status, ''), COALESCE(p.completeness, 0), COALESCE(p.last_active_at::text, ''), COALESCE(p.metadata::text, ''),
               p.created_at, p.updated_at
        FROM profiles p JOIN users u ON p.user_id = u.id
        WHERE u.is_active = true`
@@ -250,8 +338,9 @@ func (r *ProfileRepository) GetAllWithFilters(filters models.ProfileFilters) ([]
 	}
 	if filters.Age != nil {
 		conditions = append(conditions, fmt.Sprintf("DATE_PART('year', AGE(CURRENT_DATE, p.date_of_birth::date)) = $%d", argPos))
-		args = append(args, *filters.Age)
-		argPos++
+		conditions = append(conditions, fmt.Sprintf(dateOfBirthVisibleCondition, argPos+1, argPos+2))
+		args = append(args, *filters.Age, viewerID, dateOfBirthDefault)
+		argPos += 3
 	}
 	if filters.CivilStatus != "" {
 		conditions = append(conditions, fmt.Sprintf("p.civil_status::text = $%d", argPos))
@@ -294,10 +383,19 @@ func (r *ProfileRepository) GetAllWithFilters(filters models.ProfileFilters) ([]
 		argPos++
 	}
 
+	if filters.MinCompleteness != nil {
+		conditions = append(conditions, fmt.Sprintf("COALESCE(p.completeness, 0) >= $%d", argPos))
+		args = append(args, *filters.MinCompleteness)
+		argPos++
+	}
+
 	query := baseQuery
 	if len(conditions) > 0 {
 		query = fmt.Sprintf("%s AND %s", baseQuery, strings.Join(conditions, " AND "))
 	}
+	if filters.SortBy == models.ProfileSortCompleteness {
+		query += " ORDER BY COALESCE(p.completeness, 0) DESC, p.user_id"
+	}
 
 	rows, err := r.db.Query(query, args...)
 	if err != nil {
@@ -319,7 +417,7 @@ func (r *ProfileRepository) GetAllWithFilters(filters models.ProfileFilters) ([]
 			&profile.HighestEducation, &profile.FieldOfStudy, &profile.Institution, &profile.EmploymentStatus, &profile.Occupation,
 			&profile.FatherOccupation, &profile.MotherOccupation, &profile.SiblingsCount, &profile.Siblings,
 			&profile.HoroscopeAvailable, &profile.BirthTime, &profile.BirthPlace, &profile.SinhalaRaasi, &profile.Nakshatra, &profile.Horoscope,
-			&profile.ProfileImageURL, &profile.ProfileImageThumbURL, &profile.Verified, &profile.ModerationStatus, &profile.LastActiveAt, &profile.Metadata,
+			&profile.ProfileImageURL, &profile.ProfileImageThumbURL, &profile.Verified, &profile.ModerationStatus, &profile.Completeness, &profile.LastActiveAt, &profile.Metadata,
 			&profile.CreatedAt, &profile.UpdatedAt,
 		); err != nil {
 			log.Printf("ProfileRepository.GetAll scan error: %v", err)
@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// ProfileViewRepository stores who viewed which profile and the incognito preference of viewers.
+type ProfileViewRepository struct {
+	db *sql.DB
+}
+
+// NewProfileViewRepository creates a new ProfileViewRepository.
+func NewProfileViewRepository(db *sql.DB) *ProfileViewRepository {
+	return &ProfileViewRepository{db: db}
+}
+
+// Record stores a view of viewedID's profile by viewerID. Repeated views on the same UTC day update
+// the existing view, which stays public once any of them was made outside incognito mode.
+func (r *ProfileViewRepository) Record(viewerID, viewedID int) error {
+	_, err := r.db.Exec(`
+        INSERT INTO profile_views (viewer_id, viewed_id, view_date, viewed_at, incognito)
+        SELECT $1, $2, (NOW() AT TIME ZONE 'UTC')::date, NOW(),
+               COALESCE((SELECT incognito FROM profile_view_settings WHERE user_id = $1), false)
+        ON CONFLICT (viewed_id, viewer_id, view_date)
+        DO UPDATE SET viewed_at = EXCLUDED.viewed_at, incognito = profile_views.incognito AND EXCLUDED.incognito`, viewerID, viewedID)
+	if err != nil {
+		log.Printf("ProfileViewRepository.Record exec error for viewer %d and user %d: %v", viewerID, viewedID, err)
+	}
+	return err
+}
+
+// ListViewers returns the active users who viewed the profile outside incognito mode, most recent
+// viewer first.
+func (r *ProfileViewRepository) ListViewers(viewedID, limit, offset int) ([]models.ProfileViewer, error) {
+	rows, err := r.db.Query(`
+        SELECT v.viewer_id, u.username, COUNT(*), MAX(v.viewed_at) FROM profile_views v
+        JOIN users u ON u.id = v.viewer_id
+        WHERE v.viewed_id = $1 AND NOT v.incognito AND u.is_active = true
+        GROUP BY v.viewer_id, u.username
+        ORDER BY MAX(v.viewed_at) DESC, v.viewer_id
+        LIMIT $2 OFFSET $3`, viewedID, limit, offset)
+	if err != nil {
+		log.Printf("ProfileViewRepository.ListViewers query error for user %d: %v", viewedID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	viewers := []models.ProfileViewer{}
+	for rows.Next() {
+		var viewer models.ProfileViewer
+		if err := rows.Scan(&viewer.UserID, &viewer.Username, &viewer.ViewCount, &viewer.LastViewedAt); err != nil {
+			log.Printf("ProfileViewRepository.ListViewers scan error for user %d: %v", viewedID, err)
+			return nil, err
+		}
+		viewers = append(viewers, viewer)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("ProfileViewRepository.ListViewers rows error for user %d: %v", viewedID, err)
+		return nil, err
+	}
+	return viewers, nil
+}
+
+// Counts returns the view counts of the profile over the same views ListViewers shows.
+func (r *ProfileViewRepository) Counts(viewedID int) (models.ProfileViewCounts, error) {
+	var counts models.ProfileViewCounts
+	err := r.db.QueryRow(`
+        SELECT COUNT(*), COUNT(DISTINCT v.viewer_id),
+               COUNT(*) FILTER (WHERE v.viewed_at >= NOW() - INTERVAL '7 days')
+        FROM profile_views v
+        JOIN users u ON u.id = v.viewer_id
+        WHERE v.viewed_id = $1 AND NOT v.incognito AND u.is_active = true`, viewedID).
+		Scan(&counts.TotalViews, &counts.UniqueViewers, &counts.ViewsLast7Days)
+	if err != nil {
+		log.Printf("ProfileViewRepository.Counts query error for user %d: %v", viewedID, err)
+	}
+	return counts, err
+}
+
+// GetSettings returns the user's view settings; users without stored settings are not incognito.
+func (r *ProfileViewRepository) GetSettings(userID int) (models.ProfileViewSettings, error) {
+	var settings models.ProfileViewSettings
+	err := r.db.QueryRow(`SELECT incognito FROM profile_view_settings WHERE user_id = $1`, userID).
+		Scan(&settings.Incognito)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		log.Printf("ProfileViewRepository.GetSettings query error for user %d: %v", userID, err)
+	}
+	return settings, err
+}
+
+// SaveSettings stores the user's view settings.
+func (r *ProfileViewRepository) SaveSettings(userID int, settings models.ProfileViewSettings) error {
+	_, err := r.db.Exec(`
+        INSERT INTO profile_view_settings (user_id, incognito) VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE SET incognito = EXCLUDED.incognito, updated_at = NOW()`,
+		userID, settings.Incognito)
+	if err != nil {
+		log.Printf("ProfileViewRepository.SaveSettings exec error for user %d: %v", userID, err)
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// ErrRoleNotGranted indicates that the user does not hold the role.
+var ErrRoleNotGranted = errors.New("role not granted")
+
+// RoleRepository stores the roles granted to users.
+type RoleRepository struct {
+	db *sql.DB
+}
+
+// NewRoleRepository creates a new RoleRepository.
+func NewRoleRepository(db *sql.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// ListForUser returns the roles held by the user in alphabetical order.
+func (r *RoleRepository) ListForUser(userID int) ([]string, error) {
+	rows, err := r.db.Query(`SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`, userID)
+	if err != nil {
+		log.Printf("RoleRepository.ListForUser query error for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			log.Printf("RoleRepository.ListForUser scan error for user %d: %v", userID, err)
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("RoleRepository.ListForUser rows error for user %d: %v", userID, err)
+		return nil, err
+	}
+	return roles, nil
+}
+
+// HasAny reports whether the user holds at least one of the roles.
+func (r *RoleRepository) HasAny(userID int, roles []string) (bool, error) {
+	var granted bool
+	err := r.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM user_roles WHERE user_id = $1 AND role = ANY($2)
+        )`, userID, pq.Array(roles)).Scan(&granted)
+	if err != nil {
+		log.Printf("RoleRepository.HasAny query error for user %d: %v", userID, err)
+	}
+	return granted, err
+}
+
+// GrantTx gives the user a role within the supplied transaction and reports whether it was new.
+func (r *RoleRepository) GrantTx(tx *sql.Tx, userID int, role string, grantedBy int) (bool, error) {
+	res, err := tx.Exec(`
+        INSERT INTO user_roles (user_id, role, granted_by)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, role) DO NOTHING`, userID, role, grantedBy)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return false, ErrUserNotFound
+		}
+		log.Printf("RoleRepository.GrantTx exec error for user %d: %v", userID, err)
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// RevokeTx takes a role away from the user within the supplied transaction.
+func (r *RoleRepository) RevokeTx(tx *sql.Tx, userID int, role string) error {
+	res, err := tx.Exec(`DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userID, role)
+	if err != nil {
+		log.Printf("RoleRepository.RevokeTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRoleNotGranted
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// ErrSessionNotFound indicates that no active session matched the lookup.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRepository manages server-side login sessions.
+type SessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository creates a new SessionRepository.
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create stores a new session together with the hash of its refresh token.
+func (r *SessionRepository) Create(session models.Session, refreshTokenHash string) error {
+	_, err := r.db.Exec(`
+        INSERT INTO user_sessions (id, user_id, refresh_token_hash, device_label, user_agent, ip_address, created_at, last_used_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		session.ID, session.UserID, refreshTokenHash, session.DeviceLabel, session.UserAgent, session.IPAddress,
+		session.CreatedAt, session.LastUsedAt, session.ExpiresAt)
+	if err != nil {
+		log.Printf("SessionRepository.Create exec error for user %d: %v", session.UserID, err)
+	}
+	return err
+}
+
+// Rotate swaps the refresh token of the active session matching currentHash, extends its expiry and
+// records the IP address it was last used from. Presenting a refresh token that was already rotated
+// away revokes the session, since it means the token was copied and used by someone else.
+func (r *SessionRepository) Rotate(currentHash, nextHash string, expiresAt time.Time, ipAddress string) (models.Session, error) {
+	var session models.Session
+	err := r.db.QueryRow(`
+        UPDATE user_sessions
+        SET previous_refresh_token_hash = refresh_token_hash, refresh_token_hash = $2,
+            last_used_at = NOW(), expires_at = $3, ip_address = $4
+        WHERE refresh_token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+        RETURNING id, user_id`, currentHash, nextHash, expiresAt, ipAddress).Scan(&session.ID, &session.UserID)
+	if err == nil {
+		return session, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("SessionRepository.Rotate exec error: %v", err)
+		return models.Session{}, err
+	}
+
+	res, err := r.db.Exec(`
+        UPDATE user_sessions
+        SET revoked_at = NOW()
+        WHERE previous_refresh_token_hash = $1 AND revoked_at IS NULL`, currentHash)
+	if err != nil {
+		log.Printf("SessionRepository.Rotate reuse revoke error: %v", err)
+		return models.Session{}, err
+	}
+	if rows, _ := res.RowsAffected(); rows > 0 {
+		log.Printf("SessionRepository.Rotate revoked session after refresh token reuse")
+	}
+	return models.Session{}, ErrSessionNotFound
+}
+
+// IsActive reports whether the session exists for the user and has been neither revoked nor expired.
+func (r *SessionRepository) IsActive(sessionID string, userID int) (bool, error) {
+	var active bool
+	err := r.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM user_sessions
+            WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+        )`, sessionID, userID).Scan(&active)
+	if err != nil {
+		log.Printf("SessionRepository.IsActive query error for session %s: %v", sessionID, err)
+	}
+	return active, err
+}
+
+// ListActive returns the sessions of the user that are neither revoked nor expired, most recently
+// used first.
+func (r *SessionRepository) ListActive(userID int) ([]models.Session, error) {
+	rows, err := r.db.Query(`
+        SELECT id, user_id, device_label, user_agent, ip_address, created_at, last_used_at, expires_at
+        FROM user_sessions
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+        ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		log.Printf("SessionRepository.ListActive query error for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt); err != nil {
+			log.Printf("SessionRepository.ListActive scan error for user %d: %v", userID, err)
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("SessionRepository.ListActive rows error for user %d: %v", userID, err)
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Revoke marks a single session of the user as revoked.
+func (r *SessionRepository) Revoke(sessionID string, userID int) error {
+	res, err := r.db.Exec(`
+        UPDATE user_sessions
+        SET revoked_at = NOW()
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, sessionID, userID)
+	if err != nil {
+		log.Printf("SessionRepository.Revoke exec error for session %s: %v", sessionID, err)
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every active session of the user except exceptID, which may be empty,
+// and returns how many were revoked.
+func (r *SessionRepository) RevokeAllForUser(userID int, exceptID string) (int64, error) {
+	res, err := r.db.Exec(`
+        UPDATE user_sessions
+        SET revoked_at = NOW()
+        WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2`, userID, exceptID)
+	if err != nil {
+		log.Printf("SessionRepository.RevokeAllForUser exec error for user %d: %v", userID, err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RevokeAllForUserTx revokes every active session of the user within the supplied transaction.
+func (r *SessionRepository) RevokeAllForUserTx(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`
+        UPDATE user_sessions
+        SET revoked_at = NOW()
+        WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		log.Printf("SessionRepository.RevokeAllForUserTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// RevokeOthersTx revokes every active session of the user except keepID within the supplied transaction.
+func (r *SessionRepository) RevokeOthersTx(tx *sql.Tx, userID int, keepID string) error {
+	_, err := tx.Exec(`
+        UPDATE user_sessions
+        SET revoked_at = NOW()
+        WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2`, userID, keepID)
+	if err != nil {
+		log.Printf("SessionRepository.RevokeOthersTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// ErrTwoFactorNotFound indicates that the user has no TOTP enrollment.
+var ErrTwoFactorNotFound = errors.New("two-factor enrollment not found")
+
+// TwoFactorRepository stores TOTP enrollments and recovery codes.
+type TwoFactorRepository struct {
+	db *sql.DB
+}
+
+// NewTwoFactorRepository creates a new TwoFactorRepository.
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+// IsEnabled reports whether the user has a confirmed TOTP enrollment.
+func (r *TwoFactorRepository) IsEnabled(userID int) (bool, error) {
+	var enabled bool
+	err := r.db.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL
+        )`, userID).Scan(&enabled)
+	if err != nil {
+		log.Printf("TwoFactorRepository.IsEnabled query error for user %d: %v", userID, err)
+	}
+	return enabled, err
+}
+
+// Get returns the TOTP enrollment of the user, confirmed or not.
+func (r *TwoFactorRepository) Get(userID int) (models.TOTPEnrollment, error) {
+	enrollment := models.TOTPEnrollment{UserID: userID}
+	var confirmedAt sql.NullTime
+	err := r.db.QueryRow(`
+        SELECT secret_encrypted, confirmed_at, last_used_step
+        FROM user_totp
+        WHERE user_id = $1`, userID).Scan(&enrollment.SecretEncrypted, &confirmedAt, &enrollment.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TOTPEnrollment{}, ErrTwoFactorNotFound
+		}
+		log.Printf("TwoFactorRepository.Get query error for user %d: %v", userID, err)
+		return models.TOTPEnrollment{}, err
+	}
+	if confirmedAt.Valid {
+		t := confirmedAt.Time
+		enrollment.ConfirmedAt = &t
+	}
+	return enrollment, nil
+}
+
+// SavePending stores a new unconfirmed enrollment, replacing an earlier unconfirmed one. It returns
+// false when a confirmed enrollment already exists.
+func (r *TwoFactorRepository) SavePending(userID int, encryptedSecret string) (bool, error) {
+	res, err := r.db.Exec(`
+        INSERT INTO user_totp (user_id, secret_encrypted)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret_encrypted = EXCLUDED.secret_encrypted, last_used_step = 0, created_at = NOW()
+        WHERE user_totp.confirmed_at IS NULL`, userID, encryptedSecret)
+	if err != nil {
+		log.Printf("TwoFactorRepository.SavePending exec error for user %d: %v", userID, err)
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// UseStepTx records step as the last accepted one. It returns false when an equal or later step was
+// already used, which means the code is being replayed.
+func (r *TwoFactorRepository) UseStepTx(tx *sql.Tx, userID int, step int64) (bool, error) {
+	res, err := tx.Exec(`
+        UPDATE user_totp
+        SET last_used_step = $2
+        WHERE user_id = $1 AND last_used_step < $2`, userID, step)
+	if err != nil {
+		log.Printf("TwoFactorRepository.UseStepTx exec error for user %d: %v", userID, err)
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// ConfirmTx marks the pending enrollment of the user as confirmed.
+func (r *TwoFactorRepository) ConfirmTx(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`UPDATE user_totp SET confirmed_at = NOW() WHERE user_id = $1`, userID)
+	if err != nil {
+		log.Printf("TwoFactorRepository.ConfirmTx exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// DeleteTx removes the enrollment and every recovery code of the user.
+func (r *TwoFactorRepository) DeleteTx(tx *sql.Tx, userID int) error {
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		log.Printf("TwoFactorRepository.DeleteTx recovery codes error for user %d: %v", userID, err)
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		log.Printf("TwoFactorRepository.DeleteTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodesTx drops every recovery code of the user and stores the given hashes.
+func (r *TwoFactorRepository) ReplaceRecoveryCodesTx(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		log.Printf("TwoFactorRepository.ReplaceRecoveryCodesTx delete error for user %d: %v", userID, err)
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			log.Printf("TwoFactorRepository.ReplaceRecoveryCodesTx insert error for user %d: %v", userID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCodeTx marks an unused recovery code as used and reports whether one matched.
+func (r *TwoFactorRepository) UseRecoveryCodeTx(tx *sql.Tx, userID int, codeHash string) (bool, error) {
+	res, err := tx.Exec(`
+        UPDATE user_recovery_codes
+        SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		log.Printf("TwoFactorRepository.UseRecoveryCodeTx exec error for user %d: %v", userID, err)
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left.
+func (r *TwoFactorRepository) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+        SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		log.Printf("TwoFactorRepository.CountRecoveryCodes query error for user %d: %v", userID, err)
+	}
+	return count, err
+}
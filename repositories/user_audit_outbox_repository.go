@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// UserAuditOutboxRepository manages audit records queued for the audit consumer.
+type UserAuditOutboxRepository struct {
+	db *sql.DB
+}
+
+// NewUserAuditOutboxRepository creates a repository backed by the provided database handle.
+func NewUserAuditOutboxRepository(db *sql.DB) *UserAuditOutboxRepository {
+	return &UserAuditOutboxRepository{db: db}
+}
+
+// EnqueueTx inserts an audit record inside the supplied transaction to keep it atomic with the audited change.
+func (r *UserAuditOutboxRepository) EnqueueTx(tx *sql.Tx, event models.UserAuditOutbox) error {
+	_, err := tx.Exec(`
+        INSERT INTO user_audit_outbox (event_id, user_id, event_type, payload, processed, created_at)
+        VALUES ($1, $2, $3, $4, false, $5)`,
+		event.EventID, event.UserID, event.EventType, event.Payload, event.CreatedAt)
+	if err != nil {
+		log.Printf("UserAuditOutboxRepository.EnqueueTx exec error for user %d: %v", event.UserID, err)
+	}
+	return err
+}
+
+// FetchPending returns at most limit unprocessed audit records ordered by creation time.
+func (r *UserAuditOutboxRepository) FetchPending(limit int) ([]models.UserAuditOutbox, error) {
+	rows, err := r.db.Query(`
+        SELECT event_id, user_id, event_type, payload, processed, processed_at, created_at
+        FROM user_audit_outbox
+        WHERE processed = false
+        ORDER BY created_at
+        LIMIT $1`, limit)
+	if err != nil {
+		log.Printf("UserAuditOutboxRepository.FetchPending query error: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.UserAuditOutbox
+	for rows.Next() {
+		var event models.UserAuditOutbox
+		var processedAt sql.NullTime
+		if err := rows.Scan(&event.EventID, &event.UserID, &event.EventType, &event.Payload, &event.Processed, &processedAt, &event.CreatedAt); err != nil {
+			log.Printf("UserAuditOutboxRepository.FetchPending scan error: %v", err)
+			return nil, err
+		}
+		if processedAt.Valid {
+			t := processedAt.Time
+			event.ProcessedAt = &t
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("UserAuditOutboxRepository.FetchPending rows error: %v", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// MarkProcessed flags an audit record as processed and records when it was delivered.
+func (r *UserAuditOutboxRepository) MarkProcessed(eventID string) error {
+	_, err := r.db.Exec(`
+        UPDATE user_audit_outbox
+        SET processed = true, processed_at = $1
+        WHERE event_id = $2`, time.Now(), eventID)
+	if err != nil {
+		log.Printf("UserAuditOutboxRepository.MarkProcessed exec error for event %s: %v", eventID, err)
+	}
+	return err
+}
@@ -12,6 +12,7 @@ import (
 var (
 	ErrDuplicateUser = errors.New("duplicate user")
 	ErrUserNotFound  = errors.New("user not found")
+	ErrEmailInUse    = errors.New("email already in use")
 )
 
 func GetUserpwdByUsername(db *sql.DB, username string) (string, int, error) {
@@ -30,17 +31,52 @@ func GetUserpwdByUsername(db *sql.DB, username string) (string, int, error) {
 	return hashedPassword, userId, nil
 }
 
-func CreateUser(db *sql.DB, user models.User) error {
-	_, err := db.Exec("INSERT INTO users (username, email, password) VALUES ($1, $2, $3)", user.Username, user.Email, user.Password)
+// GetUserpwdByEmail returns the password hash and ID of the user registered with the email address,
+// ignoring letter case.
+func GetUserpwdByEmail(db *sql.DB, email string) (string, int, error) {
+	var hashedPassword string
+	var userId int
+
+	err := db.QueryRow("SELECT id, password FROM users WHERE LOWER(email) = LOWER($1)", email).
+		Scan(&userId, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", 0, ErrUserNotFound
+		}
+		log.Printf("GetUserpwdByEmail query error: %v", err)
+		return "", 0, err
+	}
+	return hashedPassword, userId, nil
+}
+
+// GetPasswordHashByID returns the stored password hash of the user.
+func GetPasswordHashByID(db *sql.DB, userID int) (string, error) {
+	var hashedPassword string
+	err := db.QueryRow("SELECT password FROM users WHERE id=$1", userID).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		log.Printf("GetPasswordHashByID query error for %d: %v", userID, err)
+		return "", err
+	}
+	return hashedPassword, nil
+}
+
+// CreateUserTx inserts a new, unverified user within the supplied transaction and returns its ID.
+func CreateUserTx(tx *sql.Tx, user models.User) (int, error) {
+	var id int
+	err := tx.QueryRow("INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id", user.Username, user.Email, user.Password).
+		Scan(&id)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			log.Printf("CreateUser duplicate user %s: %v", user.Username, err)
-			return ErrDuplicateUser
+			log.Printf("CreateUserTx duplicate user %s: %v", user.Username, err)
+			return 0, ErrDuplicateUser
 		}
-		log.Printf("CreateUser exec error for %s: %v", user.Username, err)
-		return err
+		log.Printf("CreateUserTx exec error for %s: %v", user.Username, err)
+		return 0, err
 	}
-	return nil
+	return id, nil
 }
 
 func GetUserIDByUsername(db *sql.DB, username string) (int, error) {
@@ -113,6 +149,154 @@ func GetUserStatusByID(db *sql.DB, userID int) (bool, error) {
 	return isActive, nil
 }
 
+// GetUserIDByEmail returns the ID of the user registered with the given email address, ignoring case.
+func GetUserIDByEmail(db *sql.DB, email string) (int, error) {
+	var id int
+	err := db.QueryRow("SELECT id FROM users WHERE LOWER(email) = LOWER($1)", email).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		log.Printf("GetUserIDByEmail query error: %v", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetUserIDAndEmailByEmail returns the ID and the stored email address of the user registered with
+// the given address, ignoring case.
+func GetUserIDAndEmailByEmail(db *sql.DB, email string) (int, string, error) {
+	var id int
+	var stored string
+	err := db.QueryRow("SELECT id, email FROM users WHERE LOWER(email) = LOWER($1)", email).Scan(&id, &stored)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", ErrUserNotFound
+		}
+		log.Printf("GetUserIDAndEmailByEmail query error: %v", err)
+		return 0, "", err
+	}
+	return id, stored, nil
+}
+
+// UpdatePasswordTx replaces the user's password hash within the supplied transaction.
+func UpdatePasswordTx(tx *sql.Tx, userID int, hashedPassword string) error {
+	res, err := tx.Exec("UPDATE users SET password = $2 WHERE id = $1", userID, hashedPassword)
+	if err != nil {
+		log.Printf("UpdatePasswordTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ReplacePasswordHash swaps the user's password hash for an equivalent one, unless the password was
+// changed since previousHash was read.
+func ReplacePasswordHash(db *sql.DB, userID int, previousHash, hashedPassword string) error {
+	_, err := db.Exec("UPDATE users SET password = $3 WHERE id = $1 AND password = $2", userID, previousHash, hashedPassword)
+	if err != nil {
+		log.Printf("ReplacePasswordHash exec error for user %d: %v", userID, err)
+	}
+	return err
+}
+
+// GetUsernameAndEmailTx returns the username and email address of the user within the supplied transaction.
+func GetUsernameAndEmailTx(tx *sql.Tx, userID int) (string, string, error) {
+	var username, email string
+	err := tx.QueryRow("SELECT username, email FROM users WHERE id=$1", userID).Scan(&username, &email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", ErrUserNotFound
+		}
+		log.Printf("GetUsernameAndEmailTx query error for %d: %v", userID, err)
+		return "", "", err
+	}
+	return username, email, nil
+}
+
+// GetEmailVerificationByID returns the user's email address and whether it has been verified.
+func GetEmailVerificationByID(db *sql.DB, userID int) (string, bool, error) {
+	var email string
+	var verified bool
+	err := db.QueryRow("SELECT email, email_verified FROM users WHERE id=$1", userID).Scan(&email, &verified)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, ErrUserNotFound
+		}
+		log.Printf("GetEmailVerificationByID query error for %d: %v", userID, err)
+		return "", false, err
+	}
+	return email, verified, nil
+}
+
+// MarkEmailVerifiedTx marks the user's address as verified, provided it is still the address the
+// verification token was issued for.
+func MarkEmailVerifiedTx(tx *sql.Tx, userID int, email string) error {
+	res, err := tx.Exec(`
+        UPDATE users
+        SET email_verified = true, email_verified_at = NOW()
+        WHERE id = $1 AND email = $2`, userID, email)
+	if err != nil {
+		log.Printf("MarkEmailVerifiedTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetPendingEmailTx records an address the user wants to switch to. The current address stays in
+// use until ConfirmPendingEmailTx is called.
+func SetPendingEmailTx(tx *sql.Tx, userID int, email string) error {
+	res, err := tx.Exec("UPDATE users SET pending_email = $2 WHERE id = $1", userID, email)
+	if err != nil {
+		log.Printf("SetPendingEmailTx exec error for user %d: %v", userID, err)
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ConfirmPendingEmailTx replaces the user's address with the pending one, provided it is still the
+// address the confirmation token was issued for, and returns the previous address.
+func ConfirmPendingEmailTx(tx *sql.Tx, userID int, email string) (string, error) {
+	var previous string
+	err := tx.QueryRow(`
+        UPDATE users u
+        SET email = u.pending_email, pending_email = NULL, email_verified = true, email_verified_at = NOW()
+        FROM (SELECT email FROM users WHERE id = $1 FOR UPDATE) old
+        WHERE u.id = $1 AND u.pending_email = $2
+        RETURNING old.email`, userID, email).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return "", ErrEmailInUse
+		}
+		log.Printf("ConfirmPendingEmailTx exec error for user %d: %v", userID, err)
+		return "", err
+	}
+	return previous, nil
+}
+
 // DeactivateUserTx sets a user's account as inactive within the supplied transaction.
 func DeactivateUserTx(tx *sql.Tx, userID int) error {
 	res, err := tx.Exec(`
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icpinto/dating-app/repositories"
+)
+
+// loginFailureWindow is how long a failed attempt counts towards backoff and lockout.
+const loginFailureWindow = time.Hour
+
+// loginThrottlePolicy describes how failures for one scope turn into delays. The first freeAttempts
+// failures are not delayed, the following ones double baseDelay each time, and reaching
+// lockoutThreshold locks the scope for lockoutDuration.
+type loginThrottlePolicy struct {
+	scope            string
+	freeAttempts     int
+	baseDelay        time.Duration
+	lockoutThreshold int
+	lockoutDuration  time.Duration
+}
+
+var (
+	usernameThrottlePolicy = loginThrottlePolicy{
+		scope:            repositories.LoginAttemptScopeUsername,
+		freeAttempts:     3,
+		baseDelay:        2 * time.Second,
+		lockoutThreshold: 10,
+		lockoutDuration:  15 * time.Minute,
+	}
+	// Many users can share an address behind NAT, so the IP scope tolerates far more failures.
+	ipThrottlePolicy = loginThrottlePolicy{
+		scope:            repositories.LoginAttemptScopeIP,
+		freeAttempts:     20,
+		baseDelay:        time.Second,
+		lockoutThreshold: 100,
+		lockoutDuration:  30 * time.Minute,
+	}
+)
+
+// delay returns how long further attempts are blocked after the given number of failures.
+func (p loginThrottlePolicy) delay(failures int) time.Duration {
+	if failures >= p.lockoutThreshold {
+		return p.lockoutDuration
+	}
+	if failures <= p.freeAttempts {
+		return 0
+	}
+	delay := p.baseDelay
+	for i := p.freeAttempts + 1; i < failures && delay < p.lockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > p.lockoutDuration {
+		delay = p.lockoutDuration
+	}
+	return delay
+}
+
+// LoginThrottledError is returned while an account or client IP is backing off after failed logins.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter)
+}
+
+// LoginThrottle applies exponential backoff and temporary lockouts to failed logins.
+type LoginThrottle struct {
+	repo *repositories.LoginAttemptRepository
+}
+
+// NewLoginThrottle creates a new LoginThrottle.
+func NewLoginThrottle(repo *repositories.LoginAttemptRepository) *LoginThrottle {
+	return &LoginThrottle{repo: repo}
+}
+
+// Check returns a LoginThrottledError while the account key or IP address is locked.
+func (t *LoginThrottle) Check(key, ipAddress string) error {
+	lockedUntil, locked, err := t.repo.LockedUntil(normalizeLoginKey(key), ipAddress)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	retryAfter := time.Until(lockedUntil)
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return &LoginThrottledError{RetryAfter: retryAfter}
+}
+
+// RecordFailure counts a failed attempt for the account key and the IP address and locks either one
+// when its policy asks for a delay.
+func (t *LoginThrottle) RecordFailure(key, ipAddress string) {
+	t.recordFailure(usernameThrottlePolicy, normalizeLoginKey(key))
+	t.recordFailure(ipThrottlePolicy, ipAddress)
+}
+
+// RecordSuccess clears the failures of the account key. IP failures are left to expire on their own,
+// otherwise an attacker could reset them by signing in to an account of their own.
+func (t *LoginThrottle) RecordSuccess(key string) {
+	if err := t.repo.Clear(repositories.LoginAttemptScopeUsername, normalizeLoginKey(key)); err != nil {
+		log.Printf("LoginThrottle clear error: %v", err)
+	}
+}
+
+func (t *LoginThrottle) recordFailure(policy loginThrottlePolicy, key string) {
+	if key == "" {
+		return
+	}
+	failures, err := t.repo.RecordFailure(policy.scope, key, loginFailureWindow)
+	if err != nil {
+		log.Printf("LoginThrottle record %s failure error: %v", policy.scope, err)
+		return
+	}
+	delay := policy.delay(failures)
+	if delay == 0 {
+		return
+	}
+	if err := t.repo.Lock(policy.scope, key, time.Now().UTC().Add(delay)); err != nil {
+		log.Printf("LoginThrottle lock %s error: %v", policy.scope, err)
+	}
+}
+
+// accountLoginKey is the throttle key of a known account. Identifiers that match no account are
+// throttled under the identifier itself.
+func accountLoginKey(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+func normalizeLoginKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MailMessage is a plain text email sent to a single recipient.
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email such as verification links.
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+// NewMailerFromEnv builds the mailer selected by MAIL_DRIVER. "smtp" delivers through SMTP_HOST,
+// "memory" keeps messages in process and anything else, including the default, writes them to
+// MAIL_FILE_DIR for local development.
+func NewMailerFromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch strings.ToLower(os.Getenv("MAIL_DRIVER")) {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTPMailer(os.Getenv("SMTP_HOST"), port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	case "memory":
+		return NewMemoryMailer()
+	default:
+		dir := os.Getenv("MAIL_FILE_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		return NewFileMailer(dir, from)
+	}
+}
+
+// SMTPMailer sends email through an SMTP relay, authenticating with PLAIN auth when a username is set.
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPMailer creates a new SMTPMailer.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// smtpTimeout bounds an SMTP exchange whose context has no deadline.
+const smtpTimeout = 30 * time.Second
+
+// Send delivers the message to the relay. The connection carries the context's deadline, or
+// smtpTimeout without one, and cancelling the context aborts the exchange in progress.
+func (m *SMTPMailer) Send(ctx context.Context, msg MailMessage) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := m.deliver(conn, msg); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// deliver runs the SMTP exchange smtp.SendMail would over conn: STARTTLS when offered, PLAIN auth
+// when a username is set, then the message.
+func (m *SMTPMailer) deliver(conn net.Conn, msg MailMessage) error {
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(formatMailMessage(m.from, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// FileMailer writes each message as an .eml file so that links can be followed during development.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a new FileMailer writing into dir.
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send writes the message to a new file in the mail directory.
+func (m *FileMailer) Send(ctx context.Context, msg MailMessage) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewString())
+	return os.WriteFile(filepath.Join(m.dir, name), formatMailMessage(m.from, msg), 0o644)
+}
+
+// MemoryMailer records messages in memory. It is meant for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+// NewMemoryMailer creates a new MemoryMailer.
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send records the message.
+func (m *MemoryMailer) Send(ctx context.Context, msg MailMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far.
+func (m *MemoryMailer) Messages() []MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MailMessage(nil), m.messages...)
+}
+
+func formatMailMessage(from string, msg MailMessage) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
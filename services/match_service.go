@@ -73,6 +73,7 @@ type profilePayload struct {
 	ProfileImageThumbURL string   `json:"profile_image_thumb_url"`
 	Verified             bool     `json:"verified"`
 	ModerationStatus     string   `json:"moderation_status"`
+	Completeness         int      `json:"completeness"`
 	LastActiveAt         string   `json:"last_active_at"`
 	Metadata             string   `json:"metadata"`
 	CreatedAt            string   `json:"created_at"`
@@ -123,6 +124,7 @@ func (d corePreferencesDTO) toModel() models.CorePreferences {
 }
 
 func newProfilePayload(profile models.Profile) profilePayload {
+	hideRejectedContent(&profile)
 	return profilePayload{
 		UserID:               profile.UserID,
 		Bio:                  profile.Bio,
@@ -167,6 +169,7 @@ func newProfilePayload(profile models.Profile) profilePayload {
 		ProfileImageThumbURL: profile.ProfileImageThumbURL,
 		Verified:             profile.Verified,
 		ModerationStatus:     profile.ModerationStatus,
+		Completeness:         profile.Completeness,
 		LastActiveAt:         profile.LastActiveAt,
 		Metadata:             profile.Metadata,
 		CreatedAt:            profile.CreatedAt,
@@ -221,6 +224,7 @@ func (d profileDTO) toModel() models.Profile {
 		ProfileImageThumbURL: payload.ProfileImageThumbURL,
 		Verified:             payload.Verified,
 		ModerationStatus:     payload.ModerationStatus,
+		Completeness:         payload.Completeness,
 		LastActiveAt:         payload.LastActiveAt,
 		Metadata:             payload.Metadata,
 		CreatedAt:            payload.CreatedAt,
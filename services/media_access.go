@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"log"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+// ErrMediaForbidden is returned when a user may not see a stored media object.
+var ErrMediaForbidden = errors.New("media access forbidden")
+
+// AuthorizeMediaAccess decides whether the media stored under key may be served. A request with a
+// valid signed URL passes viewerID 0 and signed set; the signature already proves that an
+// endpoint handed the URL out. Otherwise viewerID is the authenticated caller, who may see the
+// media of their own profile, of users they are connected with through an accepted friend request
+// and, as an admin or moderator, of everyone. Media no profile uses, or only profiles of
+// deactivated accounts, is reported as ErrMediaNotFound to everyone but its owner; so is media only
+// used in rejected photos, except to admins and moderators.
+func (s *ProfileService) AuthorizeMediaAccess(viewerID int, key string, signed bool) error {
+	owners, err := s.photoRepo.FindMediaOwners(key)
+	if err != nil {
+		log.Printf("AuthorizeMediaAccess owner lookup error for %s: %v", key, err)
+		return err
+	}
+
+	var activeOwners, visibleOwners []int
+	for _, owner := range owners {
+		if viewerID != 0 && owner.UserID == viewerID {
+			return nil
+		}
+		if owner.Active {
+			activeOwners = append(activeOwners, owner.UserID)
+			if !owner.Rejected {
+				visibleOwners = append(visibleOwners, owner.UserID)
+			}
+		}
+	}
+	if len(activeOwners) == 0 {
+		return ErrMediaNotFound
+	}
+	if signed {
+		// A URL signed before the photo was rejected stops working with the rejection.
+		if len(visibleOwners) == 0 {
+			return ErrMediaNotFound
+		}
+		return nil
+	}
+
+	staff, err := s.roleRepo.HasAny(viewerID, []string{models.RoleAdmin, models.RoleModerator})
+	if err != nil {
+		log.Printf("AuthorizeMediaAccess role lookup error for user %d: %v", viewerID, err)
+		return err
+	}
+	if staff {
+		return nil
+	}
+	if len(visibleOwners) == 0 {
+		return ErrMediaNotFound
+	}
+	for _, ownerID := range visibleOwners {
+		connected, err := s.friendRepo.AreConnected(viewerID, ownerID)
+		if err != nil {
+			log.Printf("AuthorizeMediaAccess connection lookup error for users %d and %d: %v", viewerID, ownerID, err)
+			return err
+		}
+		if connected {
+			return nil
+		}
+	}
+	return ErrMediaForbidden
+}
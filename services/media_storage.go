@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrMediaNotFound is returned when no object is stored under the key.
+	ErrMediaNotFound = errors.New("media not found")
+	// ErrInvalidMediaKey is returned for keys that are empty or could escape the storage root.
+	ErrInvalidMediaKey = errors.New("invalid media key")
+)
+
+// MediaObject describes a stored object.
+type MediaObject struct {
+	ContentType string
+	Size        int64
+}
+
+// MediaStorage stores uploaded media such as profile photos. Keys are slash separated relative
+// paths.
+type MediaStorage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens the object for reading; the caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, MediaObject, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewMediaStorageFromEnv builds the storage selected by MEDIA_STORAGE_DRIVER. "s3" stores objects in
+// the S3-compatible bucket S3_BUCKET at S3_ENDPOINT; anything else, including the default, stores
+// them in MEDIA_LOCAL_DIR. The local driver only suits a single replica.
+func NewMediaStorageFromEnv() (MediaStorage, error) {
+	switch strings.ToLower(os.Getenv("MEDIA_STORAGE_DRIVER")) {
+	case "s3":
+		config := S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       true,
+		}
+		if raw := strings.TrimSpace(os.Getenv("S3_FORCE_PATH_STYLE")); raw != "" {
+			pathStyle, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("S3_FORCE_PATH_STYLE: %w", err)
+			}
+			config.PathStyle = pathStyle
+		}
+		return NewS3MediaStorage(config)
+	default:
+		dir := os.Getenv("MEDIA_LOCAL_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		return NewLocalMediaStorage(dir), nil
+	}
+}
+
+// validMediaKey rejects keys that are absolute, not in canonical form or reach outside the root.
+func validMediaKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return false
+	}
+	if path.Clean(key) != key {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// LocalMediaStorage keeps objects as files below a directory.
+type LocalMediaStorage struct {
+	root string
+}
+
+// NewLocalMediaStorage creates a new LocalMediaStorage rooted at dir.
+func NewLocalMediaStorage(dir string) *LocalMediaStorage {
+	return &LocalMediaStorage{root: dir}
+}
+
+func (s *LocalMediaStorage) path(key string) (string, error) {
+	if !validMediaKey(key) {
+		return "", ErrInvalidMediaKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object through a temporary file so readers never see a partial object.
+func (s *LocalMediaStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get opens the file stored under key. The content type is derived from the extension.
+func (s *LocalMediaStorage) Get(ctx context.Context, key string) (io.ReadCloser, MediaObject, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, MediaObject{}, err
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, MediaObject{}, ErrMediaNotFound
+		}
+		return nil, MediaObject{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, MediaObject{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, MediaObject{}, ErrMediaNotFound
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return file, MediaObject{ContentType: contentType, Size: info.Size()}, nil
+}
+
+// Delete removes the file stored under key.
+func (s *LocalMediaStorage) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config points S3MediaStorage at a bucket of an S3-compatible service such as AWS S3 or MinIO.
+type S3Config struct {
+	// Endpoint is the base URL of the service, for example https://s3.eu-west-1.amazonaws.com or
+	// http://localhost:9000.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses objects as Endpoint/Bucket/key instead of Bucket.Endpoint/key. MinIO
+	// and most self-hosted services need it.
+	PathStyle bool
+	// HTTPClient defaults to a client with a 30 second timeout.
+	HTTPClient *http.Client
+}
+
+// S3MediaStorage stores objects in an S3-compatible bucket, signing requests with AWS Signature
+// Version 4.
+type S3MediaStorage struct {
+	endpoint        *url.URL
+	region          string
+	bucket          string
+	accessKeyID     string
+	secretAccessKey string
+	pathStyle       bool
+	client          *http.Client
+	now             func() time.Time
+}
+
+// NewS3MediaStorage creates a new S3MediaStorage. The region defaults to us-east-1, which MinIO
+// accepts unless configured otherwise.
+func NewS3MediaStorage(config S3Config) (*S3MediaStorage, error) {
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT must be an http or https URL, got %q", config.Endpoint)
+	}
+	switch {
+	case config.Bucket == "":
+		return nil, errors.New("S3_BUCKET is required")
+	case config.AccessKeyID == "" || config.SecretAccessKey == "":
+		return nil, errors.New("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+	}
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &S3MediaStorage{
+		endpoint:        endpoint,
+		region:          region,
+		bucket:          config.Bucket,
+		accessKeyID:     config.AccessKeyID,
+		secretAccessKey: config.SecretAccessKey,
+		pathStyle:       config.PathStyle,
+		client:          client,
+		now:             time.Now,
+	}, nil
+}
+
+// Put uploads the object.
+func (s *S3MediaStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3ResponseError("put", key, resp)
+	}
+	return nil
+}
+
+// Get downloads the object.
+func (s *S3MediaStorage) Get(ctx context.Context, key string) (io.ReadCloser, MediaObject, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, MediaObject{}, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, MediaObject{ContentType: resp.Header.Get("Content-Type"), Size: resp.ContentLength}, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, MediaObject{}, ErrMediaNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, MediaObject{}, s3ResponseError("get", key, resp)
+	}
+}
+
+// Delete removes the object.
+func (s *S3MediaStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return s3ResponseError("delete", key, resp)
+	}
+}
+
+func (s *S3MediaStorage) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	if !validMediaKey(key) {
+		return nil, ErrInvalidMediaKey
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	payloadHash := sha256.Sum256(body)
+	signS3Request(req, hex.EncodeToString(payloadHash[:]), s.accessKeyID, s.secretAccessKey, s.region, s.now())
+	return s.client.Do(req)
+}
+
+func (s *S3MediaStorage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = u.Path + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+func s3ResponseError(op, key string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 %s %s: %s: %s", op, key, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// signS3Request adds the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers of AWS
+// Signature Version 4. The host and every header already set on the request are signed.
+func signS3Request(req *http.Request, payloadHash, accessKeyID, secretAccessKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+	signature := s3Signature(secretAccessKey, amzDate, scope, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+// s3Signature signs a canonical request for the credential scope date/region/s3/aws4_request.
+func s3Signature(secretAccessKey, amzDate, scope, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func s3EscapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return s3Escape(p, true)
+}
+
+// s3Escape percent-encodes everything except the unreserved characters of RFC 3986, and slashes
+// when keepSlash is set, as Signature Version 4 requires.
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', keepSlash && c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// ErrOIDCTokenInvalid is returned when the provider rejects the authorization code or the ID token
+// it returns fails verification.
+var ErrOIDCTokenInvalid = errors.New("oidc token invalid")
+
+// oidcKeyRefreshInterval limits how often an unknown key ID makes us refetch the provider's JWKS.
+const oidcKeyRefreshInterval = time.Minute
+
+// OIDCProviderConfig describes an OpenID Connect provider users can sign in with.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// LoadOIDCProvidersFromEnv reads the providers named in OIDC_PROVIDERS, a comma separated list such
+// as "google". Each provider is configured through OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and optionally OIDC_<NAME>_REDIRECT_URL and OIDC_<NAME>_SCOPES.
+// Providers without an issuer or client ID are skipped with a warning.
+func LoadOIDCProvidersFromEnv() []OIDCProviderConfig {
+	var configs []OIDCProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		config := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			log.Printf("OIDC provider %q is missing %sISSUER or %sCLIENT_ID; skipping it", name, prefix, prefix)
+			continue
+		}
+		if config.RedirectURL == "" {
+			config.RedirectURL = appBaseURL() + "/login/oidc/" + name + "/callback"
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = []string{"openid", "email", "profile"}
+		}
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// OIDCIdentity holds the verified claims of an ID token.
+type OIDCIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider talks to one provider. The discovery document is fetched once and signing keys are
+// cached until a token names a key ID we have not seen.
+type oidcProvider struct {
+	config OIDCProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func newOIDCProvider(config OIDCProviderConfig) *oidcProvider {
+	return &oidcProvider{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return *p.discovery, nil
+	}
+
+	var doc oidcDiscovery
+	wellKnown := strings.TrimRight(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &doc); err != nil {
+		return oidcDiscovery{}, fmt.Errorf("discover %s: %w", p.config.Name, err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != strings.TrimRight(p.config.Issuer, "/") {
+		return oidcDiscovery{}, fmt.Errorf("discover %s: issuer %q does not match configured issuer", p.config.Name, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return oidcDiscovery{}, fmt.Errorf("discover %s: incomplete discovery document", p.config.Name)
+	}
+	p.discovery = &doc
+	return doc, nil
+}
+
+// authorizationURL returns the URL the browser is sent to, using PKCE with the S256 method.
+func (p *oidcProvider) authorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	endpoint, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// exchange redeems an authorization code and returns the raw ID token.
+func (p *oidcProvider) exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("exchange code with %s: %w", p.config.Name, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("%w: %s rejected the authorization code: %s", ErrOIDCTokenInvalid, p.config.Name, body)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("exchange code with %s: unexpected status %d", p.config.Name, resp.StatusCode)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return "", fmt.Errorf("exchange code with %s: %w", p.config.Name, err)
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("%w: %s returned no id_token", ErrOIDCTokenInvalid, p.config.Name)
+	}
+	return tokens.IDToken, nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token.
+func (p *oidcProvider) verifyIDToken(ctx context.Context, rawIDToken, nonce string) (OIDCIdentity, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.Alg() {
+		case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg(), jwt.SigningMethodEdDSA.Alg():
+		default:
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, doc.JWKSURI, kid)
+	})
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+	switch {
+	case issuer != doc.Issuer:
+		return OIDCIdentity{}, fmt.Errorf("%w: unexpected issuer %q", ErrOIDCTokenInvalid, issuer)
+	case subject == "":
+		return OIDCIdentity{}, fmt.Errorf("%w: missing subject", ErrOIDCTokenInvalid)
+	case !audienceContains(claims["aud"], p.config.ClientID):
+		return OIDCIdentity{}, fmt.Errorf("%w: token was issued for another client", ErrOIDCTokenInvalid)
+	case claims["exp"] == nil:
+		return OIDCIdentity{}, fmt.Errorf("%w: missing expiry", ErrOIDCTokenInvalid)
+	case claims["nonce"] != nonce:
+		return OIDCIdentity{}, fmt.Errorf("%w: nonce mismatch", ErrOIDCTokenInvalid)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.config.ClientID {
+		return OIDCIdentity{}, fmt.Errorf("%w: token was authorized for another client", ErrOIDCTokenInvalid)
+	}
+
+	identity := OIDCIdentity{Issuer: issuer, Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	return identity, nil
+}
+
+func (p *oidcProvider) signingKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeyRefreshInterval && p.keys != nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set utils.JSONWebKeySet
+	if err := p.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("fetch signing keys of %s: %w", p.config.Name, err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("OIDC provider %s: skipping signing key: %v", p.config.Name, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// audienceContains accepts both forms of the aud claim: a single string or a list of strings.
+func audienceContains(aud interface{}, clientID string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == clientID
+	case []interface{}:
+		for _, entry := range value {
+			if entry == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// OIDCStateTTL bounds how long a user has to finish signing in at the provider.
+const OIDCStateTTL = 10 * time.Minute
+
+const (
+	generatedUsernameMaxLength = 30
+	generatedUsernameAttempts  = 5
+)
+
+var (
+	// ErrOIDCProviderUnknown is returned for a provider name that is not configured.
+	ErrOIDCProviderUnknown = errors.New("unknown oidc provider")
+	// ErrOIDCEmailRequired is returned when a new account would be created without a verified email.
+	ErrOIDCEmailRequired = errors.New("oidc provider did not share a verified email address")
+	// ErrOIDCAccountExists is returned when signing in with a new identity whose email belongs to an
+	// existing account. The owner has to sign in and link the identity explicitly.
+	ErrOIDCAccountExists = errors.New("an account already uses the email address of this identity")
+	// ErrOIDCLinkUserMismatch is returned when an authorization request is completed by someone other
+	// than the user who started it: link requests must be finished by their signed-in user and sign-in
+	// requests without one.
+	ErrOIDCLinkUserMismatch = errors.New("oidc request was started by another user")
+	// ErrLastSignInMethod is returned when unlinking the only identity of an account without a password.
+	ErrLastSignInMethod = errors.New("cannot remove the last sign-in method")
+)
+
+// OIDCLoginResult describes what a completed authorization did. Linked is set when a signed-in user
+// linked an identity; otherwise UserID is the account to start a session for.
+type OIDCLoginResult struct {
+	UserID  int
+	Created bool
+	Linked  bool
+}
+
+// OIDCService signs users in with external OpenID Connect providers and manages linked identities.
+type OIDCService struct {
+	db              *sql.DB
+	providers       map[string]*oidcProvider
+	identityRepo    *repositories.IdentityRepository
+	stateRepo       *repositories.OIDCStateRepository
+	auditOutboxRepo *repositories.UserAuditOutboxRepository
+}
+
+// NewOIDCService creates a new OIDCService for the given providers.
+func NewOIDCService(db *sql.DB, configs []OIDCProviderConfig) *OIDCService {
+	providers := make(map[string]*oidcProvider, len(configs))
+	for _, config := range configs {
+		providers[config.Name] = newOIDCProvider(config)
+	}
+	return &OIDCService{
+		db:              db,
+		providers:       providers,
+		identityRepo:    repositories.NewIdentityRepository(db),
+		stateRepo:       repositories.NewOIDCStateRepository(db),
+		auditOutboxRepo: repositories.NewUserAuditOutboxRepository(db),
+	}
+}
+
+// Providers returns the names of the configured providers.
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthorizationURL starts an authorization request and returns the provider URL to send the
+// browser to. A non-zero linkUserID links the resulting identity to that user instead of signing in.
+func (s *OIDCService) AuthorizationURL(ctx context.Context, providerName string, linkUserID int) (string, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", ErrOIDCProviderUnknown
+	}
+
+	state, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+
+	authURL, err := provider.authorizationURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", err
+	}
+	loginState := models.OIDCLoginState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+	}
+	if err := s.stateRepo.Create(utils.HashToken(state), loginState, time.Now().UTC().Add(OIDCStateTTL)); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// Complete finishes an authorization request with the code and state the provider redirected back
+// with. callerID is the signed-in user finishing the request, or zero. Link requests are only
+// finished by the user who started them, so a link URL sent to someone else cannot attach their
+// identity to the sender's account. Otherwise known identities sign in as their user and unknown
+// ones get a new account with a generated username and no password.
+func (s *OIDCService) Complete(ctx context.Context, providerName, code, state string, callerID int) (OIDCLoginResult, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return OIDCLoginResult{}, ErrOIDCProviderUnknown
+	}
+	loginState, err := s.stateRepo.Consume(utils.HashToken(state), providerName)
+	if err != nil {
+		return OIDCLoginResult{}, err
+	}
+	if loginState.LinkUserID != callerID {
+		log.Printf("OIDCService.Complete request of user %d finished by user %d", loginState.LinkUserID, callerID)
+		return OIDCLoginResult{}, ErrOIDCLinkUserMismatch
+	}
+	rawIDToken, err := provider.exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		return OIDCLoginResult{}, err
+	}
+	identity, err := provider.verifyIDToken(ctx, rawIDToken, loginState.Nonce)
+	if err != nil {
+		return OIDCLoginResult{}, err
+	}
+
+	if loginState.LinkUserID != 0 {
+		if err := s.link(ctx, loginState.LinkUserID, providerName, identity, nil); err != nil {
+			return OIDCLoginResult{}, err
+		}
+		return OIDCLoginResult{UserID: loginState.LinkUserID, Linked: true}, nil
+	}
+
+	userID, err := s.identityRepo.RecordLogin(identity.Issuer, identity.Subject)
+	if err == nil {
+		return OIDCLoginResult{UserID: userID}, nil
+	}
+	if !errors.Is(err, repositories.ErrIdentityNotFound) {
+		return OIDCLoginResult{}, err
+	}
+
+	userID, err = s.createUser(ctx, providerName, identity)
+	if err != nil {
+		return OIDCLoginResult{}, err
+	}
+	return OIDCLoginResult{UserID: userID, Created: true}, nil
+}
+
+// ListIdentities returns the identities linked to the user.
+func (s *OIDCService) ListIdentities(userID int) ([]models.LinkedIdentity, error) {
+	identities, err := s.identityRepo.ListForUser(userID)
+	if err != nil {
+		log.Printf("OIDCService.ListIdentities repository error for user %d: %v", userID, err)
+	}
+	return identities, err
+}
+
+// Unlink removes a linked identity. Accounts without a password must keep at least one identity,
+// otherwise nobody could sign in to them.
+func (s *OIDCService) Unlink(ctx context.Context, userID, identityID int) error {
+	hashedPassword, err := repositories.GetPasswordHashByID(s.db, userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	linked, err := s.identityRepo.CountForUserTx(tx, userID)
+	if err != nil {
+		return err
+	}
+	if hashedPassword == "" && linked <= 1 {
+		return ErrLastSignInMethod
+	}
+	if err := s.identityRepo.DeleteTx(tx, userID, identityID); err != nil {
+		return err
+	}
+	event, err := buildAuditEvent(userID, models.UserAuditEventTypeIdentityUnlinked, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.auditOutboxRepo.EnqueueTx(tx, event); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *OIDCService) link(ctx context.Context, userID int, providerName string, identity OIDCIdentity, lastLoginAt *time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.linkTx(tx, userID, providerName, identity, lastLoginAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *OIDCService) linkTx(tx *sql.Tx, userID int, providerName string, identity OIDCIdentity, lastLoginAt *time.Time) error {
+	err := s.identityRepo.CreateTx(tx, models.LinkedIdentity{
+		UserID:      userID,
+		Provider:    providerName,
+		Issuer:      identity.Issuer,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: lastLoginAt,
+	})
+	if err != nil {
+		return err
+	}
+	event, err := buildAuditEvent(userID, models.UserAuditEventTypeIdentityLinked, map[string]string{"provider": providerName})
+	if err != nil {
+		return err
+	}
+	return s.auditOutboxRepo.EnqueueTx(tx, event)
+}
+
+// createUser registers a passwordless account for a new identity. The provider must vouch for the
+// email address, which is why the account starts out verified.
+func (s *OIDCService) createUser(ctx context.Context, providerName string, identity OIDCIdentity) (int, error) {
+	if identity.Email == "" || !identity.EmailVerified || !isValidEmail(identity.Email) {
+		return 0, ErrOIDCEmailRequired
+	}
+	if _, err := repositories.GetUserIDByEmail(s.db, identity.Email); err == nil {
+		return 0, ErrOIDCAccountExists
+	} else if !errors.Is(err, repositories.ErrUserNotFound) {
+		return 0, err
+	}
+	username, err := s.availableUsername(identity)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := repositories.CreateUserTx(tx, models.User{Username: username, Email: identity.Email})
+	if err != nil {
+		return 0, err
+	}
+	if err := repositories.MarkEmailVerifiedTx(tx, userID, identity.Email); err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	if err := s.linkTx(tx, userID, providerName, identity, &now); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// availableUsername derives a username from the identity and adds a random numeric suffix until
+// one is free.
+func (s *OIDCService) availableUsername(identity OIDCIdentity) (string, error) {
+	base := usernameBase(identity)
+	candidate := base
+	for attempt := 0; attempt < generatedUsernameAttempts; attempt++ {
+		_, err := repositories.GetUserIDByUsernameAllowInactive(s.db, candidate)
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%04d", base, suffix.Int64())
+	}
+	return "", repositories.ErrDuplicateUser
+}
+
+// usernameBase picks the first usable source among the preferred username, the local part of the
+// email address and the display name, keeping only lowercase letters, digits, dots and underscores.
+func usernameBase(identity OIDCIdentity) string {
+	localPart, _, _ := strings.Cut(identity.Email, "@")
+	for _, source := range []string{identity.PreferredUsername, localPart, identity.Name} {
+		var b strings.Builder
+		for _, r := range strings.ToLower(source) {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_':
+				b.WriteRune(r)
+			case r == '-', r == ' ':
+				b.WriteRune('_')
+			}
+		}
+		name := strings.Trim(b.String(), "._")
+		// Leave room for the numeric suffix.
+		if len(name) > generatedUsernameMaxLength-4 {
+			name = strings.Trim(name[:generatedUsernameMaxLength-4], "._")
+		}
+		if len(name) >= 3 {
+			return name
+		}
+	}
+	return "user"
+}
@@ -28,6 +28,7 @@ type OutboxWorker struct {
 	matchService        *MatchService
 	lifecycleOutboxRepo *repositories.UserLifecycleOutboxRepository
 	lifecyclePublisher  *RabbitMQPublisher
+	auditOutboxRepo     *repositories.UserAuditOutboxRepository
 }
 
 // NewOutboxWorker creates a new OutboxWorker.
@@ -43,6 +44,7 @@ func NewOutboxWorker(db *sql.DB, baseURL string, matchService *MatchService, lif
 		matchService:        matchService,
 		lifecycleOutboxRepo: repositories.NewUserLifecycleOutboxRepository(db),
 		lifecyclePublisher:  lifecyclePublisher,
+		auditOutboxRepo:     repositories.NewUserAuditOutboxRepository(db),
 	}
 }
 
@@ -66,6 +68,9 @@ func (w *OutboxWorker) process() error {
 	if err := w.processUserLifecycleEvents(); err != nil {
 		return err
 	}
+	if err := w.processUserAuditEvents(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -140,6 +145,30 @@ func (w *OutboxWorker) processUserLifecycleEvents() error {
 	return nil
 }
 
+func (w *OutboxWorker) processUserAuditEvents() error {
+	if w.auditOutboxRepo == nil || w.lifecyclePublisher == nil {
+		return nil
+	}
+	events, err := w.auditOutboxRepo.FetchPending(25)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		publishErr := w.lifecyclePublisher.PublishAuditEvent(ctx, event)
+		cancel()
+		if publishErr != nil {
+			log.Printf("OutboxWorker audit publish error for event %s: %v", event.EventID, publishErr)
+			continue
+		}
+		if err := w.auditOutboxRepo.MarkProcessed(event.EventID); err != nil {
+			log.Printf("OutboxWorker audit mark processed error for event %s: %v", event.EventID, err)
+			continue
+		}
+	}
+	return nil
+}
+
 func (w *OutboxWorker) handleEvent(eventID string, user1ID, user2ID int) error {
 	token, err := utils.GenerateToken(user1ID)
 	if err != nil {
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/icpinto/dating-app/utils"
+)
+
+// BreachedPasswordSet holds SHA-1 digests of passwords known from public breaches.
+type BreachedPasswordSet map[[sha1.Size]byte]struct{}
+
+// Contains reports whether the password appears in the set.
+func (s BreachedPasswordSet) Contains(password string) bool {
+	_, found := s[sha1.Sum([]byte(password))]
+	return found
+}
+
+// LoadBreachedPasswordHashes reads a file with one hex encoded SHA-1 digest per line. The
+// "HASH:COUNT" lines of the Have I Been Pwned downloads are accepted as well; blank lines and
+// lines starting with # are skipped.
+func LoadBreachedPasswordHashes(path string) (BreachedPasswordSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	set := BreachedPasswordSet{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		digest, _, _ := strings.Cut(line, ":")
+		decoded, err := hex.DecodeString(digest)
+		if err != nil || len(decoded) != sha1.Size {
+			return nil, fmt.Errorf("%s:%d: expected a hex encoded SHA-1 digest", path, lineNumber)
+		}
+		var key [sha1.Size]byte
+		copy(key[:], decoded)
+		set[key] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// PasswordPolicy describes what new passwords must look like.
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength is measured in bytes and may not exceed utils.MaxPasswordBytes.
+	MaxLength int
+	// MinCharacterClasses is how many of lowercase letters, uppercase letters, digits and other
+	// characters a password has to mix.
+	MinCharacterClasses int
+	// RejectSimilarToUsername refuses passwords that contain the username or the local part of the
+	// email address, or are contained in them.
+	RejectSimilarToUsername bool
+	Breached                BreachedPasswordSet
+}
+
+// DefaultPasswordPolicy returns the policy used when nothing is configured.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:               10,
+		MaxLength:               128,
+		MinCharacterClasses:     2,
+		RejectSimilarToUsername: true,
+	}
+}
+
+var (
+	passwordPolicyMu      sync.RWMutex
+	currentPasswordPolicy *PasswordPolicy
+)
+
+// LoadPasswordPolicyFromEnv configures the password policy from the environment, starting from
+// DefaultPasswordPolicy. PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_MIN_CHARACTER_CLASSES
+// and PASSWORD_REJECT_SIMILAR_TO_USERNAME override the defaults, and PASSWORD_BREACHED_HASHES_FILE
+// names a file of breached password digests to screen against.
+func LoadPasswordPolicyFromEnv() error {
+	policy := DefaultPasswordPolicy()
+	for name, target := range map[string]*int{
+		"PASSWORD_MIN_LENGTH":            &policy.MinLength,
+		"PASSWORD_MAX_LENGTH":            &policy.MaxLength,
+		"PASSWORD_MIN_CHARACTER_CLASSES": &policy.MinCharacterClasses,
+	} {
+		raw := strings.TrimSpace(os.Getenv(name))
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*target = value
+	}
+	if raw := strings.TrimSpace(os.Getenv("PASSWORD_REJECT_SIMILAR_TO_USERNAME")); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("PASSWORD_REJECT_SIMILAR_TO_USERNAME: %w", err)
+		}
+		policy.RejectSimilarToUsername = value
+	}
+	if path := strings.TrimSpace(os.Getenv("PASSWORD_BREACHED_HASHES_FILE")); path != "" {
+		breached, err := LoadBreachedPasswordHashes(path)
+		if err != nil {
+			return fmt.Errorf("PASSWORD_BREACHED_HASHES_FILE: %w", err)
+		}
+		log.Printf("Loaded %d breached password hashes", len(breached))
+		policy.Breached = breached
+	}
+	return ConfigurePasswordPolicy(policy)
+}
+
+// ConfigurePasswordPolicy replaces the password policy.
+func ConfigurePasswordPolicy(policy PasswordPolicy) error {
+	switch {
+	case policy.MinLength < 1:
+		return fmt.Errorf("password minimum length must be at least 1, got %d", policy.MinLength)
+	case policy.MaxLength < policy.MinLength || policy.MaxLength > utils.MaxPasswordBytes:
+		return fmt.Errorf("password maximum length must be between %d and %d bytes, got %d", policy.MinLength, utils.MaxPasswordBytes, policy.MaxLength)
+	case policy.MinCharacterClasses < 0 || policy.MinCharacterClasses > 4:
+		return fmt.Errorf("password character classes must be between 0 and 4, got %d", policy.MinCharacterClasses)
+	}
+	passwordPolicyMu.Lock()
+	currentPasswordPolicy = &policy
+	passwordPolicyMu.Unlock()
+	return nil
+}
+
+// activePasswordPolicy returns the configured policy, loading it from the environment on first use.
+func activePasswordPolicy() (PasswordPolicy, error) {
+	passwordPolicyMu.RLock()
+	policy := currentPasswordPolicy
+	passwordPolicyMu.RUnlock()
+	if policy != nil {
+		return *policy, nil
+	}
+
+	if err := LoadPasswordPolicyFromEnv(); err != nil {
+		return PasswordPolicy{}, err
+	}
+	passwordPolicyMu.RLock()
+	defer passwordPolicyMu.RUnlock()
+	return *currentPasswordPolicy, nil
+}
+
+// Check records every way the password breaks the policy under the given field name.
+func (p PasswordPolicy) Check(v *utils.ValidationError, field, password, username, email string) {
+	if password == "" {
+		v.Add(field, "required", "Password is required")
+		return
+	}
+	if utf8.RuneCountInString(password) < p.MinLength {
+		v.Add(field, "too_short", fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	}
+	if len(password) > p.MaxLength {
+		v.Add(field, "too_long", fmt.Sprintf("Password must be at most %d bytes long", p.MaxLength))
+	}
+	if characterClasses(password) < p.MinCharacterClasses {
+		v.Add(field, "too_few_character_classes",
+			fmt.Sprintf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharacterClasses))
+	}
+	if p.RejectSimilarToUsername && similarToAccountName(password, username, email) {
+		v.Add(field, "similar_to_username", "Password must not contain or resemble the username or email address")
+	}
+	if p.Breached.Contains(password) {
+		v.Add(field, "breached", "Password appears in a known data breach; choose a different one")
+	}
+}
+
+// validateNewPassword checks a new password against the active policy and returns a
+// *utils.ValidationError describing every problem.
+func validateNewPassword(field, password, username, email string) error {
+	policy, err := activePasswordPolicy()
+	if err != nil {
+		return err
+	}
+	var v utils.ValidationError
+	policy.Check(&v, field, password, username, email)
+	return v.OrNil()
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	count := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// similarToAccountName compares case-insensitively and ignores names shorter than three
+// characters, which would match too many passwords.
+func similarToAccountName(password, username, email string) bool {
+	password = strings.ToLower(password)
+	localPart, _, _ := strings.Cut(email, "@")
+	for _, name := range []string{username, localPart} {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) < 3 {
+			continue
+		}
+		if strings.Contains(password, name) || strings.Contains(name, password) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+
+	"github.com/icpinto/dating-app/models"
+)
+
+const (
+	// completePhotoCount is the number of photos that earns the whole photos section.
+	completePhotoCount = 3
+	// photosSectionWeight is the share of the score earned by completePhotoCount photos.
+	photosSectionWeight = 20
+	// completenessBackfillBatch is the number of unscored profiles scored per query at startup.
+	completenessBackfillBatch = 100
+)
+
+// profileSection is a group of profile fields that is scored together. A section earns its weight
+// in proportion to the fields that are filled in.
+type profileSection struct {
+	name   string
+	weight int
+	fields []profileSectionField
+}
+
+type profileSectionField struct {
+	name   string
+	filled func(models.Profile) bool
+}
+
+func textField(name string, value func(models.Profile) string) profileSectionField {
+	return profileSectionField{name, func(p models.Profile) bool { return value(p) != "" }}
+}
+
+func jsonObjectField(name string, value func(models.Profile) string) profileSectionField {
+	return profileSectionField{name, func(p models.Profile) bool { return value(p) != "" && value(p) != "{}" }}
+}
+
+// profileSections lists the sections scored from profile fields. Together with the photos section,
+// which is scored from the gallery, the weights add up to 100.
+var profileSections = []profileSection{
+	{"about", 15, []profileSectionField{
+		textField("bio", func(p models.Profile) string { return p.Bio }),
+		{"interests", func(p models.Profile) bool { return len(p.Interests) > 0 }},
+		{"languages", func(p models.Profile) bool { return len(p.Languages) > 0 }},
+	}},
+	{"basics", 15, []profileSectionField{
+		textField("gender", func(p models.Profile) string { return p.Gender }),
+		textField("date_of_birth", func(p models.Profile) string { return p.DateOfBirth }),
+		textField("civil_status", func(p models.Profile) string { return p.CivilStatus }),
+		{"height_cm", func(p models.Profile) bool { return p.HeightCM > 0 }},
+		{"weight_kg", func(p models.Profile) bool { return p.WeightKG > 0 }},
+	}},
+	{"location", 10, []profileSectionField{
+		textField("country_code", func(p models.Profile) string { return p.CountryCode }),
+		textField("province", func(p models.Profile) string { return p.Province }),
+		textField("district", func(p models.Profile) string { return p.District }),
+		textField("city", func(p models.Profile) string { return p.City }),
+	}},
+	{"religion", 5, []profileSectionField{
+		textField("religion", func(p models.Profile) string { return p.Religion }),
+		textField("caste", func(p models.Profile) string { return p.Caste }),
+	}},
+	{"lifestyle", 10, []profileSectionField{
+		textField("dietary_preference", func(p models.Profile) string { return p.DietaryPreference }),
+		textField("smoking", func(p models.Profile) string { return p.Smoking }),
+		textField("alcohol", func(p models.Profile) string { return p.Alcohol }),
+	}},
+	{"education", 10, []profileSectionField{
+		textField("highest_education", func(p models.Profile) string { return p.HighestEducation }),
+		textField("field_of_study", func(p models.Profile) string { return p.FieldOfStudy }),
+		textField("institution", func(p models.Profile) string { return p.Institution }),
+	}},
+	{"career", 5, []profileSectionField{
+		textField("employment_status", func(p models.Profile) string { return p.EmploymentStatus }),
+		textField("occupation", func(p models.Profile) string { return p.Occupation }),
+	}},
+	{"family", 5, []profileSectionField{
+		textField("father_occupation", func(p models.Profile) string { return p.FatherOccupation }),
+		textField("mother_occupation", func(p models.Profile) string { return p.MotherOccupation }),
+		jsonObjectField("siblings", func(p models.Profile) string { return p.Siblings }),
+	}},
+	{"horoscope", 5, []profileSectionField{
+		textField("birth_time", func(p models.Profile) string { return p.BirthTime }),
+		textField("birth_place", func(p models.Profile) string { return p.BirthPlace }),
+		textField("sinhala_raasi", func(p models.Profile) string { return p.SinhalaRaasi }),
+		textField("nakshatra", func(p models.Profile) string { return p.Nakshatra }),
+	}},
+}
+
+// scoreProfileCompleteness computes the completeness of a profile with the given gallery. Photos
+// rejected by moderation do not count, and a rejected bio counts as missing.
+func scoreProfileCompleteness(profile models.Profile, photos []models.ProfilePhoto) models.ProfileCompleteness {
+	hideRejectedContent(&profile)
+	completeness := models.ProfileCompleteness{MissingSections: []models.MissingProfileSection{}}
+	var score float64
+
+	photoCount := len(visibleProfilePhotos(photos))
+	if photoCount >= completePhotoCount {
+		score += photosSectionWeight
+	} else {
+		score += float64(photosSectionWeight*photoCount) / completePhotoCount
+		completeness.MissingSections = append(completeness.MissingSections, models.MissingProfileSection{
+			Section:       "photos",
+			Weight:        photosSectionWeight,
+			MissingFields: []string{"photos"},
+		})
+	}
+
+	for _, section := range profileSections {
+		var missing []string
+		for _, field := range section.fields {
+			if !field.filled(profile) {
+				missing = append(missing, field.name)
+			}
+		}
+		filled := len(section.fields) - len(missing)
+		score += float64(section.weight*filled) / float64(len(section.fields))
+		if len(missing) > 0 {
+			completeness.MissingSections = append(completeness.MissingSections, models.MissingProfileSection{
+				Section:       section.name,
+				Weight:        section.weight,
+				MissingFields: missing,
+			})
+		}
+	}
+	completeness.Score = int(math.Round(score))
+	return completeness
+}
+
+// GetProfileCompleteness returns the completeness of the user's profile and what is missing. A user
+// without a profile is scored as an empty profile.
+func (s *ProfileService) GetProfileCompleteness(userID int) (models.ProfileCompleteness, error) {
+	profile, err := s.repo.GetByUserID(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("GetProfileCompleteness repository error for user %d: %v", userID, err)
+		return models.ProfileCompleteness{}, err
+	}
+	photos, err := s.photoRepo.ListForUser(userID)
+	if err != nil {
+		log.Printf("GetProfileCompleteness photo lookup error for user %d: %v", userID, err)
+		return models.ProfileCompleteness{}, err
+	}
+	return scoreProfileCompleteness(profile.Profile, photos), nil
+}
+
+// storeCompleteness scores the saved profile and stores the score when it changed. It reports
+// whether the stored score changed.
+func (s *ProfileService) storeCompleteness(profile *models.Profile) (bool, error) {
+	photos, err := s.photoRepo.ListForUser(profile.UserID)
+	if err != nil {
+		return false, err
+	}
+	score := scoreProfileCompleteness(*profile, photos).Score
+	if score == profile.Completeness {
+		return false, nil
+	}
+	if err := s.repo.SetCompleteness(profile.UserID, score); err != nil {
+		return false, err
+	}
+	profile.Completeness = score
+	return true, nil
+}
+
+// refreshCompleteness rescores the user's profile after its photos changed. It reports whether the
+// stored score changed; users without a profile have nothing to score.
+func (s *ProfileService) refreshCompleteness(userID int) bool {
+	profile, err := s.repo.GetByUserID(userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("ProfileService completeness refresh error for user %d: %v", userID, err)
+		}
+		return false
+	}
+	changed, err := s.storeCompleteness(&profile.Profile)
+	if err != nil {
+		log.Printf("ProfileService completeness refresh error for user %d: %v", userID, err)
+	}
+	return changed
+}
+
+// ScoreUnscoredProfiles stores the completeness score of profiles that have none yet, such as
+// profiles created before scores were kept, and queues them for the matching service. It stops at
+// the first error; the remaining profiles are scored on the next start.
+func (s *ProfileService) ScoreUnscoredProfiles() {
+	for {
+		userIDs, err := s.repo.ListUnscoredUserIDs(completenessBackfillBatch)
+		if err != nil || len(userIDs) == 0 {
+			return
+		}
+		for _, userID := range userIDs {
+			profile, err := s.repo.GetByUserID(userID)
+			if err != nil {
+				log.Printf("ScoreUnscoredProfiles fetch error for user %d: %v", userID, err)
+				return
+			}
+			photos, err := s.photoRepo.ListForUser(userID)
+			if err != nil {
+				log.Printf("ScoreUnscoredProfiles photo lookup error for user %d: %v", userID, err)
+				return
+			}
+			if err := s.repo.SetCompleteness(userID, scoreProfileCompleteness(profile.Profile, photos).Score); err != nil {
+				return
+			}
+			if err := s.EnqueueProfileSync(userID); err != nil {
+				log.Printf("ScoreUnscoredProfiles enqueue sync error for user %d: %v", userID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/utils"
+)
+
+const (
+	defaultProfileHistoryLimit = 20
+	maxProfileHistoryLimit     = 100
+	// maskedValue replaces a sensitive value in the history.
+	maskedValue = "***"
+)
+
+// untrackedProfileFields are profile fields left out of the history: identifiers, timestamps and
+// values derived from other data rather than edited by the user.
+var untrackedProfileFields = map[string]bool{
+	"id":                      true,
+	"user_id":                 true,
+	"profile_image_url":       true,
+	"profile_image_thumb_url": true,
+	"moderation_status":       true,
+	"completeness":            true,
+	"last_active_at":          true,
+	"metadata":                true,
+	"created_at":              true,
+	"updated_at":              true,
+}
+
+// sensitiveProfileFields are masked in the history, which support staff can read. Phone numbers
+// keep their last two digits so a change can still be matched against what the user reports.
+var sensitiveProfileFields = map[string]func(string) string{
+	"phone_number":    maskPhoneNumber,
+	"date_of_birth":   maskValue,
+	"caste":           maskValue,
+	"religion_detail": maskValue,
+	"postal_code":     maskValue,
+	"birth_time":      maskValue,
+	"birth_place":     maskValue,
+	"horoscope":       maskValue,
+}
+
+func maskValue(string) string {
+	return maskedValue
+}
+
+func maskPhoneNumber(value string) string {
+	if len(value) <= 2 {
+		return maskedValue
+	}
+	return maskedValue + value[len(value)-2:]
+}
+
+// profileFieldValues returns the tracked fields of a profile by JSON name. Values are rendered as
+// their JSON text with strings unquoted, and empty lists and objects count as unset.
+func profileFieldValues(profile models.Profile) (map[string]string, error) {
+	encoded, err := json.Marshal(profile)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &raw); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		if untrackedProfileFields[name] {
+			continue
+		}
+		text := string(value)
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			text = s
+		}
+		switch strings.TrimSpace(text) {
+		case "null", "[]", "{}":
+			text = ""
+		}
+		values[name] = text
+	}
+	return values, nil
+}
+
+// diffProfiles lists the tracked fields that differ between two versions of a profile, sorted by
+// name, with sensitive values masked.
+func diffProfiles(previous, current models.Profile) ([]models.ProfileFieldChange, error) {
+	before, err := profileFieldValues(previous)
+	if err != nil {
+		return nil, err
+	}
+	after, err := profileFieldValues(current)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(after))
+	for name := range after {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []models.ProfileFieldChange
+	for _, name := range names {
+		if before[name] == after[name] {
+			continue
+		}
+		change := models.ProfileFieldChange{Field: name, OldValue: before[name], NewValue: after[name]}
+		if mask, ok := sensitiveProfileFields[name]; ok {
+			change.Masked = true
+			if change.OldValue != "" {
+				change.OldValue = mask(change.OldValue)
+			}
+			if change.NewValue != "" {
+				change.NewValue = mask(change.NewValue)
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// recordProfileChangesTx stores the fields changedBy changed between two versions of userID's
+// profile as the next version in the history. Saves that change nothing are not recorded.
+func (s *ProfileService) recordProfileChangesTx(tx *sql.Tx, userID, changedBy int, previous, current models.Profile) error {
+	changes, err := diffProfiles(previous, current)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	return s.historyRepo.InsertTx(tx, &models.ProfileHistoryEntry{UserID: userID, ChangedBy: &changedBy, Changes: changes})
+}
+
+// ListProfileHistory returns a page of the user's profile versions, newest first. A limit of zero
+// selects the default page size; invalid paging is rejected with a *utils.ValidationError.
+func (s *ProfileService) ListProfileHistory(userID, limit, offset int) ([]models.ProfileHistoryEntry, error) {
+	if limit == 0 {
+		limit = defaultProfileHistoryLimit
+	}
+	var invalid utils.ValidationError
+	if limit < 1 || limit > maxProfileHistoryLimit {
+		invalid.Add("limit", "out_of_range", "Limit must be between 1 and "+strconv.Itoa(maxProfileHistoryLimit))
+	}
+	if offset < 0 {
+		invalid.Add("offset", "out_of_range", "Offset must not be negative")
+	}
+	if err := invalid.OrNil(); err != nil {
+		return nil, err
+	}
+	entries, err := s.historyRepo.ListForUser(userID, limit, offset)
+	if err != nil {
+		log.Printf("ListProfileHistory repository error for user %d: %v", userID, err)
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/utils"
+)
+
+const (
+	// MaxModerationReasonLength is the longest rejection reason accepted, in characters.
+	MaxModerationReasonLength = 500
+	// DefaultModerationQueueLimit is the page size of the moderation queue.
+	DefaultModerationQueueLimit = 50
+	// MaxModerationQueueLimit caps the page size of the moderation queue.
+	MaxModerationQueueLimit = 200
+	// userModerationItemLimit is the number of recent items shown to users.
+	userModerationItemLimit = 50
+)
+
+var (
+	// ErrModerationItemDecided is returned when a moderator decides an item that is no longer pending.
+	ErrModerationItemDecided = errors.New("moderation item already decided")
+	// ErrPhotoRejected is returned when a rejected photo is chosen as the primary photo.
+	ErrPhotoRejected = errors.New("profile photo was rejected by moderation")
+)
+
+// hideRejectedContent blanks the parts of a profile that moderators rejected, for every reader
+// but the profile's owner.
+func hideRejectedContent(profile *models.Profile) {
+	if profile.ModerationStatus == models.ModerationStatusRejected {
+		profile.Bio = ""
+	}
+}
+
+// visibleProfilePhotos drops the photos moderators rejected.
+func visibleProfilePhotos(photos []models.ProfilePhoto) []models.ProfilePhoto {
+	visible := make([]models.ProfilePhoto, 0, len(photos))
+	for _, photo := range photos {
+		if photo.ModerationStatus != models.ModerationStatusRejected {
+			visible = append(visible, photo)
+		}
+	}
+	return visible
+}
+
+// queueBioReviewTx keeps the bio review queue in line with the saved profile: a pending bio gets a
+// queue entry carrying its current text and a bio that no longer needs review loses its entry. It
+// runs in the transaction saving the profile, so a pending bio is never left without an entry.
+func (s *ProfileService) queueBioReviewTx(tx *sql.Tx, profile models.Profile) error {
+	switch profile.ModerationStatus {
+	case models.ModerationStatusPending:
+		return s.moderationRepo.UpsertPendingBioTx(tx, profile.UserID, profile.Bio)
+	case models.ProfileModerationClean:
+		return s.moderationRepo.DeletePendingBioTx(tx, profile.UserID)
+	}
+	return nil
+}
+
+// ListModerationQueue returns moderation items by status, pending by default, oldest first.
+func (s *ProfileService) ListModerationQueue(filters models.ModerationFilters) ([]models.ModerationItem, error) {
+	var invalid utils.ValidationError
+	switch filters.Status {
+	case "":
+		filters.Status = models.ModerationStatusPending
+	case models.ModerationStatusPending, models.ModerationStatusApproved, models.ModerationStatusRejected:
+	default:
+		invalid.Add("status", "invalid_choice", "Status must be pending, approved or rejected")
+	}
+	switch filters.Kind {
+	case "", models.ModerationKindPhoto, models.ModerationKindBio:
+	default:
+		invalid.Add("kind", "invalid_choice", "Kind must be photo or bio")
+	}
+	if filters.Limit == 0 {
+		filters.Limit = DefaultModerationQueueLimit
+	}
+	if filters.Limit < 1 || filters.Limit > MaxModerationQueueLimit {
+		invalid.Add("limit", "out_of_range", "Limit must be between 1 and "+strconv.Itoa(MaxModerationQueueLimit))
+	}
+	if filters.Offset < 0 {
+		invalid.Add("offset", "out_of_range", "Offset must not be negative")
+	}
+	if err := invalid.OrNil(); err != nil {
+		return nil, err
+	}
+
+	items, err := s.moderationRepo.List(filters)
+	if err != nil {
+		log.Printf("ListModerationQueue repository error: %v", err)
+	}
+	return items, err
+}
+
+// ListModerationItemsForUser returns the user's recent moderation items, newest first, so they can
+// follow their pending content and read why content was rejected.
+func (s *ProfileService) ListModerationItemsForUser(userID int) ([]models.ModerationItem, error) {
+	items, err := s.moderationRepo.ListForUser(userID, userModerationItemLimit)
+	if err != nil {
+		log.Printf("ListModerationItemsForUser repository error for user %d: %v", userID, err)
+	}
+	return items, err
+}
+
+// ApproveModerationItem accepts a pending photo or bio on behalf of the moderator moderatorID.
+func (s *ProfileService) ApproveModerationItem(ctx context.Context, moderatorID, itemID int) (models.ModerationItem, error) {
+	return s.decideModerationItem(ctx, moderatorID, itemID, models.ModerationStatusApproved, "")
+}
+
+// RejectModerationItem refuses a pending photo or bio on behalf of the moderator moderatorID. The
+// reason is shown to the user. A rejected primary photo hands its role to the next photo that is
+// not rejected, and a rejected bio is hidden from everyone but its owner.
+func (s *ProfileService) RejectModerationItem(ctx context.Context, moderatorID, itemID int, reason string) (models.ModerationItem, error) {
+	reason = strings.TrimSpace(reason)
+	var invalid utils.ValidationError
+	switch {
+	case reason == "":
+		invalid.Add("reason", "required", "A reason is required to reject content")
+	case utf8.RuneCountInString(reason) > MaxModerationReasonLength:
+		invalid.Add("reason", "too_long", "Reason must be at most "+strconv.Itoa(MaxModerationReasonLength)+" characters")
+	}
+	if err := invalid.OrNil(); err != nil {
+		return models.ModerationItem{}, err
+	}
+	return s.decideModerationItem(ctx, moderatorID, itemID, models.ModerationStatusRejected, reason)
+}
+
+func (s *ProfileService) decideModerationItem(ctx context.Context, moderatorID, itemID int, status, reason string) (models.ModerationItem, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ModerationItem{}, err
+	}
+	defer tx.Rollback()
+
+	item, err := s.moderationRepo.GetForUpdateTx(tx, itemID)
+	if err != nil {
+		return models.ModerationItem{}, err
+	}
+	if item.Status != models.ModerationStatusPending {
+		return models.ModerationItem{}, ErrModerationItemDecided
+	}
+
+	profileChanged := false
+	switch item.Kind {
+	case models.ModerationKindPhoto:
+		profileChanged, err = s.applyPhotoDecisionTx(tx, item.UserID, *item.PhotoID, status)
+	case models.ModerationKindBio:
+		bioStatus := models.ProfileModerationClean
+		if status == models.ModerationStatusRejected {
+			bioStatus = models.ModerationStatusRejected
+		}
+		profileChanged, err = s.repo.SetBioModerationStatusTx(tx, item.UserID, item.Content, bioStatus)
+	}
+	if err != nil {
+		return models.ModerationItem{}, err
+	}
+
+	item.Status = status
+	item.Reason = reason
+	item.ReviewedBy = &moderatorID
+	if err := s.moderationRepo.DecideTx(tx, &item); err != nil {
+		return models.ModerationItem{}, err
+	}
+	eventType := models.UserAuditEventTypeContentApproved
+	if status == models.ModerationStatusRejected {
+		eventType = models.UserAuditEventTypeContentRejected
+	}
+	event, err := buildAuditEvent(item.UserID, eventType, map[string]string{
+		"item_id":      strconv.Itoa(item.ID),
+		"kind":         item.Kind,
+		"reason":       reason,
+		"moderator_id": strconv.Itoa(moderatorID),
+	})
+	if err != nil {
+		return models.ModerationItem{}, err
+	}
+	if err := s.auditOutboxRepo.EnqueueTx(tx, event); err != nil {
+		return models.ModerationItem{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ModerationItem{}, err
+	}
+	// Rejected content no longer counts towards the completeness score.
+	if status == models.ModerationStatusRejected && s.refreshCompleteness(item.UserID) {
+		profileChanged = true
+	}
+	if profileChanged {
+		if err := s.EnqueueProfileSync(item.UserID); err != nil {
+			log.Printf("decideModerationItem profile sync error for user %d: %v", item.UserID, err)
+		}
+	}
+	return item, nil
+}
+
+// applyPhotoDecisionTx stores the decision on a photo. Rejecting the primary photo promotes the
+// first photo that is not rejected, or clears the profile image when there is none. It reports
+// whether the profile image changed.
+func (s *ProfileService) applyPhotoDecisionTx(tx *sql.Tx, userID, photoID int, status string) (bool, error) {
+	photos, err := s.photoRepo.LockGalleryTx(tx, userID)
+	if err != nil {
+		return false, err
+	}
+	index := findProfilePhoto(photos, photoID)
+	if index < 0 {
+		return false, repositories.ErrModerationItemNotFound
+	}
+	if err := s.photoRepo.SetModerationStatusTx(tx, userID, photoID, status); err != nil {
+		return false, err
+	}
+	if status != models.ModerationStatusRejected || !photos[index].IsPrimary {
+		return false, nil
+	}
+
+	photos[index].ModerationStatus = status
+	if err := s.photoRepo.ClearPrimaryTx(tx, userID); err != nil {
+		return false, err
+	}
+	url, thumbURL := "", ""
+	if candidates := visibleProfilePhotos(photos); len(candidates) > 0 {
+		if err := s.photoRepo.SetPrimaryTx(tx, userID, candidates[0].ID); err != nil {
+			return false, err
+		}
+		url, thumbURL = candidates[0].URL, candidates[0].ThumbURL
+	}
+	if err := s.photoRepo.SetProfileImageTx(tx, userID, url, thumbURL); err != nil {
+		return false, err
+	}
+	return true, nil
+}
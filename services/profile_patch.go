@@ -0,0 +1,282 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// defaultProfileCountryCode is used for new profiles and when the country code is cleared.
+const defaultProfileCountryCode = "LK"
+
+// ProfilePatch holds the members of a JSON merge patch for a profile. A member set to null clears
+// the field; members that are missing leave it unchanged.
+type ProfilePatch map[string]json.RawMessage
+
+type profilePatchField func(profile *models.Profile, value json.RawMessage) error
+
+// profilePatchFields lists the fields a patch may change, keyed by their JSON name.
+var profilePatchFields = map[string]profilePatchField{
+	"bio":                 patchString(func(p *models.Profile) *string { return &p.Bio }),
+	"gender":              patchString(func(p *models.Profile) *string { return &p.Gender }),
+	"date_of_birth":       patchString(func(p *models.Profile) *string { return &p.DateOfBirth }),
+	"location":            patchString(func(p *models.Profile) *string { return &p.LocationLegacy }),
+	"interests":           patchStrings(func(p *models.Profile) *[]string { return &p.Interests }),
+	"civil_status":        patchString(func(p *models.Profile) *string { return &p.CivilStatus }),
+	"religion":            patchString(func(p *models.Profile) *string { return &p.Religion }),
+	"religion_detail":     patchString(func(p *models.Profile) *string { return &p.ReligionDetail }),
+	"caste":               patchString(func(p *models.Profile) *string { return &p.Caste }),
+	"height_cm":           patchInt(func(p *models.Profile) *int { return &p.HeightCM }),
+	"weight_kg":           patchInt(func(p *models.Profile) *int { return &p.WeightKG }),
+	"dietary_preference":  patchString(func(p *models.Profile) *string { return &p.DietaryPreference }),
+	"smoking":             patchString(func(p *models.Profile) *string { return &p.Smoking }),
+	"alcohol":             patchString(func(p *models.Profile) *string { return &p.Alcohol }),
+	"languages":           patchStrings(func(p *models.Profile) *[]string { return &p.Languages }),
+	"country_code":        patchCountryCode,
+	"province":            patchString(func(p *models.Profile) *string { return &p.Province }),
+	"district":            patchString(func(p *models.Profile) *string { return &p.District }),
+	"city":                patchString(func(p *models.Profile) *string { return &p.City }),
+	"postal_code":         patchString(func(p *models.Profile) *string { return &p.PostalCode }),
+	"highest_education":   patchString(func(p *models.Profile) *string { return &p.HighestEducation }),
+	"field_of_study":      patchString(func(p *models.Profile) *string { return &p.FieldOfStudy }),
+	"institution":         patchString(func(p *models.Profile) *string { return &p.Institution }),
+	"employment_status":   patchString(func(p *models.Profile) *string { return &p.EmploymentStatus }),
+	"occupation":          patchString(func(p *models.Profile) *string { return &p.Occupation }),
+	"father_occupation":   patchString(func(p *models.Profile) *string { return &p.FatherOccupation }),
+	"mother_occupation":   patchString(func(p *models.Profile) *string { return &p.MotherOccupation }),
+	"siblings_count":      patchInt(func(p *models.Profile) *int { return &p.SiblingsCount }),
+	"siblings":            patchJSONObject(func(p *models.Profile) *string { return &p.Siblings }),
+	"horoscope_available": patchBool(func(p *models.Profile) *bool { return &p.HoroscopeAvailable }),
+	"birth_time":          patchString(func(p *models.Profile) *string { return &p.BirthTime }),
+	"birth_place":         patchString(func(p *models.Profile) *string { return &p.BirthPlace }),
+	"sinhala_raasi":       patchString(func(p *models.Profile) *string { return &p.SinhalaRaasi }),
+	"nakshatra":           patchString(func(p *models.Profile) *string { return &p.Nakshatra }),
+	"horoscope":           patchJSONObject(func(p *models.Profile) *string { return &p.Horoscope }),
+}
+
+// Verification members are handed to CreateOrUpdateProfile rather than written to the profile.
+const (
+	profilePatchPhoneNumber   = "phone_number"
+	profilePatchContactToken  = "contact_verification_token"
+	profilePatchIdentityToken = "identity_verification_token"
+)
+
+// profilePatchReadOnly lists profile members that are only changed by the server.
+var profilePatchReadOnly = map[string]bool{
+	"id": true, "user_id": true, "username": true, "contact_verified": true, "identity_verified": true,
+	"verified": true, "profile_image_url": true, "profile_image_thumb_url": true, "moderation_status": true,
+	"last_active_at": true, "metadata": true, "created_at": true, "updated_at": true,
+}
+
+// profilePatchNotClearable lists fields that keep their stored value when written empty, so a null
+// could not clear them.
+var profilePatchNotClearable = map[string]bool{
+	"gender":                true,
+	profilePatchPhoneNumber: true,
+}
+
+// PatchProfile applies a partial update to the user's profile. Only the members present in the
+// patch change; everything else keeps its stored value. The result is saved through
+// CreateOrUpdateProfile, so it is validated and phone numbers and verification tokens follow the
+// same rules as a full update, and a sync with the matching service is queued. Members that cannot
+// be applied are reported in a *utils.ValidationError.
+func (s *ProfileService) PatchProfile(username string, patch ProfilePatch) (models.Profile, error) {
+	var invalid utils.ValidationError
+	patch.checkMembers(&invalid)
+	phoneNumber, contactToken, identityToken := patch.verificationMembers(&invalid)
+	if err := invalid.OrNil(); err != nil {
+		return models.Profile{}, err
+	}
+
+	userID, err := repositories.GetUserIDByUsername(s.db, username)
+	if err != nil {
+		log.Printf("PatchProfile user lookup error for %s: %v", username, err)
+		return models.Profile{}, err
+	}
+	existing, err := s.repo.GetByUserID(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("PatchProfile fetch error for user %d: %v", userID, err)
+		return models.Profile{}, err
+	}
+	profile := existing.Profile
+	if errors.Is(err, sql.ErrNoRows) {
+		profile = models.Profile{CountryCode: defaultProfileCountryCode}
+	}
+	if patch.applyTo(&invalid, &profile); invalid.OrNil() != nil {
+		return models.Profile{}, &invalid
+	}
+	if phoneNumber == "" {
+		// Keep the stored number so an unrelated change does not reset contact verification.
+		phoneNumber = profile.PhoneNumber
+	}
+
+	saved, err := s.CreateOrUpdateProfile(username, profile, phoneNumber, contactToken, identityToken)
+	if err != nil {
+		return models.Profile{}, err
+	}
+	if err := s.EnqueueProfileSync(saved.UserID); err != nil {
+		log.Printf("PatchProfile enqueue sync error for user %d: %v", saved.UserID, err)
+	}
+	return saved, nil
+}
+
+// checkMembers records members that cannot be changed or cleared.
+func (p ProfilePatch) checkMembers(v *utils.ValidationError) {
+	for _, name := range p.names() {
+		switch name {
+		case profilePatchPhoneNumber, profilePatchContactToken, profilePatchIdentityToken:
+		default:
+			if profilePatchReadOnly[name] {
+				v.Add(name, "read_only", "Field cannot be changed")
+				continue
+			}
+			if _, ok := profilePatchFields[name]; !ok {
+				v.Add(name, "unknown_field", "Unknown field")
+				continue
+			}
+		}
+		if isJSONNull(p[name]) && profilePatchNotClearable[name] {
+			v.Add(name, "not_clearable", "Field cannot be cleared")
+		}
+	}
+}
+
+func (p ProfilePatch) names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p ProfilePatch) verificationMembers(v *utils.ValidationError) (phoneNumber, contactToken, identityToken string) {
+	targets := map[string]*string{
+		profilePatchPhoneNumber:   &phoneNumber,
+		profilePatchContactToken:  &contactToken,
+		profilePatchIdentityToken: &identityToken,
+	}
+	for _, name := range p.names() {
+		target, ok := targets[name]
+		if !ok || isJSONNull(p[name]) {
+			continue
+		}
+		if err := json.Unmarshal(p[name], target); err != nil {
+			v.Add(name, "invalid_type", "Value must be a string")
+		}
+	}
+	return phoneNumber, contactToken, identityToken
+}
+
+// applyTo writes the profile members of a patch that passed checkMembers and records values of the
+// wrong type.
+func (p ProfilePatch) applyTo(v *utils.ValidationError, profile *models.Profile) {
+	for _, name := range p.names() {
+		apply, ok := profilePatchFields[name]
+		if !ok {
+			continue
+		}
+		if err := apply(profile, p[name]); err != nil {
+			v.Add(name, "invalid_type", "Value "+err.Error())
+		}
+	}
+}
+
+func isJSONNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+func patchString(field func(*models.Profile) *string) profilePatchField {
+	return func(profile *models.Profile, value json.RawMessage) error {
+		if isJSONNull(value) {
+			*field(profile) = ""
+			return nil
+		}
+		if err := json.Unmarshal(value, field(profile)); err != nil {
+			return errors.New("must be a string")
+		}
+		return nil
+	}
+}
+
+func patchStrings(field func(*models.Profile) *[]string) profilePatchField {
+	return func(profile *models.Profile, value json.RawMessage) error {
+		if isJSONNull(value) {
+			*field(profile) = nil
+			return nil
+		}
+		var values []string
+		if err := json.Unmarshal(value, &values); err != nil {
+			return errors.New("must be an array of strings")
+		}
+		var kept []string
+		for _, v := range values {
+			if strings.TrimSpace(v) != "" {
+				kept = append(kept, v)
+			}
+		}
+		*field(profile) = kept
+		return nil
+	}
+}
+
+func patchInt(field func(*models.Profile) *int) profilePatchField {
+	return func(profile *models.Profile, value json.RawMessage) error {
+		if isJSONNull(value) {
+			*field(profile) = 0
+			return nil
+		}
+		if err := json.Unmarshal(value, field(profile)); err != nil {
+			return errors.New("must be an integer")
+		}
+		return nil
+	}
+}
+
+func patchBool(field func(*models.Profile) *bool) profilePatchField {
+	return func(profile *models.Profile, value json.RawMessage) error {
+		if isJSONNull(value) {
+			*field(profile) = false
+			return nil
+		}
+		if err := json.Unmarshal(value, field(profile)); err != nil {
+			return errors.New("must be a boolean")
+		}
+		return nil
+	}
+}
+
+// patchJSONObject stores a nested JSON object such as the horoscope as text.
+func patchJSONObject(field func(*models.Profile) *string) profilePatchField {
+	return func(profile *models.Profile, value json.RawMessage) error {
+		if isJSONNull(value) {
+			*field(profile) = ""
+			return nil
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err != nil {
+			return errors.New("must be an object")
+		}
+		*field(profile) = string(value)
+		return nil
+	}
+}
+
+func patchCountryCode(profile *models.Profile, value json.RawMessage) error {
+	if isJSONNull(value) {
+		profile.CountryCode = defaultProfileCountryCode
+		return nil
+	}
+	if err := json.Unmarshal(value, &profile.CountryCode); err != nil {
+		return errors.New("must be a string")
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/utils"
+)
+
+const (
+	// DefaultProfilePhotoLimit is the number of photos a gallery may hold unless PROFILE_PHOTO_LIMIT
+	// says otherwise.
+	DefaultProfilePhotoLimit = 6
+	// MaxProfilePhotoCaptionLength is the longest caption accepted, in characters.
+	MaxProfilePhotoCaptionLength = 200
+)
+
+var (
+	// ErrPhotoLimitReached indicates that the gallery already holds the maximum number of photos.
+	ErrPhotoLimitReached = errors.New("profile photo limit reached")
+	// ErrPhotoNotFound indicates that the photo does not exist in the user's gallery.
+	ErrPhotoNotFound = errors.New("profile photo not found")
+)
+
+var (
+	profilePhotoLimitMu sync.RWMutex
+	profilePhotoLimit   = DefaultProfilePhotoLimit
+)
+
+// LoadProfilePhotoLimitFromEnv reads the per-user photo limit from PROFILE_PHOTO_LIMIT, keeping
+// DefaultProfilePhotoLimit when it is unset.
+func LoadProfilePhotoLimitFromEnv() error {
+	raw := strings.TrimSpace(os.Getenv("PROFILE_PHOTO_LIMIT"))
+	if raw == "" {
+		return ConfigureProfilePhotoLimit(DefaultProfilePhotoLimit)
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		return fmt.Errorf("PROFILE_PHOTO_LIMIT: %w", err)
+	}
+	return ConfigureProfilePhotoLimit(limit)
+}
+
+// ConfigureProfilePhotoLimit sets the number of photos a gallery may hold.
+func ConfigureProfilePhotoLimit(limit int) error {
+	if limit < 1 {
+		return fmt.Errorf("profile photo limit must be at least 1, got %d", limit)
+	}
+	profilePhotoLimitMu.Lock()
+	profilePhotoLimit = limit
+	profilePhotoLimitMu.Unlock()
+	return nil
+}
+
+func activeProfilePhotoLimit() int {
+	profilePhotoLimitMu.RLock()
+	defer profilePhotoLimitMu.RUnlock()
+	return profilePhotoLimit
+}
+
+// ValidateProfilePhotoCaption records a caption that is too long to store.
+func ValidateProfilePhotoCaption(v *utils.ValidationError, caption string) {
+	if utf8.RuneCountInString(caption) > MaxProfilePhotoCaptionLength {
+		v.Add("caption", "too_long", fmt.Sprintf("Caption must be at most %d characters", MaxProfilePhotoCaptionLength))
+	}
+}
+
+// ListProfilePhotos returns the user's photos in gallery order.
+func (s *ProfileService) ListProfilePhotos(userID int) ([]models.ProfilePhoto, error) {
+	photos, err := s.photoRepo.ListForUser(userID)
+	if err != nil {
+		log.Printf("ListProfilePhotos repository error for user %d: %v", userID, err)
+	}
+	return photos, err
+}
+
+// ListVisibleProfilePhotos returns the user's photos as other users see them: in gallery order and
+// without the photos moderators rejected.
+func (s *ProfileService) ListVisibleProfilePhotos(userID int) ([]models.ProfilePhoto, error) {
+	photos, err := s.ListProfilePhotos(userID)
+	if err != nil {
+		return nil, err
+	}
+	return visibleProfilePhotos(photos), nil
+}
+
+// AddProfilePhoto appends a photo with the given image keys and caption to the end of the user's
+// gallery and queues it for moderation. The first photo of a gallery becomes the primary photo and
+// the profile image.
+func (s *ProfileService) AddProfilePhoto(ctx context.Context, userID int, photo models.ProfilePhoto) (models.ProfilePhoto, error) {
+	var invalid utils.ValidationError
+	ValidateProfilePhotoCaption(&invalid, photo.Caption)
+	if err := invalid.OrNil(); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	defer tx.Rollback()
+
+	photos, err := s.photoRepo.LockGalleryTx(tx, userID)
+	if err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	if len(photos) >= activeProfilePhotoLimit() {
+		return models.ProfilePhoto{}, ErrPhotoLimitReached
+	}
+
+	// A gallery whose primary photo was rejected has no primary photo until the next upload.
+	photo.UserID = userID
+	photo.Position = len(photos)
+	photo.IsPrimary = !hasPrimaryProfilePhoto(photos)
+	photo.ModerationStatus = models.ModerationStatusPending
+	if err := s.photoRepo.InsertTx(tx, &photo); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	if err := s.moderationRepo.EnqueuePhotoTx(tx, userID, photo.ID); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	if photo.IsPrimary {
+		if err := s.photoRepo.SetProfileImageTx(tx, userID, photo.URL, photo.ThumbURL); err != nil {
+			return models.ProfilePhoto{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	if scoreChanged := s.refreshCompleteness(userID); photo.IsPrimary || scoreChanged {
+		s.syncProfile(userID)
+	}
+	return photo, nil
+}
+
+// SetPrimaryProfilePhoto makes the photo the user's primary photo and profile image. Rejected photos
+// cannot become the primary photo.
+func (s *ProfileService) SetPrimaryProfilePhoto(ctx context.Context, userID, photoID int) (models.ProfilePhoto, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	defer tx.Rollback()
+
+	photos, err := s.photoRepo.LockGalleryTx(tx, userID)
+	if err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	index := findProfilePhoto(photos, photoID)
+	if index < 0 {
+		return models.ProfilePhoto{}, ErrPhotoNotFound
+	}
+	photo := photos[index]
+	if photo.IsPrimary {
+		return photo, nil
+	}
+	if photo.ModerationStatus == models.ModerationStatusRejected {
+		return models.ProfilePhoto{}, ErrPhotoRejected
+	}
+
+	if err := s.photoRepo.SetPrimaryTx(tx, userID, photoID); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	if err := s.photoRepo.SetProfileImageTx(tx, userID, photo.URL, photo.ThumbURL); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	s.syncProfile(userID)
+	photo.IsPrimary = true
+	return photo, nil
+}
+
+// ReorderProfilePhotos arranges the gallery in the order of photoIDs, which must list every photo
+// of the user exactly once. The primary photo is not affected.
+func (s *ProfileService) ReorderProfilePhotos(ctx context.Context, userID int, photoIDs []int) ([]models.ProfilePhoto, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	photos, err := s.photoRepo.LockGalleryTx(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isPhotoPermutation(photos, photoIDs) {
+		var invalid utils.ValidationError
+		invalid.Add("photo_ids", "invalid_order", "List every photo of the gallery exactly once")
+		return nil, &invalid
+	}
+
+	ordered := make([]models.ProfilePhoto, 0, len(photos))
+	for position, id := range photoIDs {
+		photo := photos[findProfilePhoto(photos, id)]
+		if photo.Position != position {
+			if err := s.photoRepo.SetPositionTx(tx, userID, id, position); err != nil {
+				return nil, err
+			}
+			photo.Position = position
+		}
+		ordered = append(ordered, photo)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ordered, nil
+}
+
+// DeleteProfilePhoto removes the photo from the gallery and returns it so that the caller can
+// discard the stored image. Deleting the primary photo promotes the next photo in the gallery that
+// was not rejected, or clears the profile image when there is none.
+func (s *ProfileService) DeleteProfilePhoto(ctx context.Context, userID, photoID int) (models.ProfilePhoto, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	defer tx.Rollback()
+
+	photos, err := s.photoRepo.LockGalleryTx(tx, userID)
+	if err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	index := findProfilePhoto(photos, photoID)
+	if index < 0 {
+		return models.ProfilePhoto{}, ErrPhotoNotFound
+	}
+	deleted := photos[index]
+	if err := s.photoRepo.DeleteTx(tx, userID, photoID); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+
+	remaining := append(photos[:index:index], photos[index+1:]...)
+	for position, photo := range remaining {
+		if photo.Position != position {
+			if err := s.photoRepo.SetPositionTx(tx, userID, photo.ID, position); err != nil {
+				return models.ProfilePhoto{}, err
+			}
+		}
+	}
+	if deleted.IsPrimary {
+		url, thumbURL := "", ""
+		if candidates := visibleProfilePhotos(remaining); len(candidates) > 0 {
+			if err := s.photoRepo.SetPrimaryTx(tx, userID, candidates[0].ID); err != nil {
+				return models.ProfilePhoto{}, err
+			}
+			url, thumbURL = candidates[0].URL, candidates[0].ThumbURL
+		}
+		if err := s.photoRepo.SetProfileImageTx(tx, userID, url, thumbURL); err != nil {
+			return models.ProfilePhoto{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ProfilePhoto{}, err
+	}
+	if scoreChanged := s.refreshCompleteness(userID); deleted.IsPrimary || scoreChanged {
+		s.syncProfile(userID)
+	}
+	return deleted, nil
+}
+
+// IsProfileImageReferenced reports whether a photo or profile still uses the image at url.
+func (s *ProfileService) IsProfileImageReferenced(url string) (bool, error) {
+	return s.photoRepo.IsImageReferenced(url)
+}
+
+// syncProfile queues the profile for the matching service after its image or completeness score
+// changed.
+func (s *ProfileService) syncProfile(userID int) {
+	if err := s.EnqueueProfileSync(userID); err != nil {
+		log.Printf("ProfileService profile image sync error for user %d: %v", userID, err)
+	}
+}
+
+func hasPrimaryProfilePhoto(photos []models.ProfilePhoto) bool {
+	for _, photo := range photos {
+		if photo.IsPrimary {
+			return true
+		}
+	}
+	return false
+}
+
+func findProfilePhoto(photos []models.ProfilePhoto, photoID int) int {
+	for i, photo := range photos {
+		if photo.ID == photoID {
+			return i
+		}
+	}
+	return -1
+}
+
+func isPhotoPermutation(photos []models.ProfilePhoto, photoIDs []int) bool {
+	if len(photoIDs) != len(photos) {
+		return false
+	}
+	seen := make(map[int]bool, len(photoIDs))
+	for _, id := range photoIDs {
+		if seen[id] || findProfilePhoto(photos, id) < 0 {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"log"
+	"sort"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// privateProfileField is a profile field whose owner chooses who may see it.
+type privateProfileField struct {
+	defaultVisibility string
+	clear             func(*models.Profile)
+}
+
+// privateProfileFields lists the fields covered by privacy settings, by JSON name. Contact details
+// and the birth details a horoscope is cast from are only shared with connections by default.
+var privateProfileFields = map[string]privateProfileField{
+	"phone_number":      {models.VisibilityConnections, func(p *models.Profile) { p.PhoneNumber = "" }},
+	"postal_code":       {models.VisibilityConnections, func(p *models.Profile) { p.PostalCode = "" }},
+	"city":              {models.VisibilityEveryone, func(p *models.Profile) { p.City = "" }},
+	"date_of_birth":     {models.VisibilityEveryone, func(p *models.Profile) { p.DateOfBirth = "" }},
+	"caste":             {models.VisibilityEveryone, func(p *models.Profile) { p.Caste = "" }},
+	"religion_detail":   {models.VisibilityEveryone, func(p *models.Profile) { p.ReligionDetail = "" }},
+	"institution":       {models.VisibilityEveryone, func(p *models.Profile) { p.Institution = "" }},
+	"father_occupation": {models.VisibilityEveryone, func(p *models.Profile) { p.FatherOccupation = "" }},
+	"mother_occupation": {models.VisibilityEveryone, func(p *models.Profile) { p.MotherOccupation = "" }},
+	"siblings":          {models.VisibilityEveryone, func(p *models.Profile) { p.Siblings = "" }},
+	"birth_time":        {models.VisibilityConnections, func(p *models.Profile) { p.BirthTime = "" }},
+	"birth_place":       {models.VisibilityConnections, func(p *models.Profile) { p.BirthPlace = "" }},
+	"sinhala_raasi":     {models.VisibilityEveryone, func(p *models.Profile) { p.SinhalaRaasi = "" }},
+	"nakshatra":         {models.VisibilityEveryone, func(p *models.Profile) { p.Nakshatra = "" }},
+	"horoscope":         {models.VisibilityConnections, func(p *models.Profile) { p.Horoscope = "" }},
+	"last_active_at":    {models.VisibilityEveryone, func(p *models.Profile) { p.LastActiveAt = "" }},
+}
+
+// fieldVisibility returns who may see the field given the owner's stored settings.
+func fieldVisibility(stored map[string]string, name string) string {
+	if visibility, ok := stored[name]; ok {
+		return visibility
+	}
+	return privateProfileFields[name].defaultVisibility
+}
+
+// GetPrivacySettings returns who may see each private field of the user's profile, with the
+// defaults filled in.
+func (s *ProfileService) GetPrivacySettings(userID int) (models.ProfilePrivacySettings, error) {
+	stored, err := s.privacyRepo.GetByUserIDs([]int{userID})
+	if err != nil {
+		log.Printf("GetPrivacySettings repository error for user %d: %v", userID, err)
+		return models.ProfilePrivacySettings{}, err
+	}
+	settings := models.ProfilePrivacySettings{Fields: make(map[string]string, len(privateProfileFields))}
+	for name := range privateProfileFields {
+		settings.Fields[name] = fieldVisibility(stored[userID], name)
+	}
+	return settings, nil
+}
+
+// UpdatePrivacySettings changes the visibility of the given fields and returns the resulting
+// settings. Unknown fields and visibilities are rejected with a *utils.ValidationError.
+func (s *ProfileService) UpdatePrivacySettings(userID int, fields map[string]string) (models.ProfilePrivacySettings, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var invalid utils.ValidationError
+	for _, name := range names {
+		if _, ok := privateProfileFields[name]; !ok {
+			invalid.Add("fields."+name, "unknown_field", "Field has no privacy setting")
+			continue
+		}
+		switch fields[name] {
+		case models.VisibilityEveryone, models.VisibilityConnections, models.VisibilityNobody:
+		default:
+			invalid.Add("fields."+name, "invalid_choice", "Visibility must be everyone, connections or nobody")
+		}
+	}
+	if err := invalid.OrNil(); err != nil {
+		return models.ProfilePrivacySettings{}, err
+	}
+
+	if len(fields) > 0 {
+		if err := s.privacyRepo.Save(userID, fields); err != nil {
+			log.Printf("UpdatePrivacySettings repository error for user %d: %v", userID, err)
+			return models.ProfilePrivacySettings{}, err
+		}
+	}
+	return s.GetPrivacySettings(userID)
+}
+
+// projectProfiles prepares profiles for viewerID: fields their owners do not share with the viewer
+// are blanked, as is content moderators rejected. The viewer's own profile is left as it is. Every
+// endpoint showing other users' profiles goes through this step.
+func (s *ProfileService) projectProfiles(viewerID int, profiles []*models.Profile) error {
+	ownerIDs := make([]int, 0, len(profiles))
+	for _, profile := range profiles {
+		if profile.UserID != viewerID {
+			ownerIDs = append(ownerIDs, profile.UserID)
+		}
+	}
+	if len(ownerIDs) == 0 {
+		return nil
+	}
+
+	stored, err := s.privacyRepo.GetByUserIDs(ownerIDs)
+	if err != nil {
+		return err
+	}
+	// Connections are only looked up for owners sharing something with them.
+	var connectionOwners []int
+	for _, ownerID := range ownerIDs {
+		for name := range privateProfileFields {
+			if fieldVisibility(stored[ownerID], name) == models.VisibilityConnections {
+				connectionOwners = append(connectionOwners, ownerID)
+				break
+			}
+		}
+	}
+	connected := map[int]bool{}
+	if len(connectionOwners) > 0 {
+		if connected, err = s.friendRepo.ConnectedUserIDs(viewerID, connectionOwners); err != nil {
+			return err
+		}
+	}
+
+	for _, profile := range profiles {
+		if profile.UserID == viewerID {
+			continue
+		}
+		hideRejectedContent(profile)
+		for name, field := range privateProfileFields {
+			switch fieldVisibility(stored[profile.UserID], name) {
+			case models.VisibilityNobody:
+				field.clear(profile)
+			case models.VisibilityConnections:
+				if !connected[profile.UserID] {
+					field.clear(profile)
+				}
+			}
+		}
+	}
+	return nil
+}
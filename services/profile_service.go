@@ -7,10 +7,12 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/icpinto/dating-app/models"
 	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/utils"
 	"github.com/lib/pq"
 )
 
@@ -19,6 +21,18 @@ type ProfileService struct {
 	db                *sql.DB
 	repo              *repositories.ProfileRepository
 	profileOutboxRepo *repositories.ProfileSyncOutboxRepository
+	photoRepo         *repositories.ProfilePhotoRepository
+	friendRepo        *repositories.FriendRequestRepository
+	roleRepo          *repositories.RoleRepository
+	moderationRepo    *repositories.ModerationRepository
+	auditOutboxRepo   *repositories.UserAuditOutboxRepository
+	privacyRepo       *repositories.ProfilePrivacyRepository
+	historyRepo       *repositories.ProfileHistoryRepository
+	viewRepo          *repositories.ProfileViewRepository
+
+	// Enum values only change with a migration, so they are read once.
+	enumsMu sync.Mutex
+	enums   *models.ProfileEnums
 }
 
 // NewProfileService creates a new ProfileService.
@@ -27,6 +41,14 @@ func NewProfileService(db *sql.DB) *ProfileService {
 		db:                db,
 		repo:              repositories.NewProfileRepository(db),
 		profileOutboxRepo: repositories.NewProfileSyncOutboxRepository(db),
+		photoRepo:         repositories.NewProfilePhotoRepository(db),
+		friendRepo:        repositories.NewFriendRequestRepository(db),
+		roleRepo:          repositories.NewRoleRepository(db),
+		moderationRepo:    repositories.NewModerationRepository(db),
+		auditOutboxRepo:   repositories.NewUserAuditOutboxRepository(db),
+		privacyRepo:       repositories.NewProfilePrivacyRepository(db),
+		historyRepo:       repositories.NewProfileHistoryRepository(db),
+		viewRepo:          repositories.NewProfileViewRepository(db),
 	}
 }
 
@@ -37,8 +59,17 @@ var ErrInvalidVerificationToken = errors.New("invalid verification token")
 
 var ErrVerificationMismatch = errors.New("verification data mismatch")
 
-// CreateOrUpdateProfile creates or updates a user's profile.
+// CreateOrUpdateProfile creates or updates a user's profile. A profile failing ValidateProfile is
+// rejected with a *utils.ValidationError before anything is stored.
 func (s *ProfileService) CreateOrUpdateProfile(username string, profile models.Profile, phoneNumber, contactToken, identityToken string) (models.Profile, error) {
+	var invalid utils.ValidationError
+	if err := s.ValidateProfile(&invalid, profile); err != nil {
+		return models.Profile{}, err
+	}
+	if err := invalid.OrNil(); err != nil {
+		return models.Profile{}, err
+	}
+
 	userID, err := repositories.GetUserIDByUsername(s.db, username)
 	if err != nil {
 		log.Printf("CreateOrUpdateProfile user lookup error for %s: %v", username, err)
@@ -46,20 +77,33 @@ func (s *ProfileService) CreateOrUpdateProfile(username string, profile models.P
 	}
 	profile.UserID = userID
 
-	existingStatus, err := s.repo.GetVerificationStatus(userID)
+	// The user's row stays locked until the new version is in the history, so concurrent saves
+	// each diff against the version the other one stored.
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.Profile{}, err
+	}
+	defer tx.Rollback()
+	if err := s.repo.LockUserTx(tx, userID); err != nil {
+		return models.Profile{}, err
+	}
+
+	// The stored profile supplies the verification state and is the old version in the history.
+	existing, err := s.repo.GetByUserIDTx(tx, userID)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		log.Printf("CreateOrUpdateProfile verification lookup error for user %d: %v", userID, err)
+		log.Printf("CreateOrUpdateProfile existing profile lookup error for user %d: %v", userID, err)
 		return models.Profile{}, err
 	}
+	previous := existing.Profile
 
 	if phoneNumber != "" {
 		profile.PhoneNumber = phoneNumber
-	} else if existingStatus.PhoneNumber != "" {
-		profile.PhoneNumber = existingStatus.PhoneNumber
+	} else if previous.PhoneNumber != "" {
+		profile.PhoneNumber = previous.PhoneNumber
 	}
 
-	profile.ContactVerified = existingStatus.ContactVerified
-	profile.IdentityVerified = existingStatus.IdentityVerified
+	profile.ContactVerified = previous.ContactVerified
+	profile.IdentityVerified = previous.IdentityVerified
 
 	if contactToken != "" {
 		claims, err := parseVerificationToken(contactToken, getVerificationSecret("CONTACT_VERIFICATION_JWT_SECRET"))
@@ -79,9 +123,9 @@ func (s *ProfileService) CreateOrUpdateProfile(username string, profile models.P
 			return models.Profile{}, ErrInvalidVerificationToken
 		}
 		profile.ContactVerified = true
-	} else if phoneNumber != "" && !strings.EqualFold(phoneNumber, existingStatus.PhoneNumber) {
+	} else if phoneNumber != "" && !strings.EqualFold(phoneNumber, previous.PhoneNumber) {
 		profile.ContactVerified = false
-	} else if phoneNumber == "" && existingStatus.PhoneNumber != "" {
+	} else if phoneNumber == "" && previous.PhoneNumber != "" {
 		profile.ContactVerified = false
 	}
 
@@ -95,7 +139,7 @@ func (s *ProfileService) CreateOrUpdateProfile(username string, profile models.P
 
 	profile.Verified = profile.ContactVerified && profile.IdentityVerified
 
-	if err := s.repo.Upsert(profile); err != nil {
+	if err := s.repo.UpsertTx(tx, profile); err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "22P02" && strings.Contains(pqErr.Message, "invalid input value for enum") {
 				log.Printf("CreateOrUpdateProfile invalid enum for user %d: %v", userID, pqErr)
@@ -105,11 +149,26 @@ func (s *ProfileService) CreateOrUpdateProfile(username string, profile models.P
 		log.Printf("CreateOrUpdateProfile repository error for user %d: %v", userID, err)
 		return models.Profile{}, err
 	}
-	saved, err := s.repo.GetByUserID(userID)
+	saved, err := s.repo.GetByUserIDTx(tx, userID)
 	if err != nil {
 		log.Printf("CreateOrUpdateProfile fetch error for user %d: %v", userID, err)
 		return models.Profile{}, err
 	}
+	if err := s.recordProfileChangesTx(tx, userID, userID, previous, saved.Profile); err != nil {
+		log.Printf("CreateOrUpdateProfile history error for user %d: %v", userID, err)
+		return models.Profile{}, err
+	}
+	if err := s.queueBioReviewTx(tx, saved.Profile); err != nil {
+		log.Printf("CreateOrUpdateProfile bio review error for user %d: %v", userID, err)
+		return models.Profile{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("CreateOrUpdateProfile commit error for user %d: %v", userID, err)
+		return models.Profile{}, err
+	}
+	if _, err := s.storeCompleteness(&saved.Profile); err != nil {
+		log.Printf("CreateOrUpdateProfile completeness error for user %d: %v", userID, err)
+	}
 	return saved.Profile, nil
 }
 
@@ -128,33 +187,67 @@ func (s *ProfileService) GetProfile(username string) (models.UserProfile, error)
 	return profile, nil
 }
 
-// GetProfiles retrieves profiles, applying optional filters when provided.
-func (s *ProfileService) GetProfiles(filters models.ProfileFilters) ([]models.UserProfile, error) {
-	profiles, err := s.repo.GetAllWithFilters(filters)
+// GetProfiles retrieves profiles, applying optional filters when provided, as seen by viewerID.
+func (s *ProfileService) GetProfiles(viewerID int, filters models.ProfileFilters) ([]models.UserProfile, error) {
+	profiles, err := s.repo.GetAllWithFilters(viewerID, fieldVisibility(nil, "date_of_birth"), filters)
 	if err != nil {
 		log.Printf("GetProfiles repository error: %v", err)
 		return nil, err
 	}
+	projected := make([]*models.Profile, len(profiles))
+	for i := range profiles {
+		projected[i] = &profiles[i].Profile
+	}
+	if err := s.projectProfiles(viewerID, projected); err != nil {
+		log.Printf("GetProfiles projection error for viewer %d: %v", viewerID, err)
+		return nil, err
+	}
 	return profiles, nil
 }
 
-// GetProfilesByUserIDs retrieves profiles indexed by user ID for the provided IDs.
-func (s *ProfileService) GetProfilesByUserIDs(userIDs []int) (map[int]models.UserProfile, error) {
+// GetProfilesByUserIDs retrieves profiles indexed by user ID for the provided IDs, as seen by
+// viewerID.
+func (s *ProfileService) GetProfilesByUserIDs(viewerID int, userIDs []int) (map[int]models.UserProfile, error) {
 	profiles, err := s.repo.GetByUserIDs(userIDs)
 	if err != nil {
 		log.Printf("GetProfilesByUserIDs repository error: %v", err)
 		return nil, err
 	}
+	ordered := make([]models.UserProfile, 0, len(profiles))
+	for _, userID := range userIDs {
+		if profile, ok := profiles[userID]; ok {
+			ordered = append(ordered, profile)
+		}
+	}
+	projected := make([]*models.Profile, len(ordered))
+	for i := range ordered {
+		projected[i] = &ordered[i].Profile
+	}
+	if err := s.projectProfiles(viewerID, projected); err != nil {
+		log.Printf("GetProfilesByUserIDs projection error for viewer %d: %v", viewerID, err)
+		return nil, err
+	}
+	for _, profile := range ordered {
+		profiles[profile.UserID] = profile
+	}
 	return profiles, nil
 }
 
-// GetProfileByUserID retrieves a profile by user ID.
-func (s *ProfileService) GetProfileByUserID(userID int) (models.UserProfile, error) {
+// GetProfileByUserID retrieves a profile by user ID, as seen by viewerID, and records the view.
+func (s *ProfileService) GetProfileByUserID(viewerID, userID int) (models.UserProfile, error) {
 	profile, err := s.repo.GetByUserID(userID)
 	if err != nil {
 		log.Printf("GetProfileByUserID repository error for user %d: %v", userID, err)
 		return models.UserProfile{}, err
 	}
+	if err := s.projectProfiles(viewerID, []*models.Profile{&profile.Profile}); err != nil {
+		log.Printf("GetProfileByUserID projection error for viewer %d: %v", viewerID, err)
+		return models.UserProfile{}, err
+	}
+	// A failed view record only costs the view, not the profile response.
+	if err := s.recordProfileView(viewerID, userID); err != nil {
+		log.Printf("GetProfileByUserID view record error for viewer %d and user %d: %v", viewerID, userID, err)
+	}
 	return profile, nil
 }
 
@@ -168,6 +261,23 @@ func (s *ProfileService) GetProfileEnums() (models.ProfileEnums, error) {
 	return enums, nil
 }
 
+// cachedProfileEnums returns the enum values used to validate profiles, loading them on first use.
+// A failed load is retried on the next call.
+func (s *ProfileService) cachedProfileEnums() (models.ProfileEnums, error) {
+	s.enumsMu.Lock()
+	defer s.enumsMu.Unlock()
+	if s.enums != nil {
+		return *s.enums, nil
+	}
+	enums, err := s.repo.GetProfileEnums()
+	if err != nil {
+		log.Printf("cachedProfileEnums repository error: %v", err)
+		return models.ProfileEnums{}, err
+	}
+	s.enums = &enums
+	return enums, nil
+}
+
 // EnqueueProfileSync schedules a profile synchronization attempt with the matching microservice.
 func (s *ProfileService) EnqueueProfileSync(userID int) error {
 	if s.profileOutboxRepo == nil {
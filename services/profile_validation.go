@@ -0,0 +1,131 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/utils"
+)
+
+const (
+	// MinimumProfileAge is the youngest age, in years, a profile may state.
+	MinimumProfileAge = 18
+
+	minProfileHeightCM = 80
+	maxProfileHeightCM = 250
+	minProfileWeightKG = 30
+	maxProfileWeightKG = 300
+)
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ValidateProfile records every problem with the profile in v. Enum fields are checked against the
+// values defined in the database, which are loaded once and cached. Height, weight and siblings
+// count of zero mean "not provided". The returned error is only set when the enum values could not
+// be loaded.
+func (s *ProfileService) ValidateProfile(v *utils.ValidationError, profile models.Profile) error {
+	if err := s.validateProfileEnums(v, profile); err != nil {
+		return err
+	}
+	validateProfileDateOfBirth(v, profile.DateOfBirth, time.Now())
+
+	if profile.HeightCM != 0 && (profile.HeightCM < minProfileHeightCM || profile.HeightCM > maxProfileHeightCM) {
+		v.Add("height_cm", "out_of_range", fmt.Sprintf("Height must be between %d and %d cm", minProfileHeightCM, maxProfileHeightCM))
+	}
+	if profile.WeightKG != 0 && (profile.WeightKG < minProfileWeightKG || profile.WeightKG > maxProfileWeightKG) {
+		v.Add("weight_kg", "out_of_range", fmt.Sprintf("Weight must be between %d and %d kg", minProfileWeightKG, maxProfileWeightKG))
+	}
+	if profile.SiblingsCount < 0 {
+		v.Add("siblings_count", "out_of_range", "Siblings count cannot be negative")
+	}
+	if !countryCodePattern.MatchString(profile.CountryCode) {
+		v.Add("country_code", "invalid_format", "Country code must be two uppercase letters (ISO 3166-1 alpha-2)")
+	}
+	if profile.BirthTime != "" {
+		if _, err := time.Parse("15:04:05", profile.BirthTime); err != nil {
+			if _, err := time.Parse("15:04", profile.BirthTime); err != nil {
+				v.Add("birth_time", "invalid_format", "Birth time must use the HH:MM or HH:MM:SS format")
+			}
+		}
+	}
+	for field, value := range map[string]string{
+		"siblings":  profile.Siblings,
+		"horoscope": profile.Horoscope,
+		"metadata":  profile.Metadata,
+	} {
+		if value == "" {
+			continue
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(value), &object); err != nil {
+			v.Add(field, "invalid_json", "Must be a JSON object")
+		}
+	}
+	return nil
+}
+
+func (s *ProfileService) validateProfileEnums(v *utils.ValidationError, profile models.Profile) error {
+	fields := []struct {
+		name, value string
+		allowed     func(models.ProfileEnums) []string
+	}{
+		{"civil_status", profile.CivilStatus, func(e models.ProfileEnums) []string { return e.CivilStatus }},
+		{"dietary_preference", profile.DietaryPreference, func(e models.ProfileEnums) []string { return e.DietaryPreference }},
+		{"smoking", profile.Smoking, func(e models.ProfileEnums) []string { return e.HabitFrequency }},
+		{"alcohol", profile.Alcohol, func(e models.ProfileEnums) []string { return e.HabitFrequency }},
+		{"highest_education", profile.HighestEducation, func(e models.ProfileEnums) []string { return e.EducationLevel }},
+		{"employment_status", profile.EmploymentStatus, func(e models.ProfileEnums) []string { return e.EmploymentStatus }},
+	}
+
+	var enums models.ProfileEnums
+	loaded := false
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if !loaded {
+			var err error
+			if enums, err = s.cachedProfileEnums(); err != nil {
+				return err
+			}
+			loaded = true
+		}
+		allowed := field.allowed(enums)
+		if !containsString(allowed, field.value) {
+			v.Add(field.name, "invalid_choice", fmt.Sprintf("Must be one of %v", allowed))
+		}
+	}
+	return nil
+}
+
+// validateProfileDateOfBirth expects a YYYY-MM-DD date at least MinimumProfileAge years before now.
+func validateProfileDateOfBirth(v *utils.ValidationError, dateOfBirth string, now time.Time) {
+	if dateOfBirth == "" {
+		return
+	}
+	born, err := time.Parse("2006-01-02", dateOfBirth)
+	if err != nil {
+		v.Add("date_of_birth", "invalid_format", "Date of birth must use the YYYY-MM-DD format")
+		return
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if born.After(today) {
+		v.Add("date_of_birth", "in_future", "Date of birth cannot be in the future")
+		return
+	}
+	if born.AddDate(MinimumProfileAge, 0, 0).After(today) {
+		v.Add("date_of_birth", "too_young", fmt.Sprintf("You must be at least %d years old", MinimumProfileAge))
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
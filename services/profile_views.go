@@ -0,0 +1,73 @@
+package services
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/utils"
+)
+
+const (
+	defaultProfileViewsLimit = 20
+	maxProfileViewsLimit     = 100
+)
+
+// recordProfileView records that viewerID looked at userID's profile. Users viewing their own
+// profile are not recorded.
+func (s *ProfileService) recordProfileView(viewerID, userID int) error {
+	if viewerID == 0 || viewerID == userID {
+		return nil
+	}
+	return s.viewRepo.Record(viewerID, userID)
+}
+
+// ListProfileViews returns a page of the users who viewed the user's profile, most recent first,
+// with the view counts. Views made in incognito mode are left out. A limit of zero selects the
+// default page size; invalid paging is rejected with a *utils.ValidationError.
+func (s *ProfileService) ListProfileViews(userID, limit, offset int) (models.ProfileViews, error) {
+	if limit == 0 {
+		limit = defaultProfileViewsLimit
+	}
+	var invalid utils.ValidationError
+	if limit < 1 || limit > maxProfileViewsLimit {
+		invalid.Add("limit", "out_of_range", "Limit must be between 1 and "+strconv.Itoa(maxProfileViewsLimit))
+	}
+	if offset < 0 {
+		invalid.Add("offset", "out_of_range", "Offset must not be negative")
+	}
+	if err := invalid.OrNil(); err != nil {
+		return models.ProfileViews{}, err
+	}
+
+	counts, err := s.viewRepo.Counts(userID)
+	if err != nil {
+		log.Printf("ListProfileViews count error for user %d: %v", userID, err)
+		return models.ProfileViews{}, err
+	}
+	viewers, err := s.viewRepo.ListViewers(userID, limit, offset)
+	if err != nil {
+		log.Printf("ListProfileViews repository error for user %d: %v", userID, err)
+		return models.ProfileViews{}, err
+	}
+	return models.ProfileViews{ProfileViewCounts: counts, Viewers: viewers}, nil
+}
+
+// GetProfileViewSettings returns whether the user browses profiles in incognito mode.
+func (s *ProfileService) GetProfileViewSettings(userID int) (models.ProfileViewSettings, error) {
+	settings, err := s.viewRepo.GetSettings(userID)
+	if err != nil {
+		log.Printf("GetProfileViewSettings repository error for user %d: %v", userID, err)
+	}
+	return settings, err
+}
+
+// UpdateProfileViewSettings stores the user's view settings. Switching incognito mode applies to
+// views from then on; views already recorded keep the mode they were made in.
+func (s *ProfileService) UpdateProfileViewSettings(userID int, settings models.ProfileViewSettings) (models.ProfileViewSettings, error) {
+	if err := s.viewRepo.SaveSettings(userID, settings); err != nil {
+		log.Printf("UpdateProfileViewSettings repository error for user %d: %v", userID, err)
+		return models.ProfileViewSettings{}, err
+	}
+	return settings, nil
+}
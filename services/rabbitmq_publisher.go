@@ -13,6 +13,7 @@ import (
 const (
 	defaultLifecycleExchange = "user.lifecycle"
 	lifecycleRoutingTemplate = "user.%s"
+	auditRoutingTemplate     = "user.audit.%s"
 )
 
 // RabbitMQPublisher wraps a RabbitMQ connection/channel for publishing lifecycle events.
@@ -68,6 +69,30 @@ func (p *RabbitMQPublisher) PublishLifecycleEvent(ctx context.Context, event mod
 	})
 }
 
+// PublishAuditEvent publishes the audit record to the configured exchange.
+func (p *RabbitMQPublisher) PublishAuditEvent(ctx context.Context, event models.UserAuditOutbox) error {
+	if p == nil || p.channel == nil {
+		return fmt.Errorf("rabbitmq publisher not configured")
+	}
+	routingKey := fmt.Sprintf(auditRoutingTemplate, string(event.EventType))
+	message := map[string]interface{}{
+		"event_id":    event.EventID,
+		"user_id":     event.UserID,
+		"event_type":  event.EventType,
+		"payload":     json.RawMessage(event.Payload),
+		"occurred_at": event.CreatedAt,
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("marshal audit event: %w", err)
+	}
+	return p.channel.PublishWithContext(ctx, p.exchange, routingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
 // Close releases the underlying channel and connection.
 func (p *RabbitMQPublisher) Close() {
 	if p == nil {
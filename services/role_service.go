@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+)
+
+var (
+	// ErrUnknownRole is returned for a role name that is not one of the known roles.
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrCannotRevokeOwnAdmin is returned when admins try to take the admin role away from
+	// themselves, which could leave nobody able to manage roles.
+	ErrCannotRevokeOwnAdmin = errors.New("admins cannot revoke their own admin role")
+)
+
+// RoleService checks and manages the roles that unlock the /admin endpoints.
+type RoleService struct {
+	db              *sql.DB
+	roleRepo        *repositories.RoleRepository
+	auditOutboxRepo *repositories.UserAuditOutboxRepository
+}
+
+// NewRoleService creates a new RoleService.
+func NewRoleService(db *sql.DB) *RoleService {
+	return &RoleService{
+		db:              db,
+		roleRepo:        repositories.NewRoleRepository(db),
+		auditOutboxRepo: repositories.NewUserAuditOutboxRepository(db),
+	}
+}
+
+// ListRoles returns the roles held by the user.
+func (s *RoleService) ListRoles(userID int) ([]string, error) {
+	roles, err := s.roleRepo.ListForUser(userID)
+	if err != nil {
+		log.Printf("RoleService.ListRoles repository error for user %d: %v", userID, err)
+	}
+	return roles, err
+}
+
+// HasAnyRole reports whether the user currently holds at least one of the roles.
+func (s *RoleService) HasAnyRole(userID int, roles ...string) (bool, error) {
+	granted, err := s.roleRepo.HasAny(userID, roles)
+	if err != nil {
+		log.Printf("RoleService.HasAnyRole repository error for user %d: %v", userID, err)
+	}
+	return granted, err
+}
+
+// GrantRole gives the user a role on behalf of the admin adminID. Granting a role the user already
+// holds succeeds without recording anything.
+func (s *RoleService) GrantRole(ctx context.Context, adminID, userID int, role string) error {
+	if !models.IsValidRole(role) {
+		return ErrUnknownRole
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	granted, err := s.roleRepo.GrantTx(tx, userID, role, adminID)
+	if err != nil {
+		return err
+	}
+	if !granted {
+		return nil
+	}
+	if err := s.auditRoleChangeTx(tx, userID, models.UserAuditEventTypeRoleGranted, role, adminID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeRole takes a role away from the user on behalf of the admin adminID. Access tokens that
+// still list the role stop working for role protected routes on the next request.
+func (s *RoleService) RevokeRole(ctx context.Context, adminID, userID int, role string) error {
+	if !models.IsValidRole(role) {
+		return ErrUnknownRole
+	}
+	if adminID == userID && role == models.RoleAdmin {
+		return ErrCannotRevokeOwnAdmin
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.roleRepo.RevokeTx(tx, userID, role); err != nil {
+		return err
+	}
+	if err := s.auditRoleChangeTx(tx, userID, models.UserAuditEventTypeRoleRevoked, role, adminID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *RoleService) auditRoleChangeTx(tx *sql.Tx, userID int, eventType models.UserAuditEventType, role string, adminID int) error {
+	event, err := buildAuditEvent(userID, eventType, map[string]string{
+		"role":     role,
+		"admin_id": strconv.Itoa(adminID),
+	})
+	if err != nil {
+		return err
+	}
+	return s.auditOutboxRepo.EnqueueTx(tx, event)
+}
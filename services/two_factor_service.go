@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/icpinto/dating-app/models"
+	"github.com/icpinto/dating-app/repositories"
+	"github.com/icpinto/dating-app/utils"
+)
+
+// recoveryCodeCount is the number of recovery codes handed out per set.
+const recoveryCodeCount = 10
+
+var (
+	// ErrTwoFactorAlreadyEnabled is returned when enrolling or confirming while 2FA is already on.
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	// ErrTwoFactorNotEnabled is returned when an operation needs a confirmed enrollment.
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication not enabled")
+	// ErrInvalidTwoFactorCode is returned for a wrong, expired or replayed TOTP or recovery code.
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorService manages TOTP enrollment, recovery codes and the second step of logins.
+type TwoFactorService struct {
+	db              *sql.DB
+	repo            *repositories.TwoFactorRepository
+	auditOutboxRepo *repositories.UserAuditOutboxRepository
+	loginThrottle   *LoginThrottle
+	issuer          string
+}
+
+// NewTwoFactorService creates a new TwoFactorService. TOTP_ISSUER names the account in
+// authenticator apps.
+func NewTwoFactorService(db *sql.DB) *TwoFactorService {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "DatingApp"
+	}
+	return &TwoFactorService{
+		db:              db,
+		repo:            repositories.NewTwoFactorRepository(db),
+		auditOutboxRepo: repositories.NewUserAuditOutboxRepository(db),
+		loginThrottle:   NewLoginThrottle(repositories.NewLoginAttemptRepository(db)),
+		issuer:          issuer,
+	}
+}
+
+// IsEnabled reports whether logins of the user require a second factor.
+func (s *TwoFactorService) IsEnabled(userID int) (bool, error) {
+	enabled, err := s.repo.IsEnabled(userID)
+	if err != nil {
+		log.Printf("TwoFactorService.IsEnabled repository error for user %d: %v", userID, err)
+	}
+	return enabled, err
+}
+
+// Status returns whether 2FA is on and how many recovery codes are left.
+func (s *TwoFactorService) Status(userID int) (models.TwoFactorStatus, error) {
+	enabled, err := s.IsEnabled(userID)
+	if err != nil || !enabled {
+		return models.TwoFactorStatus{}, err
+	}
+	remaining, err := s.repo.CountRecoveryCodes(userID)
+	if err != nil {
+		return models.TwoFactorStatus{}, err
+	}
+	return models.TwoFactorStatus{Enabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+// Enroll generates a new TOTP secret for the user and returns it with its otpauth URI. The
+// enrollment has no effect on logins until it is confirmed with a code.
+func (s *TwoFactorService) Enroll(userID int) (string, string, error) {
+	username, err := repositories.GetUsernameByIDAllowInactive(s.db, userID)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	encrypted, err := utils.EncryptSecret(secret)
+	if err != nil {
+		return "", "", err
+	}
+	saved, err := s.repo.SavePending(userID, encrypted)
+	if err != nil {
+		return "", "", err
+	}
+	if !saved {
+		return "", "", ErrTwoFactorAlreadyEnabled
+	}
+	return secret, utils.TOTPProvisioningURI(s.issuer, username, secret), nil
+}
+
+// Confirm turns on 2FA once the user proves their authenticator produces valid codes, and returns
+// the first set of recovery codes. The codes are only ever shown here. Wrong codes count towards
+// the login backoff of the account.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int, code, ipAddress string) ([]string, error) {
+	throttleKey := accountLoginKey(userID)
+	if err := s.loginThrottle.Check(throttleKey, ipAddress); err != nil {
+		return nil, err
+	}
+	enrollment, err := s.repo.Get(userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrTwoFactorNotFound) {
+			return nil, ErrTwoFactorNotEnabled
+		}
+		return nil, err
+	}
+	if enrollment.ConfirmedAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.verifyTOTPTx(tx, enrollment, code); err != nil {
+		s.recordCodeFailure(err, throttleKey, ipAddress)
+		return nil, err
+	}
+	if err := s.repo.ConfirmTx(tx, userID); err != nil {
+		return nil, err
+	}
+	codes, err := s.replaceRecoveryCodesTx(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueueAuditTx(tx, userID, models.UserAuditEventTypeTwoFactorEnabled); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.loginThrottle.RecordSuccess(throttleKey)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user after checking a current TOTP code.
+// Wrong codes count towards the login backoff of the account.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int, code, ipAddress string) ([]string, error) {
+	throttleKey := accountLoginKey(userID)
+	if err := s.loginThrottle.Check(throttleKey, ipAddress); err != nil {
+		return nil, err
+	}
+	enrollment, err := s.confirmedEnrollment(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.verifyTOTPTx(tx, enrollment, code); err != nil {
+		s.recordCodeFailure(err, throttleKey, ipAddress)
+		return nil, err
+	}
+	codes, err := s.replaceRecoveryCodesTx(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueueAuditTx(tx, userID, models.UserAuditEventTypeRecoveryCodesRegenerated); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.loginThrottle.RecordSuccess(throttleKey)
+	return codes, nil
+}
+
+// Disable turns 2FA off. Both the password and a TOTP or recovery code are required, so a stolen
+// session alone cannot remove the second factor; wrong passwords and codes count towards the login
+// backoff of the account, so they cannot be guessed through this call either.
+func (s *TwoFactorService) Disable(ctx context.Context, userID int, password, code, ipAddress string) error {
+	throttleKey := accountLoginKey(userID)
+	if err := s.loginThrottle.Check(throttleKey, ipAddress); err != nil {
+		return err
+	}
+	hashedPassword, err := repositories.GetPasswordHashByID(s.db, userID)
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPassword(hashedPassword, password) {
+		s.loginThrottle.RecordFailure(throttleKey, ipAddress)
+		return ErrInvalidCredentials
+	}
+	enrollment, err := s.confirmedEnrollment(userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := s.verifyCodeTx(tx, enrollment, code); err != nil {
+		s.recordCodeFailure(err, throttleKey, ipAddress)
+		return err
+	}
+	if err := s.repo.DeleteTx(tx, userID); err != nil {
+		return err
+	}
+	if err := s.enqueueAuditTx(tx, userID, models.UserAuditEventTypeTwoFactorDisabled); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.loginThrottle.RecordSuccess(throttleKey)
+	return nil
+}
+
+// CompleteLogin exchanges a challenge token and a TOTP or recovery code for the user ID. Failed
+// codes count towards the same backoff and lockout as failed passwords.
+func (s *TwoFactorService) CompleteLogin(ctx context.Context, challengeToken, code, ipAddress string) (int, error) {
+	userID, err := utils.ParseChallengeToken(challengeToken)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := repositories.GetUsernameByIDAllowInactive(s.db, userID); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return 0, utils.ErrInvalidToken
+		}
+		return 0, err
+	}
+	throttleKey := accountLoginKey(userID)
+	if err := s.loginThrottle.Check(throttleKey, ipAddress); err != nil {
+		return 0, err
+	}
+	enrollment, err := s.confirmedEnrollment(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	usedRecoveryCode, err := s.verifyCodeTx(tx, enrollment, code)
+	if err != nil {
+		s.recordCodeFailure(err, throttleKey, ipAddress)
+		return 0, err
+	}
+	if usedRecoveryCode {
+		if err := s.enqueueAuditTx(tx, userID, models.UserAuditEventTypeRecoveryCodeUsed); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	s.loginThrottle.RecordSuccess(throttleKey)
+	return userID, nil
+}
+
+// recordCodeFailure counts a rejected code against the account and client IP. Other errors, such
+// as database failures, say nothing about the code and are not counted.
+func (s *TwoFactorService) recordCodeFailure(err error, throttleKey, ipAddress string) {
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		s.loginThrottle.RecordFailure(throttleKey, ipAddress)
+	}
+}
+
+func (s *TwoFactorService) confirmedEnrollment(userID int) (models.TOTPEnrollment, error) {
+	enrollment, err := s.repo.Get(userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrTwoFactorNotFound) {
+			return models.TOTPEnrollment{}, ErrTwoFactorNotEnabled
+		}
+		return models.TOTPEnrollment{}, err
+	}
+	if enrollment.ConfirmedAt == nil {
+		return models.TOTPEnrollment{}, ErrTwoFactorNotEnabled
+	}
+	return enrollment, nil
+}
+
+// verifyCodeTx accepts either a TOTP code or an unused recovery code and reports which one it was.
+func (s *TwoFactorService) verifyCodeTx(tx *sql.Tx, enrollment models.TOTPEnrollment, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == utils.TOTPDigits {
+		return false, s.verifyTOTPTx(tx, enrollment, code)
+	}
+	used, err := s.repo.UseRecoveryCodeTx(tx, enrollment.UserID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	if !used {
+		return false, ErrInvalidTwoFactorCode
+	}
+	return true, nil
+}
+
+func (s *TwoFactorService) verifyTOTPTx(tx *sql.Tx, enrollment models.TOTPEnrollment, code string) error {
+	secret, err := utils.DecryptSecret(enrollment.SecretEncrypted)
+	if err != nil {
+		return err
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now(), enrollment.LastUsedStep)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	// Recording the step atomically keeps a concurrent request from using the same code twice.
+	fresh, err := s.repo.UseStepTx(tx, enrollment.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) replaceRecoveryCodesTx(tx *sql.Tx, userID int) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(normalizeRecoveryCode(code)))
+	}
+	if err := s.repo.ReplaceRecoveryCodesTx(tx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) enqueueAuditTx(tx *sql.Tx, userID int, eventType models.UserAuditEventType) error {
+	event, err := buildAuditEvent(userID, eventType, nil)
+	if err != nil {
+		return err
+	}
+	return s.auditOutboxRepo.EnqueueTx(tx, event)
+}
+
+// generateRecoveryCode returns a random code formatted as two groups of five characters.
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 7)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))[:10]
+	return encoded[:5] + "-" + encoded[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -4,8 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/mail"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,41 +20,466 @@ import (
 	"github.com/icpinto/dating-app/utils"
 )
 
+const (
+	// EmailVerificationTTL bounds how long a verification link stays valid.
+	EmailVerificationTTL = 48 * time.Hour
+	// PasswordResetTTL bounds how long a password reset link stays valid.
+	PasswordResetTTL = time.Hour
+	// passwordResetSendTimeout bounds a reset email sent after the request was answered.
+	passwordResetSendTimeout = time.Minute
+)
+
+// ErrInvalidEmail is returned when an email address cannot be parsed.
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// ErrInvalidCredentials is returned for an unknown username and for a wrong password alike.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrEmailUnchanged is returned when asking to change the email to the address already in use.
+var ErrEmailUnchanged = errors.New("email unchanged")
+
+// ErrEmailAlreadyVerified is returned when asking to verify an address that is already verified.
+var ErrEmailAlreadyVerified = errors.New("email already verified")
+
 // UserService provides user related operations.
 type UserService struct {
-	db                  *sql.DB
-	lifecycleOutboxRepo *repositories.UserLifecycleOutboxRepository
+	db                    *sql.DB
+	mailer                Mailer
+	lifecycleOutboxRepo   *repositories.UserLifecycleOutboxRepository
+	sessionRepo           *repositories.SessionRepository
+	emailVerificationRepo *repositories.EmailVerificationRepository
+	passwordResetRepo     *repositories.PasswordResetRepository
+	auditOutboxRepo       *repositories.UserAuditOutboxRepository
+	roleRepo              *repositories.RoleRepository
+	loginThrottle         *LoginThrottle
+}
+
+// NewUserService creates a new UserService with the given database handle and mailer.
+func NewUserService(db *sql.DB, mailer Mailer) *UserService {
+	return &UserService{
+		db:                    db,
+		mailer:                mailer,
+		lifecycleOutboxRepo:   repositories.NewUserLifecycleOutboxRepository(db),
+		sessionRepo:           repositories.NewSessionRepository(db),
+		emailVerificationRepo: repositories.NewEmailVerificationRepository(db),
+		passwordResetRepo:     repositories.NewPasswordResetRepository(db),
+		auditOutboxRepo:       repositories.NewUserAuditOutboxRepository(db),
+		roleRepo:              repositories.NewRoleRepository(db),
+		loginThrottle:         NewLoginThrottle(repositories.NewLoginAttemptRepository(db)),
+	}
+}
+
+// CheckCredentials verifies a username or email address and a password and returns the user ID.
+// Identifiers containing @ are matched against email addresses, ignoring case, and then against
+// usernames, which older accounts may have registered with an @. Unknown identifiers and wrong
+// passwords both yield ErrInvalidCredentials and take the same time to answer. Failures are counted
+// per account, so the username and every spelling of the email address share one backoff; while
+// the account or client IP is backing off a *LoginThrottledError is returned instead.
+func (s *UserService) CheckCredentials(identifier, password, ipAddress string) (int, error) {
+	hashedPassword, userID, err := lookupCredentials(s.db, identifier)
+	if err != nil && !errors.Is(err, repositories.ErrUserNotFound) {
+		log.Printf("CheckCredentials repository error: %v", err)
+		return 0, err
+	}
+	throttleKey := identifier
+	if err == nil {
+		throttleKey = accountLoginKey(userID)
+	}
+	if err := s.loginThrottle.Check(throttleKey, ipAddress); err != nil {
+		return 0, err
+	}
+	if userID == 0 {
+		hashedPassword = dummyPasswordHash()
+	}
+
+	ok, needsRehash := utils.VerifyPassword(hashedPassword, password)
+	if !ok || userID == 0 {
+		s.loginThrottle.RecordFailure(throttleKey, ipAddress)
+		return 0, ErrInvalidCredentials
+	}
+
+	s.loginThrottle.RecordSuccess(throttleKey)
+	if needsRehash {
+		s.upgradePasswordHash(userID, hashedPassword, password)
+	}
+	return userID, nil
 }
 
-// NewUserService creates a new UserService with the given database handle.
-func NewUserService(db *sql.DB) *UserService {
-	return &UserService{db: db, lifecycleOutboxRepo: repositories.NewUserLifecycleOutboxRepository(db)}
+// lookupCredentials finds the password hash and ID of the account a login identifier names.
+func lookupCredentials(db *sql.DB, identifier string) (string, int, error) {
+	if isEmailLike(identifier) {
+		hashedPassword, userID, err := repositories.GetUserpwdByEmail(db, identifier)
+		if !errors.Is(err, repositories.ErrUserNotFound) {
+			return hashedPassword, userID, err
+		}
+	}
+	return repositories.GetUserpwdByUsername(db, identifier)
 }
 
-// GetUsepwd retrieves the hashed password and user ID for a username.
-func (s *UserService) GetUsepwd(username string) (string, int, error) {
-	pwd, id, err := repositories.GetUserpwdByUsername(s.db, username)
+// upgradePasswordHash re-hashes a verified password with the current parameters. Failures are only
+// logged; the old hash keeps working and the upgrade is retried on the next login.
+func (s *UserService) upgradePasswordHash(userID int, previousHash, password string) {
+	hashedPassword, err := utils.HashPassword(password)
 	if err != nil {
-		log.Printf("GetUsepwd service error for %s: %v", username, err)
+		log.Printf("upgradePasswordHash hash error for user %d: %v", userID, err)
+		return
+	}
+	if err := repositories.ReplacePasswordHash(s.db, userID, previousHash, hashedPassword); err != nil {
+		log.Printf("upgradePasswordHash repository error for user %d: %v", userID, err)
 	}
-	return pwd, id, err
 }
 
-// RegisterUser creates a new user in the database after hashing the password.
-func (s *UserService) RegisterUser(user models.User) error {
+// RegisterUser creates a new, unverified user after hashing the password and emails a verification link.
+// A failure to deliver the email does not fail the registration; the user can ask for a new link.
+func (s *UserService) RegisterUser(ctx context.Context, user models.User) error {
+	if !isValidEmail(user.Email) {
+		return ErrInvalidEmail
+	}
+	policy, err := activePasswordPolicy()
+	if err != nil {
+		return err
+	}
+	var invalid utils.ValidationError
+	if isEmailLike(user.Username) {
+		invalid.Add("username", "looks_like_email", "Username must not contain @")
+	}
+	policy.Check(&invalid, "password", user.Password, user.Username, user.Email)
+	if err := invalid.OrNil(); err != nil {
+		return err
+	}
+
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
 		log.Printf("RegisterUser hash password error for %s: %v", user.Username, err)
 		return err
 	}
 	user.Password = hashedPassword
-	if err := repositories.CreateUser(s.db, user); err != nil {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := repositories.CreateUserTx(tx, user)
+	if err != nil {
 		log.Printf("RegisterUser repository error for %s: %v", user.Username, err)
 		return err
 	}
+	token, err := s.createEmailVerificationTx(tx, userID, user.Email)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := s.sendVerificationEmail(ctx, user.Email, token); err != nil {
+		log.Printf("RegisterUser verification email error for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// VerifyEmail consumes a verification token and marks the address it was issued for as verified.
+// When the token was issued for a pending address change, the pending address replaces the current
+// one and the previous address is told about the change.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, email, err := s.emailVerificationRepo.ConsumeTx(tx, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+	err = repositories.MarkEmailVerifiedTx(tx, userID, email)
+	if err == nil {
+		return tx.Commit()
+	}
+	if !errors.Is(err, repositories.ErrUserNotFound) {
+		return err
+	}
+
+	previous, err := repositories.ConfirmPendingEmailTx(tx, userID, email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			// The account changed its address, or asked for another one, after the link was sent.
+			return repositories.ErrVerificationTokenInvalid
+		}
+		return err
+	}
+	event, err := buildAuditEvent(userID, models.UserAuditEventTypeEmailChanged, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.auditOutboxRepo.EnqueueTx(tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, MailMessage{
+		To:      previous,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf("The email address of your account was changed to %s. If you did not make this change, reset your password and contact support.\n",
+			email),
+	})
+	if err != nil {
+		log.Printf("VerifyEmail change notification error for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// ChangePassword replaces the password after checking the current one. Every other session of the
+// user is signed out and outstanding reset links stop working.
+func (s *UserService) ChangePassword(ctx context.Context, userID int, sessionID, currentPassword, newPassword, ipAddress, userAgent string) error {
+	if err := s.checkCurrentPassword(userID, currentPassword, ipAddress); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hashedPassword, err := s.hashNewPasswordTx(tx, userID, "new_password", newPassword)
+	if err != nil {
+		return err
+	}
+	if err := repositories.UpdatePasswordTx(tx, userID, hashedPassword); err != nil {
+		return err
+	}
+	if err := s.passwordResetRepo.InvalidateForUserTx(tx, userID); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeOthersTx(tx, userID, sessionID); err != nil {
+		return err
+	}
+	event, err := buildAuditEvent(userID, models.UserAuditEventTypePasswordChanged, map[string]string{
+		"ip_address": ipAddress,
+		"user_agent": userAgent,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.auditOutboxRepo.EnqueueTx(tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RequestEmailChange checks the current password and emails a confirmation link to the new
+// address. The account keeps its current address until the link is followed; every other session
+// of the user is signed out right away.
+func (s *UserService) RequestEmailChange(ctx context.Context, userID int, sessionID, currentPassword, newEmail, ipAddress, userAgent string) error {
+	if !isValidEmail(newEmail) {
+		return ErrInvalidEmail
+	}
+	current, _, err := repositories.GetEmailVerificationByID(s.db, userID)
+	if err != nil {
+		log.Printf("RequestEmailChange repository error for %d: %v", userID, err)
+		return err
+	}
+	if newEmail == current {
+		return ErrEmailUnchanged
+	}
+	if err := s.checkCurrentPassword(userID, currentPassword, ipAddress); err != nil {
+		return err
+	}
+	if _, err := repositories.GetUserIDByEmail(s.db, newEmail); err == nil {
+		return repositories.ErrEmailInUse
+	} else if !errors.Is(err, repositories.ErrUserNotFound) {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := repositories.SetPendingEmailTx(tx, userID, newEmail); err != nil {
+		return err
+	}
+	if err := s.emailVerificationRepo.InvalidateForUserTx(tx, userID); err != nil {
+		return err
+	}
+	token, err := s.createEmailVerificationTx(tx, userID, newEmail)
+	if err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeOthersTx(tx, userID, sessionID); err != nil {
+		return err
+	}
+	event, err := buildAuditEvent(userID, models.UserAuditEventTypeEmailChangeRequested, map[string]string{
+		"ip_address": ipAddress,
+		"user_agent": userAgent,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.auditOutboxRepo.EnqueueTx(tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, MailMessage{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Confirm that you want to use this address for your account by opening the link below.\n\n%s\n\nThe link expires in %d hours. Until then your account keeps its current address.\n",
+			appLink("/verify-email", token), int(EmailVerificationTTL.Hours())),
+	})
+	if err != nil {
+		log.Printf("RequestEmailChange confirmation email error for user %d: %v", userID, err)
+	}
 	return nil
 }
 
+// ResendVerificationEmail replaces any outstanding verification link of the user with a new one.
+func (s *UserService) ResendVerificationEmail(ctx context.Context, userID int) error {
+	email, verified, err := repositories.GetEmailVerificationByID(s.db, userID)
+	if err != nil {
+		log.Printf("ResendVerificationEmail repository error for %d: %v", userID, err)
+		return err
+	}
+	if verified {
+		return ErrEmailAlreadyVerified
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.emailVerificationRepo.InvalidateForUserTx(tx, userID); err != nil {
+		return err
+	}
+	token, err := s.createEmailVerificationTx(tx, userID, email)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.sendVerificationEmail(ctx, email, token)
+}
+
+// IsEmailVerified reports whether the user has confirmed their email address.
+func (s *UserService) IsEmailVerified(userID int) (bool, error) {
+	_, verified, err := repositories.GetEmailVerificationByID(s.db, userID)
+	if err != nil {
+		log.Printf("IsEmailVerified service error for %d: %v", userID, err)
+	}
+	return verified, err
+}
+
+// RequestPasswordReset emails a reset link to the stored address of the account using email.
+// Unknown addresses are not reported, and the email is sent in the background so that answering
+// takes as long for registered addresses as for unknown ones; callers cannot use the endpoint to
+// discover registered emails.
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	userID, storedEmail, err := repositories.GetUserIDAndEmailByEmail(s.db, email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil
+		}
+		log.Printf("RequestPasswordReset repository error: %v", err)
+		return err
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.passwordResetRepo.InvalidateForUserTx(tx, userID); err != nil {
+		return err
+	}
+	expiresAt := time.Now().UTC().Add(PasswordResetTTL)
+	if err := s.passwordResetRepo.CreateTx(tx, userID, utils.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	go s.sendPasswordReset(userID, storedEmail, token)
+	return nil
+}
+
+// sendPasswordReset emails the reset link outside the request. A failed send is only logged:
+// answering differently for registered addresses would reveal them.
+func (s *UserService) sendPasswordReset(userID int, email, token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+	defer cancel()
+	err := s.mailer.Send(ctx, MailMessage{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account. If it was you, open the link below to choose a new password.\n\n%s\n\nThe link expires in %d minutes. If you did not ask for a reset you can ignore this email.\n",
+			appLink("/password/reset", token), int(PasswordResetTTL.Minutes())),
+	})
+	if err != nil {
+		log.Printf("RequestPasswordReset send error for user %d: %v", userID, err)
+	}
+}
+
+// ResetPassword consumes a reset token and replaces the password. Every session of the user is
+// revoked and an audit record is enqueued in the same transaction.
+func (s *UserService) ResetPassword(ctx context.Context, token, newPassword, ipAddress, userAgent string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := s.passwordResetRepo.ConsumeTx(tx, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+	// A rejected password rolls back, so the link can be used again with a better one.
+	hashedPassword, err := s.hashNewPasswordTx(tx, userID, "password", newPassword)
+	if err != nil {
+		return err
+	}
+	if err := repositories.UpdatePasswordTx(tx, userID, hashedPassword); err != nil {
+		return err
+	}
+	if err := s.passwordResetRepo.InvalidateForUserTx(tx, userID); err != nil {
+		return err
+	}
+	if err := s.sessionRepo.RevokeAllForUserTx(tx, userID); err != nil {
+		return err
+	}
+
+	event, err := buildAuditEvent(userID, models.UserAuditEventTypePasswordReset, map[string]string{
+		"ip_address": ipAddress,
+		"user_agent": userAgent,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.auditOutboxRepo.EnqueueTx(tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // GetUserIDByUsername returns the user ID for a given username.
 func (s *UserService) GetUserIDByUsername(username string) (int, error) {
 	id, err := repositories.GetUserIDByUsername(s.db, username)
@@ -96,6 +527,9 @@ func (s *UserService) DeactivateUser(ctx context.Context, userID int, reason str
 	if err := repositories.DeactivateUserTx(tx, userID); err != nil {
 		return err
 	}
+	if err := s.sessionRepo.RevokeAllForUserTx(tx, userID); err != nil {
+		return err
+	}
 
 	event, err := s.buildLifecycleEvent(userID, models.UserLifecycleEventTypeDeactivated, reason)
 	if err != nil {
@@ -147,6 +581,10 @@ func (s *UserService) DeleteUser(ctx context.Context, userID int, reason string)
 		return err
 	}
 
+	if err := s.sessionRepo.RevokeAllForUserTx(tx, userID); err != nil {
+		return err
+	}
+
 	if err := repositories.DeleteUserTx(tx, userID); err != nil {
 		return err
 	}
@@ -154,6 +592,191 @@ func (s *UserService) DeleteUser(ctx context.Context, userID int, reason string)
 	return tx.Commit()
 }
 
+// CreateSession starts a server-side session for the user and issues its first token pair.
+func (s *UserService) CreateSession(userID int, userAgent, ipAddress string) (models.AuthTokens, error) {
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return models.AuthTokens{}, err
+	}
+
+	now := time.Now().UTC()
+	session := models.Session{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		DeviceLabel: utils.DeviceLabel(userAgent),
+		UserAgent:   userAgent,
+		IPAddress:   ipAddress,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(utils.RefreshTokenTTL),
+	}
+	if err := s.sessionRepo.Create(session, utils.HashToken(refreshToken)); err != nil {
+		log.Printf("CreateSession repository error for user %d: %v", userID, err)
+		return models.AuthTokens{}, err
+	}
+
+	return s.issueTokens(session.UserID, session.ID, refreshToken)
+}
+
+// RefreshSession exchanges a refresh token for a new token pair, rotating the refresh token.
+func (s *UserService) RefreshSession(refreshToken, ipAddress string) (models.AuthTokens, error) {
+	nextRefreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return models.AuthTokens{}, err
+	}
+
+	expiresAt := time.Now().UTC().Add(utils.RefreshTokenTTL)
+	session, err := s.sessionRepo.Rotate(utils.HashToken(refreshToken), utils.HashToken(nextRefreshToken), expiresAt, ipAddress)
+	if err != nil {
+		if !errors.Is(err, repositories.ErrSessionNotFound) {
+			log.Printf("RefreshSession repository error: %v", err)
+		}
+		return models.AuthTokens{}, err
+	}
+
+	return s.issueTokens(session.UserID, session.ID, nextRefreshToken)
+}
+
+// ValidateSession returns ErrSessionNotFound unless the session is still active for the user.
+func (s *UserService) ValidateSession(userID int, sessionID string) error {
+	active, err := s.sessionRepo.IsActive(sessionID, userID)
+	if err != nil {
+		log.Printf("ValidateSession repository error for session %s: %v", sessionID, err)
+		return err
+	}
+	if !active {
+		return repositories.ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSession ends a single session of the user.
+func (s *UserService) RevokeSession(userID int, sessionID string) error {
+	if err := s.sessionRepo.Revoke(sessionID, userID); err != nil {
+		log.Printf("RevokeSession repository error for session %s: %v", sessionID, err)
+		return err
+	}
+	return nil
+}
+
+// ListSessions returns the active sessions of the user, flagging the one identified by currentID.
+func (s *UserService) ListSessions(userID int, currentID string) ([]models.Session, error) {
+	sessions, err := s.sessionRepo.ListActive(userID)
+	if err != nil {
+		log.Printf("ListSessions repository error for user %d: %v", userID, err)
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// RevokeAllSessions ends every session of the user, or every session but exceptID when it is set.
+func (s *UserService) RevokeAllSessions(userID int, exceptID string) (int64, error) {
+	revoked, err := s.sessionRepo.RevokeAllForUser(userID, exceptID)
+	if err != nil {
+		log.Printf("RevokeAllSessions repository error for user %d: %v", userID, err)
+	}
+	return revoked, err
+}
+
+func (s *UserService) issueTokens(userID int, sessionID, refreshToken string) (models.AuthTokens, error) {
+	roles, err := s.roleRepo.ListForUser(userID)
+	if err != nil {
+		return models.AuthTokens{}, err
+	}
+	accessToken, err := utils.GenerateSessionToken(userID, sessionID, roles...)
+	if err != nil {
+		return models.AuthTokens{}, err
+	}
+	return models.AuthTokens{
+		UserID:       userID,
+		SessionID:    sessionID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// hashNewPasswordTx checks a new password of the user against the password policy and hashes it.
+func (s *UserService) hashNewPasswordTx(tx *sql.Tx, userID int, field, password string) (string, error) {
+	username, email, err := repositories.GetUsernameAndEmailTx(tx, userID)
+	if err != nil {
+		return "", err
+	}
+	if err := validateNewPassword(field, password, username, email); err != nil {
+		return "", err
+	}
+	return utils.HashPassword(password)
+}
+
+// checkCurrentPassword returns ErrInvalidCredentials unless password is the user's current password.
+// Wrong passwords count towards the same backoff as failed logins to the account, so a stolen
+// session cannot be used to guess the password; while it applies a *LoginThrottledError is returned.
+func (s *UserService) checkCurrentPassword(userID int, password, ipAddress string) error {
+	throttleKey := accountLoginKey(userID)
+	if err := s.loginThrottle.Check(throttleKey, ipAddress); err != nil {
+		return err
+	}
+	hashedPassword, err := repositories.GetPasswordHashByID(s.db, userID)
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPassword(hashedPassword, password) {
+		s.loginThrottle.RecordFailure(throttleKey, ipAddress)
+		return ErrInvalidCredentials
+	}
+	s.loginThrottle.RecordSuccess(throttleKey)
+	return nil
+}
+
+func (s *UserService) createEmailVerificationTx(tx *sql.Tx, userID int, email string) (string, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().UTC().Add(EmailVerificationTTL)
+	if err := s.emailVerificationRepo.CreateTx(tx, userID, email, utils.HashToken(token), expiresAt); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *UserService) sendVerificationEmail(ctx context.Context, email, token string) error {
+	link := appLink("/verify-email", token)
+	return s.mailer.Send(ctx, MailMessage{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Welcome! Confirm your email address by opening the link below.\n\n%s\n\nThe link expires in %d hours.\n",
+			link, int(EmailVerificationTTL.Hours())),
+	})
+}
+
+// isEmailLike reports whether a login identifier names an email address rather than a username.
+func isEmailLike(identifier string) bool {
+	return strings.Contains(identifier, "@")
+}
+
+// isValidEmail accepts a bare address such as "jane@example.com", without a display name.
+func isValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+// appLink builds a link into the web application, which is served from APP_BASE_URL.
+func appLink(path, token string) string {
+	return appBaseURL() + path + "?token=" + url.QueryEscape(token)
+}
+
+func appBaseURL() string {
+	baseURL := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+	return baseURL
+}
+
 func (s *UserService) buildLifecycleEvent(userID int, eventType models.UserLifecycleEventType, reason string) (models.UserLifecycleOutbox, error) {
 	payload := make(map[string]string)
 	trimmed := strings.TrimSpace(reason)
@@ -172,3 +795,41 @@ func (s *UserService) buildLifecycleEvent(userID int, eventType models.UserLifec
 		CreatedAt: time.Now().UTC(),
 	}, nil
 }
+
+func buildAuditEvent(userID int, eventType models.UserAuditEventType, details map[string]string) (models.UserAuditOutbox, error) {
+	payload := make(map[string]string)
+	for key, value := range details {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			payload[key] = trimmed
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return models.UserAuditOutbox{}, err
+	}
+	return models.UserAuditOutbox{
+		EventID:   uuid.NewString(),
+		UserID:    userID,
+		EventType: eventType,
+		Payload:   body,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+var (
+	dummyPasswordHashOnce  sync.Once
+	dummyPasswordHashValue string
+)
+
+// dummyPasswordHash returns a hash to compare against when the username does not exist, so that
+// unknown usernames cost as much time as wrong passwords.
+func dummyPasswordHash() string {
+	dummyPasswordHashOnce.Do(func() {
+		hash, err := utils.HashPassword(uuid.NewString())
+		if err != nil {
+			log.Printf("dummyPasswordHash error: %v", err)
+		}
+		dummyPasswordHashValue = hash
+	})
+	return dummyPasswordHashValue
+}
@@ -0,0 +1,53 @@
+package utils
+
+import "strings"
+
+// DeviceLabel turns a User-Agent header into a short human readable label such as
+// "Chrome on Windows", used to tell sessions apart.
+func DeviceLabel(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if strings.TrimSpace(ua) == "" {
+		return "Unknown device"
+	}
+
+	var client string
+	switch {
+	case strings.Contains(ua, "edg/"):
+		client = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		client = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		client = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		client = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		client = "Safari"
+	case strings.Contains(ua, "okhttp") || strings.Contains(ua, "dart/") || strings.Contains(ua, "cfnetwork"):
+		client = "Mobile app"
+	}
+
+	var platform string
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ios"):
+		platform = "iOS"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os") || strings.Contains(ua, "macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	switch {
+	case client != "" && platform != "":
+		return client + " on " + platform
+	case client != "":
+		return client
+	case platform != "":
+		return platform + " device"
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// jpegOrientation returns the EXIF orientation (1 to 8) stored in a JPEG, or 1 when the data is not
+// a JPEG or carries no usable orientation.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		// Start of scan: the metadata segments are over.
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// applyOrientation turns img upright according to an EXIF orientation value.
+func applyOrientation(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			src := img.PixOffset(x, y)
+			dstOffset := dst.PixOffset(dx, dy)
+			copy(dst.Pix[dstOffset:dstOffset+4], img.Pix[src:src+4])
+		}
+	}
+	return dst
+}
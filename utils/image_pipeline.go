@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Uploaded images are never stored as received. ProcessImage sniffs the content, checks the limits,
+// decodes the image and re-encodes it as JPEG in three sizes. Re-encoding drops EXIF, GPS and any
+// other metadata after the EXIF orientation has been applied to the pixels.
+const (
+	// ImageContentType is the content type of every processed image.
+	ImageContentType = "image/jpeg"
+
+	ImageVariantFull   = "full"
+	ImageVariantMedium = "medium"
+	ImageVariantThumb  = "thumb"
+
+	imageFullMaxSide   = 2048
+	imageMediumMaxSide = 1024
+	imageThumbSide     = 256
+	imageJPEGQuality   = 85
+)
+
+var (
+	// ErrImageTooLarge is returned for uploads above the configured size limit.
+	ErrImageTooLarge = errors.New("image too large")
+	// ErrUnsupportedImageType is returned for uploads that are not JPEG, PNG or WebP.
+	ErrUnsupportedImageType = errors.New("unsupported image type")
+	// ErrImageDimensions is returned for images that are too small or too large in pixels.
+	ErrImageDimensions = errors.New("image dimensions out of range")
+	// ErrInvalidImage is returned for uploads that look like an image but fail to decode.
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// ImageLimits bound the uploads ProcessImage accepts.
+type ImageLimits struct {
+	MaxBytes int64
+	// MinDimension and MaxDimension apply to both width and height, in pixels.
+	MinDimension int
+	MaxDimension int
+}
+
+// DefaultImageLimits allows uploads of up to 10 MiB and 200 to 6000 pixels per side.
+func DefaultImageLimits() ImageLimits {
+	return ImageLimits{
+		MaxBytes:     10 << 20,
+		MinDimension: 200,
+		MaxDimension: 6000,
+	}
+}
+
+var (
+	imageLimitsMu      sync.RWMutex
+	currentImageLimits *ImageLimits
+)
+
+// LoadImageLimitsFromEnv configures the upload limits from IMAGE_MAX_UPLOAD_BYTES,
+// IMAGE_MIN_DIMENSION and IMAGE_MAX_DIMENSION, falling back to DefaultImageLimits for unset
+// variables.
+func LoadImageLimitsFromEnv() error {
+	limits := DefaultImageLimits()
+	if raw := strings.TrimSpace(os.Getenv("IMAGE_MAX_UPLOAD_BYTES")); raw != "" {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("IMAGE_MAX_UPLOAD_BYTES: %w", err)
+		}
+		limits.MaxBytes = value
+	}
+	for name, target := range map[string]*int{
+		"IMAGE_MIN_DIMENSION": &limits.MinDimension,
+		"IMAGE_MAX_DIMENSION": &limits.MaxDimension,
+	} {
+		raw := strings.TrimSpace(os.Getenv(name))
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*target = value
+	}
+	return ConfigureImageLimits(limits)
+}
+
+// ConfigureImageLimits replaces the limits applied by ProcessImage.
+func ConfigureImageLimits(limits ImageLimits) error {
+	switch {
+	case limits.MaxBytes < 1:
+		return fmt.Errorf("image upload limit must be at least 1 byte, got %d", limits.MaxBytes)
+	case limits.MinDimension < 1:
+		return fmt.Errorf("image minimum dimension must be at least 1, got %d", limits.MinDimension)
+	case limits.MaxDimension < limits.MinDimension:
+		return fmt.Errorf("image maximum dimension must be at least %d, got %d", limits.MinDimension, limits.MaxDimension)
+	}
+	imageLimitsMu.Lock()
+	currentImageLimits = &limits
+	imageLimitsMu.Unlock()
+	return nil
+}
+
+func imageLimits() ImageLimits {
+	imageLimitsMu.RLock()
+	defer imageLimitsMu.RUnlock()
+	if currentImageLimits == nil {
+		return DefaultImageLimits()
+	}
+	return *currentImageLimits
+}
+
+// ImageVariant is one encoded size of a processed image.
+type ImageVariant struct {
+	Name     string
+	FileName string
+	Width    int
+	Height   int
+	Data     []byte
+}
+
+// ProcessedImage holds the sizes generated from an upload. Hash is the SHA-256 of the uploaded
+// bytes and prefixes every file name, so identical uploads map to identical files and names never
+// depend on client input.
+type ProcessedImage struct {
+	Hash     string
+	Variants []ImageVariant
+}
+
+// Variant returns the variant with the given name.
+func (p ProcessedImage) Variant(name string) ImageVariant {
+	for _, variant := range p.Variants {
+		if variant.Name == name {
+			return variant
+		}
+	}
+	return ImageVariant{}
+}
+
+type imageDecoder struct {
+	decodeConfig func(io.Reader) (image.Config, error)
+	decode       func(io.Reader) (image.Image, error)
+}
+
+var imageDecoders = map[string]imageDecoder{
+	"image/jpeg": {jpeg.DecodeConfig, jpeg.Decode},
+	"image/png":  {png.DecodeConfig, png.Decode},
+	"image/webp": {webp.DecodeConfig, webp.Decode},
+}
+
+// ProcessImage validates an uploaded image and produces the full, medium and thumb variants.
+func ProcessImage(r io.Reader) (ProcessedImage, error) {
+	limits := imageLimits()
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return ProcessedImage{}, err
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return ProcessedImage{}, ErrImageTooLarge
+	}
+
+	decoder, ok := imageDecoders[http.DetectContentType(data)]
+	if !ok {
+		return ProcessedImage{}, ErrUnsupportedImageType
+	}
+	// Check the header first so oversized images are rejected before their pixels are allocated.
+	config, err := decoder.decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ProcessedImage{}, ErrInvalidImage
+	}
+	if config.Width < limits.MinDimension || config.Height < limits.MinDimension ||
+		config.Width > limits.MaxDimension || config.Height > limits.MaxDimension {
+		return ProcessedImage{}, ErrImageDimensions
+	}
+	src, err := decoder.decode(bytes.NewReader(data))
+	if err != nil {
+		return ProcessedImage{}, ErrInvalidImage
+	}
+
+	full := applyOrientation(resizeToFit(src, imageFullMaxSide), jpegOrientation(data))
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	processed := ProcessedImage{Hash: hash}
+	for _, variant := range []struct {
+		name   string
+		suffix string
+		img    image.Image
+	}{
+		{ImageVariantFull, "", full},
+		{ImageVariantMedium, "_medium", resizeToFit(full, imageMediumMaxSide)},
+		{ImageVariantThumb, "_thumb", cropSquare(full, imageThumbSide)},
+	} {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, variant.img, &jpeg.Options{Quality: imageJPEGQuality}); err != nil {
+			return ProcessedImage{}, err
+		}
+		bounds := variant.img.Bounds()
+		processed.Variants = append(processed.Variants, ImageVariant{
+			Name:     variant.name,
+			FileName: hash + variant.suffix + ".jpg",
+			Width:    bounds.Dx(),
+			Height:   bounds.Dy(),
+			Data:     buf.Bytes(),
+		})
+	}
+	return processed, nil
+}
+
+// resizeToFit scales img down so neither side exceeds maxSide. Smaller images keep their size.
+// Transparent areas are flattened onto white since JPEG has no alpha channel.
+func resizeToFit(img image.Image, maxSide int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			width, height = maxSide, max(1, height*maxSide/width)
+		} else {
+			width, height = max(1, width*maxSide/height), maxSide
+		}
+	}
+	return scaleOntoWhite(img, bounds, width, height)
+}
+
+// cropSquare cuts the largest centred square out of img and scales it to side pixels.
+func cropSquare(img image.Image, side int) *image.RGBA {
+	bounds := img.Bounds()
+	size := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-size)/2
+	y := bounds.Min.Y + (bounds.Dy()-size)/2
+	side = min(side, size)
+	return scaleOntoWhite(img, image.Rect(x, y, x+size, y+size), side, side)
+}
+
+func scaleOntoWhite(img image.Image, srcRect image.Rectangle, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, srcRect, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// JSONWebKey is the public half of an asymmetric signing key in RFC 7517 form.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicKey decodes the key into an *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+func (k JSONWebKey) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid exponent: %w", k.Kid, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("jwk %q: invalid RSA key", k.Kid)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("jwk %q: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid x coordinate: %w", k.Kid, err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid y coordinate: %w", k.Kid, err)
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("jwk %q: invalid P-256 coordinates", k.Kid)
+		}
+		// ecdh rejects points that are not on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("jwk %q: %w", k.Kid, err)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("jwk %q: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwk %q: invalid Ed25519 key", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("jwk %q: unsupported key type %q", k.Kid, k.Kty)
+	}
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// PublicJWKS returns the public keys of every configured asymmetric signing key.
+// HMAC keys are shared secrets and are never published.
+func PublicJWKS() (JSONWebKeySet, error) {
+	ring, err := signingKeys()
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	// Publish the active key first so consumers that only look at the first entry still work.
+	ids := make([]string, 0, len(ring.byID))
+	for id := range ring.byID {
+		if id != ring.active.ID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ordered := []SigningKey{ring.active}
+	for _, id := range ids {
+		ordered = append(ordered, ring.byID[id])
+	}
+
+	for _, key := range ordered {
+		if key.PrivateKey == nil {
+			continue
+		}
+		jwk := JSONWebKey{Use: "sig", Alg: key.Algorithm, Kid: key.ID}
+		switch pub := key.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
@@ -1,32 +1,114 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/icpinto/dating-app/models"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte("secret") // Secret key used for signing tokens
+const (
+	// AccessTokenTTL bounds how long an access token is accepted before it has to be refreshed.
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL bounds how long an idle session can be kept alive with its refresh token.
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// ChallengeTokenTTL bounds how long a password-verified login can wait for its second factor.
+	ChallengeTokenTTL = 5 * time.Minute
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashedPassword), err
-}
+	// TokenUseTwoFactorChallenge marks tokens that only prove the password step of a login.
+	TokenUseTwoFactorChallenge = "2fa_challenge"
+)
 
-// Function to generate a JWT token
+// GenerateToken issues a short-lived access token that is not bound to a session.
+// It is meant for service-to-service calls made on behalf of a user.
 func GenerateToken(userID int) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expiration time (24 hours)
+	return GenerateSessionToken(userID, "")
+}
+
+// GenerateSessionToken issues a short-lived access token bound to the given session and carrying
+// the user's roles.
+func GenerateSessionToken(userID int, sessionID string, roles ...string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 
 	claims := &models.Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		Roles:     roles,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+
+	return signClaims(claims)
+}
+
+// GenerateChallengeToken issues a short-lived token proving that the user passed the password step
+// of a login. It is not an access token and is refused by Authenticate.
+func GenerateChallengeToken(userID int) (string, error) {
+	now := time.Now()
+	claims := &models.Claims{
+		UserID:   userID,
+		TokenUse: TokenUseTwoFactorChallenge,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(ChallengeTokenTTL).Unix(),
+			IssuedAt:  now.Unix(),
 		},
 	}
+	return signClaims(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
-	return tokenString, err
+// ParseChallengeToken verifies a token issued by GenerateChallengeToken and returns the user ID.
+func ParseChallengeToken(tokenString string) (int, error) {
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	if claims.TokenUse != TokenUseTwoFactorChallenge {
+		return 0, ErrInvalidToken
+	}
+	return claims.UserID, nil
+}
+
+// ErrInvalidToken is returned when a token fails signature, algorithm or claim validation.
+var ErrInvalidToken = errors.New("invalid token")
+
+// ParseToken verifies the token signature against the configured keys and returns its claims.
+// Only algorithms of configured keys are accepted, and the key named by the kid header must use the
+// algorithm the token claims, so alg=none and algorithm-confusion tokens are rejected.
+func ParseToken(tokenString string) (*models.Claims, error) {
+	ring, err := signingKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &models.Claims{}
+	parser := &jwt.Parser{ValidMethods: ring.methods}
+	token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ring.byID[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("signing key %q does not accept algorithm %q", kid, token.Method.Alg())
+		}
+		return key.verificationMaterial(), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func signClaims(claims jwt.Claims) (string, error) {
+	ring, err := signingKeys()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(ring.active.Algorithm), claims)
+	token.Header["kid"] = ring.active.ID
+	return token.SignedString(ring.active.signingMaterial())
 }
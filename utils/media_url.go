@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Uploaded media is stored under a key and only reachable through signed URLs that expire, so a
+// leaked link stops working and a photo cannot be fetched by guessing its name. The signature is
+// an HMAC-SHA256 over the key and the expiry time.
+
+// DefaultMediaURLTTL is how long signed media URLs stay valid when MEDIA_URL_TTL is not set.
+const DefaultMediaURLTTL = 15 * time.Minute
+
+// MediaURLConfig controls how media URLs are signed.
+type MediaURLConfig struct {
+	SigningKey []byte
+	TTL        time.Duration
+	// BaseURL prefixes signed URLs, for example https://api.example.com. When empty the scheme
+	// and host of the request are used.
+	BaseURL string
+}
+
+var (
+	mediaURLMu      sync.RWMutex
+	currentMediaURL *MediaURLConfig
+)
+
+// LoadMediaURLConfigFromEnv configures media URL signing from MEDIA_URL_SIGNING_KEY, MEDIA_URL_TTL
+// and MEDIA_BASE_URL. Without a signing key a development key is used, except in release mode
+// where the key is required.
+func LoadMediaURLConfigFromEnv() error {
+	config := MediaURLConfig{
+		SigningKey: []byte(strings.TrimSpace(os.Getenv("MEDIA_URL_SIGNING_KEY"))),
+		TTL:        DefaultMediaURLTTL,
+		BaseURL:    strings.TrimSpace(os.Getenv("MEDIA_BASE_URL")),
+	}
+	if len(config.SigningKey) == 0 {
+		if gin.Mode() == gin.ReleaseMode {
+			return errors.New("MEDIA_URL_SIGNING_KEY must be set when GIN_MODE=release")
+		}
+		log.Println("MEDIA_URL_SIGNING_KEY is not set; using the insecure development media signing key")
+		config.SigningKey = []byte("media-secret")
+	}
+	if raw := strings.TrimSpace(os.Getenv("MEDIA_URL_TTL")); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("MEDIA_URL_TTL: %w", err)
+		}
+		config.TTL = ttl
+	}
+	return ConfigureMediaURLs(config)
+}
+
+// ConfigureMediaURLs replaces the media URL signing configuration.
+func ConfigureMediaURLs(config MediaURLConfig) error {
+	if len(config.SigningKey) == 0 {
+		return errors.New("media URL signing key must not be empty")
+	}
+	if config.TTL < time.Minute {
+		return fmt.Errorf("media URL lifetime must be at least one minute, got %s", config.TTL)
+	}
+	if config.BaseURL != "" {
+		base, err := url.Parse(config.BaseURL)
+		if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+			return fmt.Errorf("MEDIA_BASE_URL must be an http or https URL, got %q", config.BaseURL)
+		}
+		config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	}
+	mediaURLMu.Lock()
+	currentMediaURL = &config
+	mediaURLMu.Unlock()
+	return nil
+}
+
+// mediaURLConfig returns the configured signing settings. Signing media before
+// LoadMediaURLConfigFromEnv or ConfigureMediaURLs ran is a programming error.
+func mediaURLConfig() MediaURLConfig {
+	mediaURLMu.RLock()
+	defer mediaURLMu.RUnlock()
+	if currentMediaURL == nil {
+		panic("media URL signing is not configured")
+	}
+	return *currentMediaURL
+}
+
+// SignedMediaURL returns a URL for the media stored under key that expires after the configured
+// lifetime. fallbackBase is used when no MEDIA_BASE_URL is configured. Expiry times are rounded up
+// to the minute so repeated requests get the same, cacheable URL. Empty values and absolute URLs
+// that do not point at our storage are returned unchanged.
+func SignedMediaURL(fallbackBase, key string, now time.Time) string {
+	if key == "" || strings.Contains(key, "://") {
+		return key
+	}
+	config := mediaURLConfig()
+	base := config.BaseURL
+	if base == "" {
+		base = strings.TrimRight(fallbackBase, "/")
+	}
+	expires := now.Add(config.TTL).Truncate(time.Minute).Add(time.Minute).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", mediaSignature(config.SigningKey, key, expires))
+	return base + "/uploads/" + key + "?" + query.Encode()
+}
+
+// VerifyMediaSignature reports whether signature was issued for key and expires has not passed.
+func VerifyMediaSignature(key, expires, signature string, now time.Time) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > expiresAt {
+		return false
+	}
+	expected := mediaSignature(mediaURLConfig().SigningKey, key, expiresAt)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func mediaSignature(signingKey []byte, key string, expires int64) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
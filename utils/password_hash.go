@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashes are stored in the PHC string format, for example
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+//
+// where salt and hash are unpadded base64. The algorithm and parameters travel with every hash, so
+// they can change without invalidating stored passwords. Hashes starting with $2a$, $2b$ or $2y$
+// are legacy bcrypt hashes; they still verify but are reported as needing a rehash.
+const argon2idPrefix = "$argon2id$"
+
+// MaxPasswordBytes bounds the passwords HashPassword accepts so a single login cannot tie up the
+// hasher with a huge input.
+const MaxPasswordBytes = 1024
+
+// ErrPasswordTooLong is returned by HashPassword for passwords longer than MaxPasswordBytes.
+var ErrPasswordTooLong = errors.New("password too long")
+
+// PasswordHashParams are the argon2id parameters used for new password hashes.
+type PasswordHashParams struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultPasswordHashParams returns the OWASP recommended minimum of 19 MiB, two iterations and one
+// degree of parallelism.
+func DefaultPasswordHashParams() PasswordHashParams {
+	return PasswordHashParams{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+var (
+	passwordHashParamsMu      sync.RWMutex
+	currentPasswordHashParams *PasswordHashParams
+)
+
+// LoadPasswordHashParamsFromEnv configures the argon2id parameters from
+// PASSWORD_HASH_MEMORY_KIB, PASSWORD_HASH_ITERATIONS and PASSWORD_HASH_PARALLELISM, falling back to
+// DefaultPasswordHashParams for unset variables.
+func LoadPasswordHashParamsFromEnv() error {
+	params := DefaultPasswordHashParams()
+	for name, target := range map[string]*uint32{
+		"PASSWORD_HASH_MEMORY_KIB": &params.Memory,
+		"PASSWORD_HASH_ITERATIONS": &params.Iterations,
+	} {
+		raw := strings.TrimSpace(os.Getenv(name))
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*target = uint32(value)
+	}
+	if raw := strings.TrimSpace(os.Getenv("PASSWORD_HASH_PARALLELISM")); raw != "" {
+		value, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil {
+			return fmt.Errorf("PASSWORD_HASH_PARALLELISM: %w", err)
+		}
+		params.Parallelism = uint8(value)
+	}
+	return ConfigurePasswordHashParams(params)
+}
+
+// ConfigurePasswordHashParams replaces the parameters used for new password hashes. Existing hashes
+// made with other parameters keep verifying and are upgraded on the next successful login.
+func ConfigurePasswordHashParams(params PasswordHashParams) error {
+	switch {
+	case params.Iterations < 1:
+		return fmt.Errorf("password hash iterations must be at least 1, got %d", params.Iterations)
+	case params.Parallelism < 1:
+		return fmt.Errorf("password hash parallelism must be at least 1, got %d", params.Parallelism)
+	case params.Memory < 8*uint32(params.Parallelism):
+		return fmt.Errorf("password hash memory must be at least %d KiB, got %d", 8*uint32(params.Parallelism), params.Memory)
+	case params.SaltLength < 16:
+		return fmt.Errorf("password hash salt must be at least 16 bytes, got %d", params.SaltLength)
+	case params.KeyLength < 16:
+		return fmt.Errorf("password hash key must be at least 16 bytes, got %d", params.KeyLength)
+	}
+	passwordHashParamsMu.Lock()
+	currentPasswordHashParams = &params
+	passwordHashParamsMu.Unlock()
+	return nil
+}
+
+func passwordHashParams() PasswordHashParams {
+	passwordHashParamsMu.RLock()
+	defer passwordHashParamsMu.RUnlock()
+	if currentPasswordHashParams == nil {
+		return DefaultPasswordHashParams()
+	}
+	return *currentPasswordHashParams
+}
+
+// HashPassword hashes the password with argon2id using the configured parameters.
+func HashPassword(password string) (string, error) {
+	if len(password) > MaxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+	params := passwordHashParams()
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword reports whether password matches the stored hash.
+func CheckPassword(hashedPassword, password string) bool {
+	ok, _ := VerifyPassword(hashedPassword, password)
+	return ok
+}
+
+// VerifyPassword reports whether password matches the stored hash and, if it does, whether the hash
+// should be replaced because it uses bcrypt or argon2id parameters other than the configured ones.
+// Empty and unrecognised hashes never match.
+func VerifyPassword(hashedPassword, password string) (ok, needsRehash bool) {
+	if len(password) > MaxPasswordBytes {
+		return false, false
+	}
+	switch {
+	case strings.HasPrefix(hashedPassword, argon2idPrefix):
+		params, salt, key, err := decodeArgon2idHash(hashedPassword)
+		if err != nil {
+			return false, false
+		}
+		candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false
+		}
+		current := passwordHashParams()
+		outdated := params.Memory != current.Memory || params.Iterations != current.Iterations ||
+			params.Parallelism != current.Parallelism || len(salt) != int(current.SaltLength) ||
+			len(key) != int(current.KeyLength)
+		return true, outdated
+	case strings.HasPrefix(hashedPassword, "$2a$"), strings.HasPrefix(hashedPassword, "$2b$"), strings.HasPrefix(hashedPassword, "$2y$"):
+		if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) != nil {
+			return false, false
+		}
+		return true, true
+	}
+	return false, false
+}
+
+func decodeArgon2idHash(encoded string) (PasswordHashParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return PasswordHashParams{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return PasswordHashParams{}, nil, nil, errors.New("unsupported argon2 version")
+	}
+	var params PasswordHashParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return PasswordHashParams{}, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return PasswordHashParams{}, nil, nil, errors.New("invalid argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return PasswordHashParams{}, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return PasswordHashParams{}, nil, nil, errors.New("malformed argon2id key")
+	}
+	return params, salt, key, nil
+}
@@ -34,10 +34,76 @@ type MessageResponse struct {
 	Message string `json:"message"`
 }
 
-// TokenResponse represents a JWT token response.
+// TokenResponse represents the access and refresh tokens issued for a session.
 type TokenResponse struct {
-	Token  string `json:"token"`
-	UserID int    `json:"user_id"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	UserID       int    `json:"user_id"`
+}
+
+// NewTokenResponse builds a TokenResponse from the issued session tokens.
+func NewTokenResponse(tokens models.AuthTokens) TokenResponse {
+	return TokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		UserID:       tokens.UserID,
+	}
+}
+
+// TwoFactorChallengeResponse is returned by Login when the account requires a second factor.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+// TwoFactorEnrollmentResponse carries a new TOTP secret and the URI authenticator apps import.
+type TwoFactorEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// RecoveryCodesResponse lists freshly generated recovery codes.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// SessionsResponse lists the active sessions of the current user.
+type SessionsResponse struct {
+	Sessions []models.Session `json:"sessions"`
+}
+
+// RevokedSessionsResponse reports how many sessions a bulk revocation ended.
+type RevokedSessionsResponse struct {
+	Message string `json:"message"`
+	Revoked int64  `json:"revoked"`
+}
+
+// OIDCAuthorizationResponse carries the provider URL that starts an OpenID Connect sign-in.
+type OIDCAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// IdentitiesResponse lists the external accounts linked to the current user.
+type IdentitiesResponse struct {
+	Identities []models.LinkedIdentity `json:"identities"`
+}
+
+// ProfilePhotosResponse lists the photos of a profile gallery in display order.
+type ProfilePhotosResponse struct {
+	Photos []models.ProfilePhoto `json:"photos"`
+}
+
+// ModerationItemsResponse lists moderation queue entries.
+type ModerationItemsResponse struct {
+	Items []models.ModerationItem `json:"items"`
+}
+
+// ProfileHistoryResponse lists versions of a profile, newest first.
+type ProfileHistoryResponse struct {
+	Entries []models.ProfileHistoryEntry `json:"entries"`
 }
 
 // ErrorResponse represents an error message returned to the client.
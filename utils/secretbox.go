@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+var (
+	secretKeyOnce sync.Once
+	secretKey     []byte
+	secretKeyErr  error
+)
+
+// loadSecretKey reads the AES-256 key used to encrypt secrets at rest from TOTP_ENCRYPTION_KEY, a
+// base64 encoded 32 byte value. Without it a development key is derived and a warning is logged.
+func loadSecretKey() ([]byte, error) {
+	secretKeyOnce.Do(func() {
+		raw := os.Getenv("TOTP_ENCRYPTION_KEY")
+		if raw == "" {
+			log.Println("TOTP_ENCRYPTION_KEY is not set; using the insecure development encryption key")
+			sum := sha256.Sum256([]byte("insecure-development-encryption-key"))
+			secretKey = sum[:]
+			return
+		}
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) != 32 {
+			secretKeyErr = errors.New("TOTP_ENCRYPTION_KEY must be a base64 encoded 32 byte key")
+			return
+		}
+		secretKey = key
+	})
+	return secretKey, secretKeyErr
+}
+
+// LoadSecretKeyFromEnv validates the encryption key configuration so that a bad key fails at startup.
+func LoadSecretKeyFromEnv() error {
+	_, err := loadSecretKey()
+	return err
+}
+
+// EncryptSecret seals plaintext with AES-GCM and returns the nonce and ciphertext base64 encoded.
+func EncryptSecret(plaintext string) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret opens a value produced by EncryptSecret.
+func DecryptSecret(encoded string) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("secret ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	key, err := loadSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// defaultSigningKeyID names the key derived from JWT_SECRET or the development fallback.
+const defaultSigningKeyID = "default"
+
+// SigningKey is a key that access tokens can be signed or verified with. HMAC keys carry a Secret,
+// RS256 and EdDSA keys carry a PrivateKey whose public half is published through the JWKS endpoint.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey crypto.Signer
+}
+
+// signingMaterial returns the key handed to the jwt library when signing.
+func (k SigningKey) signingMaterial() interface{} {
+	if k.PrivateKey != nil {
+		return k.PrivateKey
+	}
+	return k.Secret
+}
+
+// verificationMaterial returns the key handed to the jwt library when verifying.
+func (k SigningKey) verificationMaterial() interface{} {
+	if k.PrivateKey != nil {
+		return k.PrivateKey.Public()
+	}
+	return k.Secret
+}
+
+func (k SigningKey) validate() error {
+	switch k.Algorithm {
+	case jwt.SigningMethodHS256.Alg(), jwt.SigningMethodHS384.Alg(), jwt.SigningMethodHS512.Alg():
+		if len(k.Secret) == 0 {
+			return fmt.Errorf("signing key %q has an empty secret", k.ID)
+		}
+		if k.PrivateKey != nil {
+			return fmt.Errorf("signing key %q mixes a secret with a private key", k.ID)
+		}
+	case jwt.SigningMethodRS256.Alg():
+		if _, ok := k.PrivateKey.(*rsa.PrivateKey); !ok {
+			return fmt.Errorf("signing key %q requires an RSA private key", k.ID)
+		}
+	case jwt.SigningMethodEdDSA.Alg():
+		if _, ok := k.PrivateKey.(ed25519.PrivateKey); !ok {
+			return fmt.Errorf("signing key %q requires an Ed25519 private key", k.ID)
+		}
+	default:
+		return fmt.Errorf("signing key %q uses unsupported algorithm %q", k.ID, k.Algorithm)
+	}
+	return nil
+}
+
+// keyRing holds every key accepted for verification and the one used for signing new tokens.
+type keyRing struct {
+	active  SigningKey
+	byID    map[string]SigningKey
+	methods []string
+}
+
+var (
+	keyRingMu      sync.RWMutex
+	currentKeyRing *keyRing
+)
+
+// LoadSigningKeysFromEnv configures the signing keys from the environment.
+//
+// JWT_SIGNING_KEYS holds a comma separated list of kid:secret pairs for HS256 keys and
+// JWT_PRIVATE_KEYS a list of kid:path pairs pointing at PEM encoded RSA (RS256) or Ed25519 (EdDSA)
+// private keys. Every listed key is accepted when verifying tokens, so a new key can be introduced
+// ahead of switching JWT_ACTIVE_KEY_ID to it and an old key can stay listed until the tokens it
+// signed have expired. When neither is set JWT_SECRET is used as a single key, and as a last resort
+// a development secret.
+func LoadSigningKeysFromEnv() error {
+	keys, err := parseSigningKeys(os.Getenv("JWT_SIGNING_KEYS"))
+	if err != nil {
+		return err
+	}
+	privateKeys, err := loadPrivateKeys(os.Getenv("JWT_PRIVATE_KEYS"))
+	if err != nil {
+		return err
+	}
+	keys = append(keys, privateKeys...)
+	if len(keys) == 0 {
+		secret := strings.TrimSpace(os.Getenv("JWT_SECRET"))
+		if secret == "" {
+			log.Println("JWT_SIGNING_KEYS and JWT_SECRET are not set; using the insecure development signing key")
+			secret = "secret"
+		}
+		keys = []SigningKey{{ID: defaultSigningKeyID, Algorithm: jwt.SigningMethodHS256.Alg(), Secret: []byte(secret)}}
+	}
+	return ConfigureSigningKeys(keys, strings.TrimSpace(os.Getenv("JWT_ACTIVE_KEY_ID")))
+}
+
+// ConfigureSigningKeys replaces the configured keys. activeID selects the signing key and defaults
+// to the first key when empty.
+func ConfigureSigningKeys(keys []SigningKey, activeID string) error {
+	if len(keys) == 0 {
+		return errors.New("at least one signing key is required")
+	}
+
+	ring := &keyRing{byID: make(map[string]SigningKey, len(keys))}
+	seenMethods := make(map[string]bool)
+	for _, key := range keys {
+		if key.ID == "" {
+			return errors.New("signing key id must not be empty")
+		}
+		if _, exists := ring.byID[key.ID]; exists {
+			return fmt.Errorf("duplicate signing key id %q", key.ID)
+		}
+		if err := key.validate(); err != nil {
+			return err
+		}
+		ring.byID[key.ID] = key
+		if !seenMethods[key.Algorithm] {
+			seenMethods[key.Algorithm] = true
+			ring.methods = append(ring.methods, key.Algorithm)
+		}
+	}
+
+	if activeID == "" {
+		activeID = keys[0].ID
+	}
+	active, ok := ring.byID[activeID]
+	if !ok {
+		return fmt.Errorf("active signing key %q is not configured", activeID)
+	}
+	ring.active = active
+
+	keyRingMu.Lock()
+	currentKeyRing = ring
+	keyRingMu.Unlock()
+	return nil
+}
+
+// signingKeys returns the configured key ring, loading it from the environment on first use.
+func signingKeys() (*keyRing, error) {
+	keyRingMu.RLock()
+	ring := currentKeyRing
+	keyRingMu.RUnlock()
+	if ring != nil {
+		return ring, nil
+	}
+
+	if err := LoadSigningKeysFromEnv(); err != nil {
+		return nil, err
+	}
+	keyRingMu.RLock()
+	defer keyRingMu.RUnlock()
+	return currentKeyRing, nil
+}
+
+// parseSigningKeys parses comma separated kid:secret pairs into HS256 keys.
+func parseSigningKeys(raw string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid JWT_SIGNING_KEYS entry %q, expected kid:secret", entry)
+		}
+		keys = append(keys, SigningKey{ID: strings.TrimSpace(parts[0]), Algorithm: jwt.SigningMethodHS256.Alg(), Secret: []byte(parts[1])})
+	}
+	return keys, nil
+}
+
+// loadPrivateKeys reads comma separated kid:path pairs of PEM encoded private keys.
+func loadPrivateKeys(raw string) ([]SigningKey, error) {
+	var keys []SigningKey
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid JWT_PRIVATE_KEYS entry %q, expected kid:path", entry)
+		}
+		kid, path := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read private key %q: %w", kid, err)
+		}
+		key, err := ParsePrivateKeyPEM(kid, data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ParsePrivateKeyPEM turns a PKCS#8 or PKCS#1 PEM block into a signing key, choosing RS256 for RSA
+// keys and EdDSA for Ed25519 keys.
+func ParsePrivateKeyPEM(kid string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("private key %q is not PEM encoded", kid)
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("parse private key %q: %w", kid, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return SigningKey{ID: kid, Algorithm: jwt.SigningMethodRS256.Alg(), PrivateKey: key}, nil
+	case ed25519.PrivateKey:
+		return SigningKey{ID: kid, Algorithm: jwt.SigningMethodEdDSA.Alg(), PrivateKey: key}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("private key %q has unsupported type %T", kid, parsed)
+	}
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPPeriod is the time step of RFC 6238 codes.
+	TOTPPeriod = 30 * time.Second
+	// TOTPDigits is the number of digits in a code.
+	TOTPDigits = 6
+	// totpSkew is the number of steps before and after the current one that are still accepted.
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random base32 encoded shared secret.
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPProvisioningURI builds the otpauth:// URI authenticator apps import, usually through a QR code.
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPStep returns the time step that t falls into.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// TOTPCode computes the code of the secret for the given time step.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("decode totp secret: %w", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%1000000), nil
+}
+
+// ValidateTOTP checks the code against the steps around t and returns the matching step. Steps at or
+// before lastUsedStep are refused so that a code cannot be replayed.
+func ValidateTOTP(secret, code string, t time.Time, lastUsedStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	current := TOTPStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
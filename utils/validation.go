@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FieldError describes why a single input field was rejected. Code is a stable machine readable
+// identifier such as "too_short"; Message is meant for people.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field level problem found in a request.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add records a problem with a field.
+func (e *ValidationError) Add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// OrNil returns the error when at least one field was rejected and nil otherwise.
+func (e *ValidationError) OrNil() error {
+	if e == nil || len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		parts = append(parts, field.Field+": "+field.Code)
+	}
+	return "validation failed: " + strings.Join(parts, ", ")
+}
+
+// ValidationErrorResponse is returned with status 422 when input fails validation.
+type ValidationErrorResponse struct {
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields"`
+}
+
+// RespondValidationError logs the rejected fields and sends them to the client with status 422.
+func RespondValidationError(ctx *gin.Context, err *ValidationError, logMsg string) {
+	log.Printf("%s: %v", logMsg, err)
+	ctx.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{Error: "Validation failed", Fields: err.Fields})
+}